@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// runHealthCheck 供容器的HEALTHCHECK使用，未配置api.listen时没有可检查的接口，直接视为健康
+func runHealthCheck(config *entity.APIConfig) int {
+	if config == nil || config.Listen == "" {
+		_, _ = fmt.Fprintln(os.Stdout, "api.listen is not configured, health check skipped")
+		return 0
+	}
+	healthURL, err := healthCheckURL(config.Listen)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid api.listen %q, %v\n", config.Listen, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Health check failed, %v\n", err)
+		return 1
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Health check failed, %v\n", err)
+		return 1
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		_, _ = fmt.Fprintf(os.Stderr, "Health check failed, %v returned %v\n", healthURL, response.Status)
+		return 1
+	}
+	return 0
+}
+
+// healthCheckURL 监听所有地址时通过本机回环地址访问
+func healthCheckURL(listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/healthz", nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestHealthCheckURL(t *testing.T) {
+	tests := []struct {
+		listen  string
+		want    string
+		wantErr bool
+	}{
+		{":8080", "http://127.0.0.1:8080/healthz", false},
+		{"0.0.0.0:8080", "http://127.0.0.1:8080/healthz", false},
+		{"[::]:8080", "http://127.0.0.1:8080/healthz", false},
+		{"192.168.1.2:9090", "http://192.168.1.2:9090/healthz", false},
+		{"[::1]:9090", "http://[::1]:9090/healthz", false},
+		{"localhost:9090", "http://localhost:9090/healthz", false},
+		{"8080", "", true},
+	}
+	for _, tt := range tests {
+		got, err := healthCheckURL(tt.listen)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("healthCheckURL(%q) = %q, %v, want %q", tt.listen, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	listen := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name    string
+		config  *entity.APIConfig
+		healthy bool
+		want    int
+	}{
+		{"api disabled", nil, false, 0},
+		{"listen empty", &entity.APIConfig{}, false, 0},
+		{"healthy", &entity.APIConfig{Listen: listen}, true, 0},
+		{"unhealthy", &entity.APIConfig{Listen: listen}, false, 1},
+		{"invalid listen", &entity.APIConfig{Listen: "8080"}, true, 1},
+	}
+	for _, tt := range tests {
+		healthy.Store(tt.healthy)
+		if got := runHealthCheck(tt.config); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	server.Close()
+	if got := runHealthCheck(&entity.APIConfig{Listen: listen}); got != 1 {
+		t.Errorf("closed server: got %v, want 1", got)
+	}
+}
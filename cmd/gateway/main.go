@@ -8,44 +8,114 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
-	"github.com/goccy/go-yaml"
-	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/alarm"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/api"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/broker"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/config"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/outletgroup"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/policy"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/publisher"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/scheduler"
 )
 
-type Config struct {
-	Collectors []*entity.CollectorConfig `yaml:"collectors"`
-	Publishers []*entity.PublisherConfig `yaml:"publishers"`
-}
-
 func main() {
-	config := loadConfig()
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	// SIGHUP或配置文件变化时热加载采集器和发布器，启动期间收到的SIGHUP留到初始化完成后处理，不会使进程退出
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+
+	gatewayConfig := loadConfig()
+	// 各模块Init会在配置上填充默认值，热加载时与加载时的原样比较，避免误报配置变化
+	loadedConfig := gatewayConfig.Clone()
 
 	database.Init(ctx)
-	if err := collector.Init(ctx, config.Collectors); err != nil {
+	if err := alarm.Init(ctx, gatewayConfig.Alarms); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := outletgroup.Init(ctx, gatewayConfig.OutletGroups); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := policy.InitRestore(ctx, gatewayConfig.Restore); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := collector.InitProtection(ctx, gatewayConfig.Protection); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := broker.Init(ctx, gatewayConfig.Broker); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := collector.Init(ctx, gatewayConfig.Collectors); err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
-	if err := publisher.Init(ctx, config.Publishers); err != nil {
+	if err := publisher.Init(ctx, gatewayConfig.Publishers); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := policy.InitLoadShedding(ctx, gatewayConfig.LoadShedding); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := scheduler.Init(ctx, gatewayConfig.Scheduler); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := api.Init(ctx, gatewayConfig.API); err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
 
-	<-ctx.Done()
+	var watcher *configWatcher
+	var watchTick <-chan time.Time
+	if *watchConfig > 0 {
+		watcher = newConfigWatcher(*configFilePath)
+		ticker := time.NewTicker(*watchConfig)
+		defer ticker.Stop()
+		watchTick = ticker.C
+	}
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-reloadSignal:
+			if watcher != nil {
+				watcher.changed()
+			}
+			loadedConfig = reloadConfig(ctx, loadedConfig, *configFilePath)
+		case <-watchTick:
+			if watcher.changed() {
+				loadedConfig = reloadConfig(ctx, loadedConfig, *configFilePath)
+			}
+		}
+	}
 	slog.Info("Received shutdown signal, exiting gracefully...")
 
 	stopCtx := context.Background()
+	api.Stop(stopCtx)
 	collector.Stop(stopCtx)
 	publisher.Stop(stopCtx)
+	broker.Stop(stopCtx)
 }
 
-func loadConfig() *Config {
-	configFilePath := flag.String("config", "./configs/gateway.yaml", "Config file path")
+var (
+	configFilePath = flag.String("config", "./configs/gateway.yaml", "Config file path")
+	checkConfig    = flag.Bool("check-config", false, "Validate config file and exit")
+	healthCheck    = flag.Bool("healthcheck", false, "Probe /healthz on the configured api.listen and exit, for container health checks")
+	watchConfig    = flag.Duration("watch-config", 0, "Interval to check config file for changes and reload, 0 to disable")
+)
+
+// loadConfig 开启--check-config时只检查配置，开启--healthcheck时只检查运行中的网关，完成后直接退出
+func loadConfig() *config.Config {
 	flag.Parse()
 	if configFilePath == nil || *configFilePath == "" {
 		_, _ = fmt.Fprintf(os.Stderr, "Config file not provide")
@@ -60,15 +130,17 @@ func loadConfig() *Config {
 		os.Exit(3)
 	}
 
-	configBytes, err := os.ReadFile(*configFilePath)
+	result, err := config.Load(*configFilePath)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Read config file failed, %v", err)
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid config file %v:\n%v\n", *configFilePath, err)
 		os.Exit(3)
 	}
-	var config Config
-	if err = yaml.Unmarshal(configBytes, &config); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Unmarshal config file failed, %v", err)
-		os.Exit(3)
+	if *checkConfig {
+		_, _ = fmt.Fprintf(os.Stdout, "Config file %v is valid\n", *configFilePath)
+		os.Exit(0)
+	}
+	if *healthCheck {
+		os.Exit(runHealthCheck(result.API))
 	}
-	return &config
+	return result
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/config"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/publisher"
+)
+
+// reloadStopTimeout 重新加载时等待旧实例断开连接的最长时间
+const reloadStopTimeout = 10 * time.Second
+
+// reloadConfig 重新读取配置文件，只重启有变化的采集器和发布器，数据库和其它模块保持不变
+// current必须是加载时的原样，不能是被Init填充过默认值的配置
+// 新配置校验或启动失败时继续使用原来的配置，返回当前生效的配置
+func reloadConfig(ctx context.Context, current *config.Config, path string) *config.Config {
+	slog.Info("Reloading config file", "path", path)
+	next, err := config.Load(path)
+	if err != nil {
+		slog.Error("Reload config failed, keep running with previous config", "err", err)
+		return current
+	}
+	keepRestartOnlySections(current, next)
+
+	stopCtx, cancel := context.WithTimeout(ctx, reloadStopTimeout)
+	defer cancel()
+	if err = collector.Reload(stopCtx, next.Collectors); err != nil {
+		slog.Error("Reload collectors failed, keep running with previous config", "err", err)
+		return current
+	}
+	if err = publisher.Reload(stopCtx, next.Publishers); err != nil {
+		slog.Error("Reload publishers failed, keep running with previous config", "err", err)
+		if err = collector.Reload(stopCtx, current.Collectors); err != nil {
+			slog.Error("Restore collectors failed", "err", err)
+		}
+		return current
+	}
+	slog.Info("Config reloaded", "path", path)
+	return next
+}
+
+// keepRestartOnlySections 只有采集器和发布器支持热加载，其它配置块的修改在重启后生效，返回有变化的配置块
+func keepRestartOnlySections(current *config.Config, next *config.Config) []string {
+	sections := []struct {
+		name    string
+		current any
+		next    any
+		restore func()
+	}{
+		{"broker", current.Broker, next.Broker, func() { next.Broker = current.Broker }},
+		{"alarms", current.Alarms, next.Alarms, func() { next.Alarms = current.Alarms }},
+		{"load_shedding", current.LoadShedding, next.LoadShedding, func() { next.LoadShedding = current.LoadShedding }},
+		{"scheduler", current.Scheduler, next.Scheduler, func() { next.Scheduler = current.Scheduler }},
+		{"outlet_groups", current.OutletGroups, next.OutletGroups, func() { next.OutletGroups = current.OutletGroups }},
+		{"restore", current.Restore, next.Restore, func() { next.Restore = current.Restore }},
+		{"protection", current.Protection, next.Protection, func() { next.Protection = current.Protection }},
+		{"api", current.API, next.API, func() { next.API = current.API }},
+	}
+	changed := make([]string, 0)
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.current, section.next) {
+			slog.Warn("Config section changed, restart required to take effect", "section", section.name)
+			section.restore()
+			changed = append(changed, section.name)
+		}
+	}
+	return changed
+}
+
+// configWatcher 定期比较配置文件内容的摘要，兼容Kubernetes通过替换符号链接更新ConfigMap的方式
+type configWatcher struct {
+	path string
+	hash [sha256.Size]byte // 最近一次尝试加载的内容，加载失败时不会反复重试同一份内容
+}
+
+func newConfigWatcher(path string) *configWatcher {
+	watcher := &configWatcher{path: path}
+	watcher.changed()
+	return watcher
+}
+
+// changed 文件暂时无法读取时视为未变化，等待下一次检查
+func (watcher *configWatcher) changed() bool {
+	content, err := os.ReadFile(watcher.path)
+	if err != nil {
+		slog.Warn("Read config file failed", "path", watcher.path, "err", err)
+		return false
+	}
+	hash := sha256.Sum256(content)
+	if hash == watcher.hash {
+		return false
+	}
+	watcher.hash = hash
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/config"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/outletgroup"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/policy"
+)
+
+const reloadTestConfig = `
+collectors:
+  - type: mqtt
+    mqtt:
+      url: mqtt://127.0.0.1:1883
+      client_id: collector
+publishers:
+  - type: hass_mqtt
+    mqtt:
+      url: mqtt://127.0.0.1:1883
+      client_id: publisher
+      topic: homeassistant/device/+/set
+restore:
+  policy: restore_last
+outlet_groups:
+  - name: rack
+    members:
+      - node_id: node
+        outlets: ["1", "2"]
+`
+
+func loadTestConfig(t *testing.T, content string) *config.Config {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestKeepRestartOnlySections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := loadTestConfig(t, reloadTestConfig)
+	loaded := running.Clone()
+	// Init会在运行中的配置上填充默认值
+	if err := policy.InitRestore(ctx, running.Restore); err != nil {
+		t.Fatal(err)
+	}
+	if err := outletgroup.Init(ctx, running.OutletGroups); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed := keepRestartOnlySections(loaded, loadTestConfig(t, reloadTestConfig)); len(changed) != 0 {
+		t.Errorf("unchanged file reported changed sections %v", changed)
+	}
+
+	next := loadTestConfig(t, reloadTestConfig+"api:\n  listen: :8081\n")
+	changed := keepRestartOnlySections(loaded, next)
+	if !slices.Equal(changed, []string{"api"}) {
+		t.Errorf("got changed sections %v, want [api]", changed)
+	}
+	if next.API != nil {
+		t.Errorf("changed api section should be replaced by the running one, got %+v", next.API)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watcher := newConfigWatcher(path)
+	if watcher.changed() {
+		t.Error("content not changed since start")
+	}
+	if err := os.WriteFile(path, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !watcher.changed() {
+		t.Error("content changed")
+	}
+	if watcher.changed() {
+		t.Error("the same content should only be reported once")
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if watcher.changed() {
+		t.Error("missing file should be treated as unchanged")
+	}
+}
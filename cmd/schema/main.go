@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/config"
+)
+
+// 生成配置文件的JSON Schema，通过go generate ./...更新configs/gateway.schema.json
+func main() {
+	output := flag.String("o", "", "Output file path, print to stdout if empty")
+	flag.Parse()
+
+	schemaBytes, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Marshal schema failed, %v\n", err)
+		os.Exit(1)
+	}
+	schemaBytes = append(schemaBytes, '\n')
+	if *output == "" {
+		_, _ = os.Stdout.Write(schemaBytes)
+		return
+	}
+	if err = os.WriteFile(*output, schemaBytes, 0o644); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Write schema failed, %v\n", err)
+		os.Exit(1)
+	}
+}
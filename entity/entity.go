@@ -1,42 +1,493 @@
 package entity
 
+import "time"
+
+// MQTTConfig 客户端库只实现了MQTT 5，不支持只有MQTT 3.1.1的broker
 type MQTTConfig struct {
-	URL       string `yaml:"url"`
-	Keepalive uint16 `yaml:"keepalive"`
-	Topic     string `yaml:"topic"`
-	ClientID  string `yaml:"client_id"`
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
+	URL       string     `yaml:"url"`
+	URLs      []string   `yaml:"urls"` // 备用broker，连接时先尝试url再按顺序尝试urls
+	Keepalive uint16     `yaml:"keepalive"`
+	Topic     string     `yaml:"topic"`
+	ClientID  string     `yaml:"client_id"`
+	Username  string     `yaml:"username"`
+	Password  string     `yaml:"password"`
+	TLS       *TLSConfig `yaml:"tls"` // 用于mqtts://和wss://
+
+	ConnectTimeout    time.Duration `yaml:"connect_timeout"`     // 单个broker的连接超时，默认10s
+	ReconnectMinDelay time.Duration `yaml:"reconnect_min_delay"` // 所有broker都连接失败后的重连间隔，默认10s
+	ReconnectMaxDelay time.Duration `yaml:"reconnect_max_delay"` // 大于reconnect_min_delay时按指数退避增长到该值
+
+	CleanStart       bool               `yaml:"clean_start"`       // 首次连接时清除broker上保存的会话
+	SessionExpiry    *time.Duration     `yaml:"session_expiry"`    // 断开后会话保留时间，默认60s，0表示断开即结束会话
+	SubscribeQoS     *byte              `yaml:"subscribe_qos"`     // 默认1
+	StatePublish     *MQTTPublishConfig `yaml:"state_publish"`     // HASS状态，默认qos 0、retain
+	DiscoveryPublish *MQTTPublishConfig `yaml:"discovery_publish"` // HASS发现配置，默认qos 0、retain
+	CommandPublish   *MQTTPublishConfig `yaml:"command_publish"`   // 发往PDU的控制命令，默认qos 0、不retain
 }
 
-type CollectorConfig struct {
-	Type string      `yaml:"type"`
+// MQTTPublishConfig qos大于0的控制命令在断线期间会进入队列，重连后再发送
+type MQTTPublishConfig struct {
+	QoS    *byte `yaml:"qos"`
+	Retain *bool `yaml:"retain"`
+}
+
+// TLSConfig 未配置ca_file时使用系统根证书，配置cert_file和key_file时启用双向认证
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 仅用于实验环境
+	MinVersion         string `yaml:"min_version"`          // 1.0, 1.1, 1.2, 1.3，默认1.2
+}
+
+// BrokerConfig 内置MQTT broker，PDU可以直接连接网关
+type BrokerConfig struct {
+	Listen          string              `yaml:"listen"`           // 默认:1883
+	WebsocketListen string              `yaml:"websocket_listen"` // 为空时不启用
+	Users           []*BrokerUserConfig `yaml:"users"`            // 未开启allow_anonymous时必须配置
+	AllowAnonymous  bool                `yaml:"allow_anonymous"`  // 允许匿名连接，局域网内任何人都可以下发控制命令
+	Bridge          *BridgeConfig       `yaml:"bridge"`
+}
+
+type BrokerUserConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// BridgeConfig 与上游broker之间转发消息，out和in不应有重叠的主题
+type BridgeConfig struct {
 	MQTT *MQTTConfig `yaml:"mqtt"`
+	Out  []string    `yaml:"out"` // 转发到上游的本地主题过滤器
+	In   []string    `yaml:"in"`  // 转发到本地的上游主题过滤器，Yespeed的in方向控制主题不会被转发
+}
+
+type CollectorConfig struct {
+	Name    string                 `yaml:"name"` // 用于状态和日志，默认{type}_{序号}
+	Type    string                 `yaml:"type"`
+	MQTT    *MQTTConfig            `yaml:"mqtt"`
+	HTTP    *HTTPCollectorConfig   `yaml:"http"`
+	SNMP    *SNMPCollectorConfig   `yaml:"snmp"`
+	Modbus  *ModbusCollectorConfig `yaml:"modbus"`
+	Yespeed *YespeedConfig         `yaml:"yespeed"`
+	Layout  *OutletLayoutConfig    `yaml:"layout"`
+}
+
+// HTTPCollectorConfig 直接轮询PDU自带的Web接口，适用于无法配置MQTT的PDU
+type HTTPCollectorConfig struct {
+	Interval    time.Duration       `yaml:"interval"`     // 轮询间隔，默认10s
+	Timeout     time.Duration       `yaml:"timeout"`      // 单次请求超时，默认5s
+	StatePath   string              `yaml:"state_path"`   // 返回设备组上报格式JSON的路径
+	ControlPath string              `yaml:"control_path"` // 接收控制请求的路径
+	Devices     []*HTTPDeviceConfig `yaml:"devices"`
+}
+
+type HTTPDeviceConfig struct {
+	NodeID   string        `yaml:"node_id"`
+	URL      string        `yaml:"url"` // PDU的Web地址，例如http://192.168.91.126
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"` // 覆盖全局超时
+}
+
+// SNMPCollectorConfig 通过SNMP轮询和控制PDU，不同型号的OID在models中配置
+type SNMPCollectorConfig struct {
+	Interval time.Duration               `yaml:"interval"` // 轮询间隔，默认10s
+	Timeout  time.Duration               `yaml:"timeout"`  // 单次请求超时，默认5s
+	Retries  int                         `yaml:"retries"`
+	Models   map[string]*SNMPModelConfig `yaml:"models"`
+	Devices  []*SNMPDeviceConfig         `yaml:"devices"`
+}
+
+// SNMPModelConfig 每个插座的OID为表OID后接插座序号，例如state_oid.1
+type SNMPModelConfig struct {
+	Outlets      int     `yaml:"outlets"` // 插座数量，插座序号从1开始
+	NameOID      string  `yaml:"name_oid"`
+	StateOID     string  `yaml:"state_oid"`
+	StateOn      *int    `yaml:"state_on"` // state_oid读到该值表示打开，默认1
+	VoltageOID   string  `yaml:"voltage_oid"`
+	CurrentOID   string  `yaml:"current_oid"`
+	PowerOID     string  `yaml:"power_oid"`
+	EnergyOID    string  `yaml:"energy_oid"`
+	VoltageScale float32 `yaml:"voltage_scale"` // 原始值乘以该系数，例如0.1，默认1
+	CurrentScale float32 `yaml:"current_scale"`
+	PowerScale   float32 `yaml:"power_scale"`
+	EnergyScale  float32 `yaml:"energy_scale"`
+	ControlOID   string  `yaml:"control_oid"`
+	ControlOn    *int    `yaml:"control_on"`  // 打开时写入的值，默认1
+	ControlOff   int     `yaml:"control_off"` // 关闭时写入的值，默认0
+}
+
+type SNMPDeviceConfig struct {
+	NodeID    string        `yaml:"node_id"`
+	Address   string        `yaml:"address"` // host或host:port，默认端口161
+	Model     string        `yaml:"model"`
+	Version   string        `yaml:"version"` // 2c或3，默认2c
+	Community string        `yaml:"community"`
+	Timeout   time.Duration `yaml:"timeout"` // 覆盖全局超时
+
+	// 以下仅SNMPv3使用
+	Username      string `yaml:"username"`
+	SecurityLevel string `yaml:"security_level"` // noAuthNoPriv, authNoPriv, authPriv
+	AuthProtocol  string `yaml:"auth_protocol"`  // MD5, SHA, SHA224, SHA256, SHA384, SHA512
+	AuthPassword  string `yaml:"auth_password"`
+	PrivProtocol  string `yaml:"priv_protocol"` // DES, AES, AES192, AES256
+	PrivPassword  string `yaml:"priv_password"`
+}
+
+// ModbusCollectorConfig 通过Modbus TCP轮询PDU或电表，不同型号的寄存器表在models中配置
+type ModbusCollectorConfig struct {
+	Interval time.Duration                 `yaml:"interval"` // 轮询间隔，默认10s
+	Timeout  time.Duration                 `yaml:"timeout"`  // 单次请求超时，默认5s
+	Models   map[string]*ModbusModelConfig `yaml:"models"`
+	Devices  []*ModbusDeviceConfig         `yaml:"devices"`
+}
+
+type ModbusModelConfig struct {
+	Inlet   *ModbusInletConfig    `yaml:"inlet"` // 总输入，映射为ID为1的设备组
+	Outlets []*ModbusOutletConfig `yaml:"outlets"`
+}
+
+type ModbusInletConfig struct {
+	Voltage   *ModbusRegisterConfig `yaml:"voltage"`
+	Current   *ModbusRegisterConfig `yaml:"current"`
+	Power     *ModbusRegisterConfig `yaml:"power"`
+	Energy    *ModbusRegisterConfig `yaml:"energy"`
+	Factor    *ModbusRegisterConfig `yaml:"factor"`
+	Frequency *ModbusRegisterConfig `yaml:"frequency"`
+}
+
+type ModbusOutletConfig struct {
+	ID          string                `yaml:"id"`
+	Name        string                `yaml:"name"`
+	State       *ModbusRegisterConfig `yaml:"state"`        // 非0表示打开
+	ControlCoil *uint16               `yaml:"control_coil"` // 写线圈控制开关，未配置时不可控制
+	Voltage     *ModbusRegisterConfig `yaml:"voltage"`
+	Current     *ModbusRegisterConfig `yaml:"current"`
+	Power       *ModbusRegisterConfig `yaml:"power"`
+	Energy      *ModbusRegisterConfig `yaml:"energy"`
+}
+
+type ModbusRegisterConfig struct {
+	Table     string  `yaml:"table"` // coil, discrete_input, holding, input，默认holding
+	Address   uint16  `yaml:"address"`
+	DataType  string  `yaml:"data_type"`  // uint16, int16, uint32, int32, float32，默认uint16
+	SwapWords bool    `yaml:"swap_words"` // 32位数据低位字在前
+	Scale     float32 `yaml:"scale"`      // 原始值乘以该系数，默认1
+}
+
+type ModbusDeviceConfig struct {
+	NodeID  string        `yaml:"node_id"`
+	Address string        `yaml:"address"` // host或host:port，默认端口502
+	SlaveID byte          `yaml:"slave_id"`
+	Model   string        `yaml:"model"`
+	Timeout time.Duration `yaml:"timeout"` // 覆盖全局超时
+}
+
+// OutletLayoutConfig 插座全局ID与(设备组, 组内序号)的对应关系
+type OutletLayoutConfig struct {
+	OutletsPerGroup int            `yaml:"outlets_per_group"` // 每个设备组的插座数，默认4，遥测中出现更多插座时自动扩大
+	Nodes           map[string]int `yaml:"nodes"`             // 按节点覆盖outlets_per_group
+	StateFile       string         `yaml:"state_file"`        // 持久化已分配的全局ID，保证重启和扩容后ID不变
+}
+
+// YespeedConfig PDU的MQTT主题格式为{topic_prefix}/{vendor}/{节点ID}/{out|in}/{消息ID}
+type YespeedConfig struct {
+	TopicPrefix      string `yaml:"topic_prefix"`       // 默认/yespeed/pdu
+	Vendor           string `yaml:"vendor"`             // 默认yespeed
+	ReportMessageID  string `yaml:"report_message_id"`  // 设备组上报，默认1000000
+	ControlMessageID string `yaml:"control_message_id"` // 插座控制，默认1000101
+	// MessageIDs 其它消息类型的消息ID，键为device_info, network_config, alarm, threshold, energy_reset, control_response
+	// control_response默认与control_message_id相同，其余没有默认值，未配置的消息按未知消息采样
+	MessageIDs map[string]string `yaml:"message_ids"`
 }
 
 type PublisherConfig struct {
-	Type string      `yaml:"type"`
-	MQTT *MQTTConfig `yaml:"mqtt"`
+	Name    string         `yaml:"name"` // 用于状态和日志，默认{type}_{序号}
+	Type    string         `yaml:"type"`
+	MQTT    *MQTTConfig    `yaml:"mqtt"`
+	Webhook *WebhookConfig `yaml:"webhook"`
+}
+
+type WebhookConfig struct {
+	URLs           []string      `yaml:"urls"`
+	Secret         string        `yaml:"secret"`           // HMAC-SHA256签名密钥，为空则不签名
+	Events         []EventType   `yaml:"events"`           // 需要推送的事件类型，为空则推送全部
+	Timeout        time.Duration `yaml:"timeout"`          // 单次请求超时
+	MaxRetries     int           `yaml:"max_retries"`      // 失败后的最大重试次数
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`    // 首次重试间隔，之后每次翻倍
+	DeadLetterFile string        `yaml:"dead_letter_file"` // 重试耗尽或队列已满时写入的文件
+	QueueSize      int           `yaml:"queue_size"`       // 每个地址待投递事件的上限，默认1024
+}
+
+type AlarmConfig struct {
+	Name       string        `yaml:"name"`
+	Scope      string        `yaml:"scope"`   // outlet->单个插座，group->整个设备组
+	NodeID     string        `yaml:"node_id"` // 为空则匹配全部节点
+	ID         string        `yaml:"id"`      // 插座或设备组ID，为空则匹配全部
+	Metric     string        `yaml:"metric"`  // voltage, current, power
+	Min        *float32      `yaml:"min"`
+	Max        *float32      `yaml:"max"`
+	Hysteresis float32       `yaml:"hysteresis"` // 恢复时需要回到阈值内的余量
+	Duration   time.Duration `yaml:"duration"`   // 越限持续多久才告警
+}
+
+type LoadSheddingConfig struct {
+	Name      string        `yaml:"name"`
+	NodeID    string        `yaml:"node_id"`
+	GroupID   string        `yaml:"group_id"`
+	Limit     float32       `yaml:"limit"`      // 设备组总电流上限(A)
+	Duration  time.Duration `yaml:"duration"`   // 超限持续多久才开始切负载，默认10s
+	Outlets   []string      `yaml:"outlets"`    // 按优先级排列的插座ID，排在前面的先被关闭
+	DryRun    bool          `yaml:"dry_run"`    // 只记录不执行
+	Cooldown  time.Duration `yaml:"cooldown"`   // 两次动作之间的最小间隔，默认30s
+	AuditFile string        `yaml:"audit_file"` // 审计记录文件，为空则只写日志
+}
+
+type APIConfig struct {
+	Listen       string        `yaml:"listen"`        // HTTP监听地址，例如:8080
+	ControlToken string        `yaml:"control_token"` // 控制接口需要在Authorization中携带的Bearer口令，为空时不开放控制接口
+	Health       *HealthConfig `yaml:"health"`
+}
+
+// HealthConfig /healthz和/readyz的判定阈值
+type HealthConfig struct {
+	StartupGrace     time.Duration `yaml:"startup_grace"`     // 启动后这段时间内不因没有数据判定为失败，默认1m
+	TelemetryTimeout time.Duration `yaml:"telemetry_timeout"` // 超过该时间没有收到数据则未就绪，默认3m
+	LivenessTimeout  time.Duration `yaml:"liveness_timeout"`  // 有组件在线但超过该时间没有收到数据则判定为卡死，默认10m
+}
+
+type SchedulerConfig struct {
+	StateFile string               `yaml:"state_file"` // 保存每个任务上次执行时间的文件
+	Timezone  string               `yaml:"timezone"`   // 默认时区，为空则使用本地时区
+	Jobs      []*ScheduleJobConfig `yaml:"jobs"`
+}
+
+type ScheduleJobConfig struct {
+	Name       string        `yaml:"name"`
+	Cron       string        `yaml:"cron"`     // 标准5段cron表达式
+	Timezone   string        `yaml:"timezone"` // 覆盖默认时区
+	NodeID     string        `yaml:"node_id"`
+	Outlets    []string      `yaml:"outlets"`     // 为空则作用于节点上全部插座
+	Action     string        `yaml:"action"`      // on, off, cycle
+	CycleDelay time.Duration `yaml:"cycle_delay"` // cycle时从关到开的间隔
+	MissedRun  string        `yaml:"missed_run"`  // 重启后错过的执行：skip->跳过，run_once->节点首次上报后补执行一次
+}
+
+// ScheduleJob 计划任务的运行状态
+type ScheduleJob struct {
+	Name     string    `json:"name"`
+	Cron     string    `json:"cron"`
+	Timezone string    `json:"timezone"`
+	NodeID   string    `json:"node_id"`
+	Outlets  []string  `json:"outlets"`
+	Action   string    `json:"action"`
+	LastRun  time.Time `json:"last_run,omitzero"`
+	NextRun  time.Time `json:"next_run,omitzero"`
+}
+
+type OutletGroupConfig struct {
+	Name        string               `yaml:"name"`
+	DisplayName string               `yaml:"display_name"`
+	StepDelay   time.Duration        `yaml:"step_delay"` // 每一步之后的默认等待时间
+	Members     []*OutletGroupMember `yaml:"members"`    // 开启时按顺序执行，关闭时按逆序执行
+}
+
+type OutletGroupMember struct {
+	NodeID  string        `yaml:"node_id" json:"node_id"`
+	Outlets []string      `yaml:"outlets" json:"outlets"`
+	Delay   time.Duration `yaml:"delay" json:"delay,omitempty"` // 覆盖step_delay
+}
+
+// OutletGroup 逻辑插座组的当前状态
+type OutletGroup struct {
+	Name        string               `json:"name"`
+	DisplayName string               `json:"display_name"`
+	On          bool                 `json:"on"`      // 全部成员插座都打开
+	Running     bool                 `json:"running"` // 正在执行开关序列
+	Members     []*OutletGroupMember `json:"members"`
+}
+
+type RestoreConfig struct {
+	Policy    string            `yaml:"policy"`     // restore_last, always_on, always_off, leave_as_is
+	Nodes     map[string]string `yaml:"nodes"`      // 按节点覆盖policy
+	StateFile string            `yaml:"state_file"` // 保存每个插座期望状态的文件
+	Settle    time.Duration     `yaml:"settle"`     // 节点上线后等待多久再比对，等待全部设备组上报
+	Stagger   time.Duration     `yaml:"stagger"`    // 相邻两条命令之间的间隔
+}
+
+type ProtectionConfig struct {
+	Protected  []*ProtectedOutletConfig `yaml:"protected"`
+	Interlocks []*InterlockConfig       `yaml:"interlocks"`
+}
+
+type ProtectedOutletConfig struct {
+	NodeID  string   `yaml:"node_id"`
+	Outlets []string `yaml:"outlets"`
+	Mode    string   `yaml:"mode"`  // reject->拒绝全部命令，confirm->命令需要携带token
+	Token   string   `yaml:"token"` // mode=confirm时的确认口令
+}
+
+type OutletRef struct {
+	NodeID string `yaml:"node_id" json:"node_id"`
+	ID     string `yaml:"id" json:"id"`
+}
+
+// InterlockConfig Outlet在Conflicts中任意一个插座打开时不能被打开
+type InterlockConfig struct {
+	Name      string       `yaml:"name"`
+	Outlet    OutletRef    `yaml:"outlet"`
+	Conflicts []*OutletRef `yaml:"conflicts"`
 }
 
 type DeviceType string
 
 var (
 	DeviceTypePDU DeviceType = "pdu"
+	DeviceTypeAC  DeviceType = "ac"
 )
 
 // PDUDevice PDU设备
 type PDUDevice struct {
-	NodeID    string  `json:"node_id"`
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	On        bool    `json:"on"`        // 开关是否打开
-	Voltage   float32 `json:"voltage"`   // 电压
-	Current   float32 `json:"current"`   // 电流
-	Power     float32 `json:"power"`     // 有功功率
-	Energy    float32 `json:"energy"`    // 总视在功率
-	Factor    float32 `json:"factor"`    // 功率因数
-	Frequency float32 `json:"frequency"` // 电网频率
+	NodeID    string   `json:"node_id"`
+	ID        string   `json:"id"`
+	GroupID   string   `json:"group_id"`
+	Name      string   `json:"name"`
+	On        bool     `json:"on"`        // 开关是否打开
+	Voltage   *float32 `json:"voltage"`   // 电压，nil表示没有读数
+	Current   *float32 `json:"current"`   // 电流
+	Power     *float32 `json:"power"`     // 有功功率
+	Energy    *float32 `json:"energy"`    // 总视在功率
+	Factor    *float32 `json:"factor"`    // 功率因数
+	Frequency *float32 `json:"frequency"` // 电网频率
+}
+
+// ACDevice 空调类设备组
+type ACDevice struct {
+	NodeID      string   `json:"node_id"`
+	ID          string   `json:"id"` // 设备组ID
+	Name        string   `json:"name"`
+	On          bool     `json:"on"`
+	Mode        string   `json:"mode"`        // 按HA climate的取值：off, auto, cool, dry, fan_only, heat
+	Setpoint    *float32 `json:"setpoint"`    // 设定温度
+	FanMode     string   `json:"fan_mode"`    // auto, low, medium, high
+	Temperature *float32 `json:"temperature"` // 当前温度，没有上报时为nil
+	Power       *float32 `json:"power"`
+}
+
+// ComponentStatus 采集器、发布器等组件的连接状态
+type ComponentStatus struct {
+	Name  string    `json:"name"`
+	State string    `json:"state"` // connecting, up, down
+	Error string    `json:"error,omitempty"`
+	Since time.Time `json:"since"` // 进入当前状态的时间
+}
+
+// PDUGroup PDU设备组
+type PDUGroup struct {
+	NodeID       string   `json:"node_id"`
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Voltage      *float32 `json:"voltage"`       // 电压，nil表示没有读数
+	TotalCurrent *float32 `json:"total_current"` // 总电流
+	Power        *float32 `json:"power"`         // 功率
+	Energy       *float32 `json:"energy"`        // 电量
+	Factor       *float32 `json:"factor"`        // 功率因数
+	Frequency    *float32 `json:"frequency"`     // 电网频率
+	Thresmask    int      `json:"thresmask"`     // PDU自身的阈值告警位
+	Alarms       []string `json:"alarms"`        // 由Thresmask解析出的告警名称
+}
+
+type AlarmState struct {
+	Key      string    `json:"key"`
+	Name     string    `json:"name"`
+	Scope    string    `json:"scope"`
+	NodeID   string    `json:"node_id"`
+	ID       string    `json:"id"`
+	Metric   string    `json:"metric,omitempty"`
+	Value    *float32  `json:"value,omitempty"`
+	Active   bool      `json:"active"`
+	Since    time.Time `json:"since"`
+	LastSeen time.Time `json:"-"`
+}
+
+// AuditRecord 网关自动执行的动作记录
+type AuditRecord struct {
+	Policy    string    `json:"policy"`
+	NodeID    string    `json:"node_id"`
+	GroupID   string    `json:"group_id,omitempty"`
+	DeviceID  string    `json:"device_id"`
+	Command   string    `json:"command"`
+	DryRun    bool      `json:"dry_run"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PDUDeviceInfo PDU设备信息
+type PDUDeviceInfo struct {
+	NodeID          string `json:"node_id"`
+	Model           string `json:"model"`
+	SerialNumber    string `json:"serial_number"`
+	HardwareVersion string `json:"hw_version"`
+	SoftwareVersion string `json:"sw_version"`
+	MAC             string `json:"mac"`
+}
+
+// PDUNetworkConfig PDU网络配置
+type PDUNetworkConfig struct {
+	NodeID  string `json:"node_id"`
+	DHCP    bool   `json:"dhcp"`
+	IP      string `json:"ip"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+	DNS     string `json:"dns"`
+}
+
+// PDUAlarm PDU主动上报的告警
+type PDUAlarm struct {
+	NodeID      string `json:"node_id"`
+	GroupID     string `json:"group_id"`
+	DeviceID    string `json:"device_id,omitempty"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Time        string `json:"time"`
+}
+
+// PDUThresholdSettings PDU设备组上配置的阈值，未上报或无法解析的阈值为null
+type PDUThresholdSettings struct {
+	NodeID     string   `json:"node_id"`
+	GroupID    string   `json:"group_id"`
+	VoltageMin *float32 `json:"voltage_min"`
+	VoltageMax *float32 `json:"voltage_max"`
+	CurrentMax *float32 `json:"current_max"`
+	PowerMax   *float32 `json:"power_max"`
+}
+
+// PDUEnergyReset 电量清零记录
+type PDUEnergyReset struct {
+	NodeID   string `json:"node_id"`
+	GroupID  string `json:"group_id"`
+	DeviceID string `json:"device_id,omitempty"`
+	Time     string `json:"time"`
+}
+
+// PDUControlResponse 插座控制命令的执行结果
+type PDUControlResponse struct {
+	NodeID   string `json:"node_id"`
+	DeviceID string `json:"device_id"`
+	Action   int    `json:"action"`
+	Success  bool   `json:"success"`
+}
+
+// UnknownMessage 未识别的消息ID及其载荷样本，用于逆向分析
+type UnknownMessage struct {
+	MessageID string    `json:"message_id"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Topics    []string  `json:"topics"`
+	Samples   []string  `json:"samples"`
 }
 
 type PDUDeviceState struct {
@@ -51,4 +502,36 @@ type Command struct {
 	DeviceID string
 	Type     string
 	Command  string
+	Token    string // 受保护插座的确认口令
+}
+
+type EventType string
+
+var (
+	EventTypeDeviceUpdated  EventType = "device_updated" // 每次上报都会产生，仅供内部订阅者使用
+	EventTypeOutletSwitched EventType = "outlet_switched"
+	EventTypeNodeOnline     EventType = "node_online"
+	EventTypeNodeOffline    EventType = "node_offline"
+	EventTypeNodeResumed    EventType = "node_resumed"  // 未超时离线，但上报中断超过平均间隔的3倍且不少于1分钟，通常是PDU重启
+	EventTypeGroupUpdated   EventType = "group_updated" // 每次上报都会产生，仅供内部订阅者使用
+	EventTypeAlarmRaised    EventType = "alarm_raised"
+	EventTypeAlarmCleared   EventType = "alarm_cleared"
+	EventTypeLoadShed       EventType = "load_shed"
+	EventTypePDUAlarm       EventType = "pdu_alarm"
+	EventTypeCommandResult  EventType = "command_result"
+)
+
+type Event struct {
+	Type      EventType    `json:"type"`
+	NodeID    string       `json:"node_id"`
+	DeviceID  string       `json:"device_id,omitempty"`
+	Old       *PDUDevice   `json:"old,omitempty"`
+	New       *PDUDevice   `json:"new,omitempty"`
+	Group     *PDUGroup    `json:"group,omitempty"`
+	Alarm     *AlarmState  `json:"alarm,omitempty"`
+	Audit     *AuditRecord `json:"audit,omitempty"`
+	Payload   any          `json:"payload,omitempty"` // 其它类型事件的附加数据
+	Metric    string       `json:"metric,omitempty"`
+	Value     *float32     `json:"value,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
 }
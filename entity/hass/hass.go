@@ -46,4 +46,17 @@ type Component struct {
 	PayloadOff string `json:"payload_off,omitempty"`
 	StateOn    string `json:"state_on,omitempty"`
 	StateOff   string `json:"state_off,omitempty"`
+
+	// climate 空调只上报状态，不提供命令主题
+	Modes                      []string `json:"modes,omitempty"`
+	FanModes                   []string `json:"fan_modes,omitempty"`
+	ModeStateTopic             string   `json:"mode_state_topic,omitempty"`
+	ModeStateTemplate          string   `json:"mode_state_template,omitempty"`
+	FanModeStateTopic          string   `json:"fan_mode_state_topic,omitempty"`
+	FanModeStateTemplate       string   `json:"fan_mode_state_template,omitempty"`
+	TemperatureStateTopic      string   `json:"temperature_state_topic,omitempty"`
+	TemperatureStateTemplate   string   `json:"temperature_state_template,omitempty"`
+	CurrentTemperatureTopic    string   `json:"current_temperature_topic,omitempty"`
+	CurrentTemperatureTemplate string   `json:"current_temperature_template,omitempty"`
+	TemperatureUnit            string   `json:"temperature_unit,omitempty"`
 }
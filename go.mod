@@ -4,10 +4,17 @@ go 1.25
 
 require (
 	github.com/eclipse/paho.golang v0.23.0
+	github.com/goburrow/modbus v0.1.0
 	github.com/goccy/go-yaml v1.18.0
+	github.com/gosnmp/gosnmp v1.38.0
+	github.com/mochi-mqtt/server/v2 v2.7.9
+	github.com/robfig/cron/v3 v3.0.1
 )
 
 require (
+	github.com/goburrow/serial v0.1.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/rs/xid v1.4.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
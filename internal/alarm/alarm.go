@@ -0,0 +1,298 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+const (
+	ScopeOutlet = "outlet"
+	ScopeGroup  = "group"
+
+	// pduAlarmPrefix PDU自身Thresmask告警的名称前缀，与配置的告警区分
+	pduAlarmPrefix = "pdu_"
+)
+
+var (
+	lock    sync.RWMutex
+	rules   []*entity.AlarmConfig
+	states  map[string]map[string]*entity.AlarmState
+	pending map[string]time.Time
+	events  chan *entity.Event
+
+	alarmNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+func Init(ctx context.Context, configs []*entity.AlarmConfig) error {
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if err := ValidateConfig(config); err != nil {
+			return fmt.Errorf("alarm: alarms[%v].%v", i, err)
+		}
+		if names[config.Name] {
+			return fmt.Errorf("alarm: alarms[%v].name %q is duplicated", i, config.Name)
+		}
+		names[config.Name] = true
+	}
+
+	rules = configs
+	states = make(map[string]map[string]*entity.AlarmState)
+	pending = make(map[string]time.Time)
+	events = event.Subscribe("alarm", 1024)
+	go run(ctx)
+	return nil
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于单条告警配置
+func ValidateConfig(config *entity.AlarmConfig) error {
+	if !alarmNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("name %q must match %v", config.Name, alarmNamePattern)
+	}
+	if strings.HasPrefix(config.Name, pduAlarmPrefix) {
+		return fmt.Errorf("name %q must not start with %v, it is reserved for pdu alarms", config.Name, pduAlarmPrefix)
+	}
+	if config.Scope != ScopeOutlet && config.Scope != ScopeGroup {
+		return fmt.Errorf("scope %q must be %v or %v", config.Scope, ScopeOutlet, ScopeGroup)
+	}
+	if config.Metric != "voltage" && config.Metric != "current" && config.Metric != "power" {
+		return fmt.Errorf("metric %q must be voltage, current or power", config.Metric)
+	}
+	if config.Min == nil && config.Max == nil {
+		return fmt.Errorf("min or max is required")
+	}
+	return nil
+}
+
+// GetNodeAlarms 返回节点上所有已评估过的告警，包括未触发的
+func GetNodeAlarms(_ context.Context, nodeId string) []*entity.AlarmState {
+	lock.RLock()
+	defer lock.RUnlock()
+	result := make([]*entity.AlarmState, 0, len(states[nodeId]))
+	for _, state := range states[nodeId] {
+		stateCopy := *state
+		result = append(result, &stateCopy)
+	}
+	return result
+}
+
+func run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			event.Unsubscribe(events)
+			return
+		case e := <-events:
+			switch e.Type {
+			case entity.EventTypeDeviceUpdated:
+				if e.New != nil {
+					evaluateOutlet(ctx, e.New)
+				}
+			case entity.EventTypeGroupUpdated:
+				if e.Group != nil {
+					evaluateGroup(ctx, e.Group)
+				}
+			}
+		}
+	}
+}
+
+func evaluateOutlet(ctx context.Context, device *entity.PDUDevice) {
+	now := time.Now()
+	raised := make([]*entity.AlarmState, 0)
+	cleared := make([]*entity.AlarmState, 0)
+
+	lock.Lock()
+	for _, rule := range rules {
+		if rule.Scope != ScopeOutlet || !matches(rule, device.NodeID, device.ID) {
+			continue
+		}
+		var value *float32
+		switch rule.Metric {
+		case "voltage":
+			value = device.Voltage
+		case "current":
+			value = device.Current
+		case "power":
+			value = device.Power
+		}
+		if value == nil {
+			// 没有读数时保持告警原状态
+			continue
+		}
+		evaluate(rule, device.NodeID, device.ID, *value, now, &raised, &cleared)
+	}
+	lock.Unlock()
+
+	publish(ctx, raised, cleared)
+}
+
+func evaluateGroup(ctx context.Context, group *entity.PDUGroup) {
+	now := time.Now()
+	raised := make([]*entity.AlarmState, 0)
+	cleared := make([]*entity.AlarmState, 0)
+
+	lock.Lock()
+	for _, rule := range rules {
+		if rule.Scope != ScopeGroup || !matches(rule, group.NodeID, group.ID) {
+			continue
+		}
+		var value *float32
+		switch rule.Metric {
+		case "voltage":
+			value = group.Voltage
+		case "current":
+			value = group.TotalCurrent
+		case "power":
+			value = group.Power
+		}
+		if value == nil {
+			continue
+		}
+		evaluate(rule, group.NodeID, group.ID, *value, now, &raised, &cleared)
+	}
+	evaluateThresmask(group, now, &raised, &cleared)
+	lock.Unlock()
+
+	publish(ctx, raised, cleared)
+}
+
+func matches(rule *entity.AlarmConfig, nodeId string, id string) bool {
+	return (rule.NodeID == "" || rule.NodeID == nodeId) && (rule.ID == "" || rule.ID == id)
+}
+
+func getState(nodeId string, key string, create func() *entity.AlarmState) *entity.AlarmState {
+	nodeStates, ok := states[nodeId]
+	if !ok {
+		nodeStates = make(map[string]*entity.AlarmState)
+		states[nodeId] = nodeStates
+	}
+	state, ok := nodeStates[key]
+	if !ok {
+		state = create()
+		nodeStates[key] = state
+	}
+	return state
+}
+
+func evaluate(rule *entity.AlarmConfig, nodeId string, id string, value float32, now time.Time,
+	raised *[]*entity.AlarmState, cleared *[]*entity.AlarmState) {
+	key := fmt.Sprintf("alarm_%v_%v_%v", rule.Scope, id, rule.Name)
+	state := getState(nodeId, key, func() *entity.AlarmState {
+		return &entity.AlarmState{
+			Key:    key,
+			Name:   rule.Name,
+			Scope:  rule.Scope,
+			NodeID: nodeId,
+			ID:     id,
+			Metric: rule.Metric,
+			Since:  now,
+		}
+	})
+	state.Value = &value
+	state.LastSeen = now
+
+	pendingKey := nodeId + "/" + key
+	if !state.Active {
+		breached := (rule.Min != nil && value < *rule.Min) || (rule.Max != nil && value > *rule.Max)
+		if !breached {
+			delete(pending, pendingKey)
+			return
+		}
+		since, ok := pending[pendingKey]
+		if !ok {
+			since = now
+			pending[pendingKey] = now
+		}
+		if now.Sub(since) < rule.Duration {
+			return
+		}
+		delete(pending, pendingKey)
+		state.Active = true
+		state.Since = now
+		stateCopy := *state
+		*raised = append(*raised, &stateCopy)
+		return
+	}
+
+	restored := (rule.Min == nil || value >= *rule.Min+rule.Hysteresis) &&
+		(rule.Max == nil || value <= *rule.Max-rule.Hysteresis)
+	if restored {
+		state.Active = false
+		state.Since = now
+		stateCopy := *state
+		*cleared = append(*cleared, &stateCopy)
+	}
+}
+
+// evaluateThresmask 把PDU自身上报的告警位同步为告警状态，不做迟滞和延时处理
+func evaluateThresmask(group *entity.PDUGroup, now time.Time,
+	raised *[]*entity.AlarmState, cleared *[]*entity.AlarmState) {
+	active := make(map[string]bool, len(group.Alarms))
+	for _, name := range group.Alarms {
+		key := fmt.Sprintf("alarm_%v_%v_%v%v", ScopeGroup, group.ID, pduAlarmPrefix, name)
+		active[key] = true
+		state := getState(group.NodeID, key, func() *entity.AlarmState {
+			return &entity.AlarmState{
+				Key:    key,
+				Name:   pduAlarmPrefix + name,
+				Scope:  ScopeGroup,
+				NodeID: group.NodeID,
+				ID:     group.ID,
+			}
+		})
+		state.LastSeen = now
+		if !state.Active {
+			state.Active = true
+			state.Since = now
+			stateCopy := *state
+			*raised = append(*raised, &stateCopy)
+		}
+	}
+
+	prefix := fmt.Sprintf("alarm_%v_%v_%v", ScopeGroup, group.ID, pduAlarmPrefix)
+	for key, state := range states[group.NodeID] {
+		if !strings.HasPrefix(key, prefix) || active[key] {
+			continue
+		}
+		state.LastSeen = now
+		if state.Active {
+			state.Active = false
+			state.Since = now
+			stateCopy := *state
+			*cleared = append(*cleared, &stateCopy)
+		}
+	}
+}
+
+func publish(ctx context.Context, raised []*entity.AlarmState, cleared []*entity.AlarmState) {
+	for _, state := range raised {
+		slog.Warn("Alarm: raised", "nodeId", state.NodeID, "key", state.Key, "metric", state.Metric)
+		event.Publish(ctx, &entity.Event{
+			Type:     entity.EventTypeAlarmRaised,
+			NodeID:   state.NodeID,
+			DeviceID: state.ID,
+			Alarm:    state,
+			Metric:   state.Metric,
+			Value:    state.Value,
+		})
+	}
+	for _, state := range cleared {
+		slog.Info("Alarm: cleared", "nodeId", state.NodeID, "key", state.Key, "metric", state.Metric)
+		event.Publish(ctx, &entity.Event{
+			Type:     entity.EventTypeAlarmCleared,
+			NodeID:   state.NodeID,
+			DeviceID: state.ID,
+			Alarm:    state,
+			Metric:   state.Metric,
+			Value:    state.Value,
+		})
+	}
+}
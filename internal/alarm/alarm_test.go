@@ -0,0 +1,110 @@
+package alarm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestEvaluate(t *testing.T) {
+	ten, two := float32(10), float32(2)
+	type step struct {
+		after  time.Duration // 相对第一次读数的时间
+		value  float32
+		active bool
+	}
+	tests := []struct {
+		name  string
+		rule  *entity.AlarmConfig
+		steps []step
+	}{
+		{"max", &entity.AlarmConfig{Name: "max", Scope: ScopeOutlet, Metric: "current", Max: &ten}, []step{
+			{0, 9, false}, {time.Second, 10, false}, {2 * time.Second, 10.5, true}, {3 * time.Second, 9.9, false},
+		}},
+		{"min", &entity.AlarmConfig{Name: "min", Scope: ScopeOutlet, Metric: "voltage", Min: &two}, []step{
+			{0, 1, true}, {time.Second, 2, false},
+		}},
+		{"hysteresis", &entity.AlarmConfig{Name: "hysteresis", Scope: ScopeOutlet, Metric: "current", Max: &ten, Hysteresis: 1}, []step{
+			{0, 11, true}, {time.Second, 9.5, true}, {2 * time.Second, 10.5, true}, {3 * time.Second, 9, false}, {4 * time.Second, 9.5, false},
+		}},
+		{"min hysteresis", &entity.AlarmConfig{Name: "min_hysteresis", Scope: ScopeGroup, Metric: "voltage", Min: &two, Max: &ten, Hysteresis: 0.5}, []step{
+			{0, 1, true}, {time.Second, 2.2, true}, {2 * time.Second, 2.5, false},
+		}},
+		{"duration", &entity.AlarmConfig{Name: "duration", Scope: ScopeOutlet, Metric: "power", Max: &ten, Duration: 10 * time.Second}, []step{
+			{0, 11, false}, {5 * time.Second, 12, false}, {10 * time.Second, 11, true},
+		}},
+		{"duration reset", &entity.AlarmConfig{Name: "duration_reset", Scope: ScopeOutlet, Metric: "power", Max: &ten, Duration: 10 * time.Second}, []step{
+			{0, 11, false}, {5 * time.Second, 9, false}, {10 * time.Second, 11, false}, {19 * time.Second, 11, false}, {20 * time.Second, 11, true},
+		}},
+	}
+	start := time.Now()
+	for _, tt := range tests {
+		states = make(map[string]map[string]*entity.AlarmState)
+		pending = make(map[string]time.Time)
+		active := false
+		for i, step := range tt.steps {
+			var raised, cleared []*entity.AlarmState
+			evaluate(tt.rule, "node", "1", step.value, start.Add(step.after), &raised, &cleared)
+			state := states["node"]["alarm_"+tt.rule.Scope+"_1_"+tt.rule.Name]
+			if state == nil || state.Active != step.active || *state.Value != step.value {
+				t.Fatalf("%v: step %v got %+v, want active %v", tt.name, i, state, step.active)
+			}
+			// 只有状态变化时才产生事件
+			wantRaised, wantCleared := step.active && !active, !step.active && active
+			if (len(raised) == 1) != wantRaised || (len(cleared) == 1) != wantCleared || len(raised)+len(cleared) > 1 {
+				t.Errorf("%v: step %v got raised %v cleared %v", tt.name, i, len(raised), len(cleared))
+			}
+			active = step.active
+		}
+	}
+}
+
+func TestEvaluateThresmask(t *testing.T) {
+	states = make(map[string]map[string]*entity.AlarmState)
+	tests := []struct {
+		alarms      []string
+		wantRaised  int
+		wantCleared int
+		wantActive  int
+	}{
+		{[]string{"bit0"}, 1, 0, 1},
+		{[]string{"bit0", "bit2"}, 1, 0, 2},
+		{[]string{"bit2"}, 0, 1, 1},
+		{nil, 0, 1, 0},
+	}
+	for i, tt := range tests {
+		var raised, cleared []*entity.AlarmState
+		evaluateThresmask(&entity.PDUGroup{NodeID: "node", ID: "1", Alarms: tt.alarms}, time.Now(), &raised, &cleared)
+		active := 0
+		for _, state := range states["node"] {
+			if state.Active {
+				active++
+			}
+		}
+		if len(raised) != tt.wantRaised || len(cleared) != tt.wantCleared || active != tt.wantActive {
+			t.Errorf("%v %v: got raised %v cleared %v active %v", i, tt.alarms, len(raised), len(cleared), active)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	ten := float32(10)
+	tests := []struct {
+		config  *entity.AlarmConfig
+		wantErr string
+	}{
+		{&entity.AlarmConfig{Name: "ok", Scope: ScopeGroup, Metric: "power", Max: &ten}, ""},
+		{&entity.AlarmConfig{Name: "Bad", Scope: ScopeGroup, Metric: "power", Max: &ten}, `name "Bad" must match ^[a-z0-9_]+$`},
+		{&entity.AlarmConfig{Name: "pdu_bit0", Scope: ScopeGroup, Metric: "power", Max: &ten}, `name "pdu_bit0" must not start with pdu_, it is reserved for pdu alarms`},
+		{&entity.AlarmConfig{Name: "ok", Scope: "node", Metric: "power", Max: &ten}, `scope "node" must be outlet or group`},
+		{&entity.AlarmConfig{Name: "ok", Scope: ScopeOutlet, Metric: "energy", Max: &ten}, `metric "energy" must be voltage, current or power`},
+		{&entity.AlarmConfig{Name: "ok", Scope: ScopeOutlet, Metric: "current"}, "min or max is required"},
+	}
+	for _, tt := range tests {
+		err := ValidateConfig(tt.config)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%+v: got error %v, want %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/outletgroup"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/scheduler"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+var (
+	server *http.Server
+)
+
+func Init(_ context.Context, config *entity.APIConfig) error {
+	if config == nil || config.Listen == "" {
+		return nil
+	}
+
+	initHealth(config.Health)
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return fmt.Errorf("api: listen on %v failed, %v", config.Listen, err)
+	}
+	server = &http.Server{
+		Handler:           newMux(config),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("API: serve failed", "err", err)
+		}
+	}()
+	slog.Info("API: initialized", "listen", config.Listen)
+	return nil
+}
+
+// newMux 未配置control_token时不注册控制接口
+func newMux(config *entity.APIConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	mux.HandleFunc("GET /api/schedules", listSchedulesHandler)
+	mux.HandleFunc("GET /api/outlet-groups", listOutletGroupsHandler)
+	if config.ControlToken != "" {
+		mux.HandleFunc("POST /api/outlet-groups/{name}/{command}", requireControlToken(config.ControlToken, outletGroupCommandHandler))
+		mux.HandleFunc("POST /api/nodes/{node}/outlets/{outlet}/{command}", requireControlToken(config.ControlToken, outletCommandHandler))
+	} else {
+		slog.Warn("API: control routes are disabled, control_token is not configured")
+	}
+	mux.HandleFunc("GET /api/nodes/{node}/info", nodeInfoHandler)
+	mux.HandleFunc("GET /api/unknown-messages", listUnknownMessagesHandler)
+	mux.HandleFunc("GET /api/status", listStatusHandler)
+	return mux
+}
+
+func Stop(ctx context.Context) {
+	if server == nil {
+		return
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("API: shutdown failed", "err", err)
+	}
+	slog.Info("API: stopped")
+}
+
+const (
+	confirmTokenHeader = "X-Confirm-Token"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("API: write response failed", "err", err)
+	}
+}
+
+// requireControlToken 控制接口要求请求携带Authorization: Bearer {control_token}
+func requireControlToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid control token"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, scheduler.GetJobs(r.Context()))
+}
+
+func listStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, status.GetAll())
+}
+
+func listOutletGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, outletgroup.GetGroups(r.Context()))
+}
+
+// outletGroupCommandHandler command为on或off，序列在后台执行，立即返回202
+func outletGroupCommandHandler(w http.ResponseWriter, r *http.Request) {
+	command := strings.ToUpper(r.PathValue("command"))
+	if err := outletgroup.SendCommand(r.Context(), r.PathValue("name"), command); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// outletCommandHandler command为on或off，受保护插座需要在X-Confirm-Token中携带确认口令
+func outletCommandHandler(w http.ResponseWriter, r *http.Request) {
+	command := strings.ToUpper(r.PathValue("command"))
+	if command != "ON" && command != "OFF" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("unknown command %q", command)})
+		return
+	}
+
+	err := collector.SendCommand(r.Context(), &entity.Command{
+		NodeID:   r.PathValue("node"),
+		DeviceID: r.PathValue("outlet"),
+		Type:     "switch",
+		Command:  command,
+		Token:    r.Header.Get(confirmTokenHeader),
+	})
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, struct{}{})
+	case errors.Is(err, collector.ErrProtected), errors.Is(err, collector.ErrConfirmationRequired):
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+	case errors.Is(err, collector.ErrInterlocked):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+	}
+}
+
+func nodeInfoHandler(w http.ResponseWriter, r *http.Request) {
+	info := database.GetNodeInfo(r.Context(), r.PathValue("node"))
+	if info == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "node not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func listUnknownMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collector.GetUnknownMessages(r.Context()))
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestControlToken(t *testing.T) {
+	const groupPath, outletPath = "/api/outlet-groups/missing/on", "/api/nodes/node/outlets/1/toggle"
+	tests := []struct {
+		name          string
+		path          string
+		controlToken  string
+		authorization string
+		wantStatus    int
+	}{
+		{"disabled", groupPath, "", "", http.StatusNotFound},
+		{"disabled with token", groupPath, "", "Bearer secret", http.StatusNotFound},
+		{"missing token", groupPath, "secret", "", http.StatusUnauthorized},
+		{"wrong token", groupPath, "secret", "Bearer other", http.StatusUnauthorized},
+		{"wrong scheme", groupPath, "secret", "Basic secret", http.StatusUnauthorized},
+		// 通过认证后由处理函数返回插座组不存在
+		{"valid token", groupPath, "secret", "Bearer secret", http.StatusBadRequest},
+		{"outlet disabled", outletPath, "", "", http.StatusNotFound},
+		{"outlet missing token", outletPath, "secret", "", http.StatusUnauthorized},
+		{"outlet wrong token", outletPath, "secret", "Bearer other", http.StatusUnauthorized},
+		// 通过认证后由处理函数拒绝未知命令
+		{"outlet valid token", outletPath, "secret", "Bearer secret", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		mux := newMux(&entity.APIConfig{Listen: ":0", ControlToken: tt.controlToken})
+		request := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		if tt.authorization != "" {
+			request.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("%v: got %v, want %v, %v", tt.name, recorder.Code, tt.wantStatus, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+const (
+	defaultStartupGrace     = time.Minute
+	defaultTelemetryTimeout = 3 * time.Minute
+	defaultLivenessTimeout  = 10 * time.Minute
+)
+
+var (
+	healthConfig entity.HealthConfig
+	startedAt    time.Time
+)
+
+type healthResponse struct {
+	Status     string                    `json:"status"` // ok, fail
+	Reasons    []string                  `json:"reasons,omitempty"`
+	Uptime     float64                   `json:"uptime_seconds"`
+	Components []*entity.ComponentStatus `json:"components"`
+	Telemetry  telemetryHealth           `json:"telemetry"`
+	Database   databaseHealth            `json:"database"`
+}
+
+type telemetryHealth struct {
+	LastUpdate *time.Time `json:"last_update"` // 尚未收到任何数据时为null
+	Age        *float64   `json:"age_seconds"`
+}
+
+type databaseHealth struct {
+	Nodes        int      `json:"nodes"`
+	OfflineNodes []string `json:"offline_nodes"`
+}
+
+func initHealth(config *entity.HealthConfig) {
+	if config != nil {
+		healthConfig = *config
+	}
+	if healthConfig.StartupGrace <= 0 {
+		healthConfig.StartupGrace = defaultStartupGrace
+	}
+	if healthConfig.TelemetryTimeout <= 0 {
+		healthConfig.TelemetryTimeout = defaultTelemetryTimeout
+	}
+	if healthConfig.LivenessTimeout <= 0 {
+		healthConfig.LivenessTimeout = defaultLivenessTimeout
+	}
+	startedAt = time.Now()
+}
+
+// healthzHandler 有组件在线却长时间收不到数据时判定为卡死，需要重启；所有组件都断开时重启也无济于事，交给自动重连
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	response, now := newHealthResponse(r)
+	if now.Sub(startedAt) > healthConfig.StartupGrace && anyComponentUp(response.Components) &&
+		telemetryStale(response.Telemetry, healthConfig.LivenessTimeout, now) {
+		response.Reasons = append(response.Reasons,
+			fmt.Sprintf("components are up but no telemetry received for %v", healthConfig.LivenessTimeout))
+	}
+	writeHealth(w, response)
+}
+
+// readyzHandler 所有组件都已连接、最近收到过数据且至少有一个节点在线时才就绪
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	response, now := newHealthResponse(r)
+	for _, component := range response.Components {
+		if component.State != status.StateUp {
+			response.Reasons = append(response.Reasons, fmt.Sprintf("component %v is %v", component.Name, component.State))
+		}
+	}
+	if now.Sub(startedAt) > healthConfig.StartupGrace || response.Telemetry.LastUpdate != nil {
+		if telemetryStale(response.Telemetry, healthConfig.TelemetryTimeout, now) {
+			response.Reasons = append(response.Reasons,
+				fmt.Sprintf("no telemetry received for %v", healthConfig.TelemetryTimeout))
+		}
+	} else {
+		response.Reasons = append(response.Reasons, "waiting for first telemetry")
+	}
+	if response.Database.Nodes > 0 && len(response.Database.OfflineNodes) == response.Database.Nodes {
+		response.Reasons = append(response.Reasons, "all nodes are offline")
+	}
+	writeHealth(w, response)
+}
+
+func newHealthResponse(r *http.Request) (*healthResponse, time.Time) {
+	now := time.Now()
+	lastUpdate, nodes, offlineNodes := database.GetFreshness(r.Context())
+	response := &healthResponse{
+		Uptime:     now.Sub(startedAt).Seconds(),
+		Components: status.GetAll(),
+		Database:   databaseHealth{Nodes: nodes, OfflineNodes: offlineNodes},
+	}
+	if !lastUpdate.IsZero() {
+		age := now.Sub(lastUpdate).Seconds()
+		response.Telemetry = telemetryHealth{LastUpdate: &lastUpdate, Age: &age}
+	}
+	return response, now
+}
+
+func anyComponentUp(components []*entity.ComponentStatus) bool {
+	for _, component := range components {
+		if component.State == status.StateUp {
+			return true
+		}
+	}
+	return false
+}
+
+func telemetryStale(telemetry telemetryHealth, timeout time.Duration, now time.Time) bool {
+	if telemetry.LastUpdate == nil {
+		return now.Sub(startedAt) > timeout
+	}
+	return now.Sub(*telemetry.LastUpdate) > timeout
+}
+
+func writeHealth(w http.ResponseWriter, response *healthResponse) {
+	if len(response.Reasons) == 0 {
+		response.Status = "ok"
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	response.Status = "fail"
+	writeJSON(w, http.StatusServiceUnavailable, response)
+}
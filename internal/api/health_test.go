@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		uptime     time.Duration
+		component  string // 为空时没有组件
+		telemetry  bool
+		wantHealth int
+		wantReady  int
+	}{
+		{"starting", time.Second, status.StateConnecting, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"up without telemetry in grace", time.Second, status.StateUp, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"up with telemetry in grace", time.Second, status.StateUp, true, http.StatusOK, http.StatusOK},
+		{"up without telemetry after grace", 5 * time.Minute, status.StateUp, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"stuck", 20 * time.Minute, status.StateUp, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"disconnected", 20 * time.Minute, status.StateDown, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"down with telemetry", 20 * time.Minute, status.StateDown, true, http.StatusOK, http.StatusServiceUnavailable},
+		{"healthy", 20 * time.Minute, status.StateUp, true, http.StatusOK, http.StatusOK},
+		{"no components", 20 * time.Minute, "", false, http.StatusOK, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		database.Init(ctx)
+		initHealth(&entity.HealthConfig{StartupGrace: time.Minute, TelemetryTimeout: 3 * time.Minute, LivenessTimeout: 10 * time.Minute})
+		startedAt = time.Now().Add(-tt.uptime)
+		if tt.component != "" {
+			status.Set("collector", tt.component, nil)
+		}
+		if tt.telemetry {
+			database.SetPUDDevice(ctx, "node", "1", &entity.PDUDevice{NodeID: "node", ID: "1"})
+		}
+
+		if got := serveHealth(t, healthzHandler); got.Code != tt.wantHealth {
+			t.Errorf("%v: healthz got %v, want %v, %v", tt.name, got.Code, tt.wantHealth, got.Body)
+		}
+		if got := serveHealth(t, readyzHandler); got.Code != tt.wantReady {
+			t.Errorf("%v: readyz got %v, want %v, %v", tt.name, got.Code, tt.wantReady, got.Body)
+		}
+		status.Remove("collector")
+		cancel()
+	}
+}
+
+// TestReadyzComponentDown 任一组件断开时不就绪，其它组件在线且有数据时仍然存活
+func TestReadyzComponentDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	initHealth(&entity.HealthConfig{StartupGrace: time.Minute, TelemetryTimeout: 3 * time.Minute, LivenessTimeout: 10 * time.Minute})
+	startedAt = time.Now().Add(-20 * time.Minute)
+	status.Set("collector", status.StateUp, nil)
+	status.Set("publisher", status.StateDown, errors.New("connection refused"))
+	defer status.Remove("collector")
+	defer status.Remove("publisher")
+	database.SetPUDDevice(ctx, "node", "1", &entity.PDUDevice{NodeID: "node", ID: "1"})
+
+	if got := serveHealth(t, healthzHandler); got.Code != http.StatusOK {
+		t.Errorf("healthz got %v, %v", got.Code, got.Body)
+	}
+	got := serveHealth(t, readyzHandler)
+	var response healthResponse
+	if err := json.Unmarshal(got.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != http.StatusServiceUnavailable || !slices.Equal(response.Reasons, []string{"component publisher is down"}) {
+		t.Errorf("readyz got %v, %v", got.Code, got.Body)
+	}
+	if len(response.Components) != 2 || response.Components[1].Error != "connection refused" {
+		t.Errorf("readyz components got %+v", response.Components)
+	}
+
+	status.Set("publisher", status.StateUp, nil)
+	if got := serveHealth(t, readyzHandler); got.Code != http.StatusOK {
+		t.Errorf("readyz after recovery got %v, %v", got.Code, got.Body)
+	}
+}
+
+func TestHealthDefaults(t *testing.T) {
+	initHealth(&entity.HealthConfig{TelemetryTimeout: time.Minute})
+	if healthConfig.StartupGrace != defaultStartupGrace || healthConfig.TelemetryTimeout != time.Minute ||
+		healthConfig.LivenessTimeout != defaultLivenessTimeout {
+		t.Errorf("got %+v", healthConfig)
+	}
+}
+
+func serveHealth(t *testing.T, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	var response healthResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %v", recorder.Body)
+	}
+	if (recorder.Code == http.StatusOK) != (response.Status == "ok" && len(response.Reasons) == 0) {
+		t.Errorf("status code %v does not match body %v", recorder.Code, recorder.Body)
+	}
+	return recorder
+}
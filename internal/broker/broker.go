@@ -0,0 +1,269 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/mqttclient"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	defaultListen    = ":1883"
+	bridgeQueueSize  = 1024
+	bridgeStatusName = "broker.bridge"
+	// controlTopicLevel 上游发往in方向的消息会绕过网关的插座保护和互锁，桥接时一律丢弃
+	controlTopicLevel = "in"
+)
+
+var (
+	lock           sync.Mutex
+	server         *mqtt.Server
+	bridge         *autopaho.ConnectionManager
+	subscriptionId int
+)
+
+// Init 未配置时不启动内置broker
+func Init(ctx context.Context, config *entity.BrokerConfig) error {
+	if config == nil {
+		return nil
+	}
+	if err := ValidateConfig(config); err != nil {
+		return fmt.Errorf("broker: %v", err)
+	}
+
+	listen := config.Listen
+	if listen == "" {
+		listen = defaultListen
+	}
+	server = mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.Default(),
+	})
+	if config.AllowAnonymous {
+		// 匿名客户端可以发布in方向的控制主题，绕过网关的插座保护和互锁
+		slog.Warn("Broker: anonymous access is enabled, any client that can reach the listener can control outlets",
+			"listen", listen, "websocket", config.WebsocketListen)
+		if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+			return fmt.Errorf("broker: add auth hook failed, %v", err)
+		}
+	} else {
+		users := make(auth.Users, len(config.Users))
+		for _, user := range config.Users {
+			users[user.Username] = auth.UserRule{
+				Username: auth.RString(user.Username),
+				Password: auth.RString(user.Password),
+			}
+		}
+		if err := server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{Users: users}}); err != nil {
+			return fmt.Errorf("broker: add auth hook failed, %v", err)
+		}
+	}
+
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: listen})); err != nil {
+		return fmt.Errorf("broker: add tcp listener failed, %v", err)
+	}
+	if config.WebsocketListen != "" {
+		if err := server.AddListener(listeners.NewWebsocket(listeners.Config{ID: "ws", Address: config.WebsocketListen})); err != nil {
+			return fmt.Errorf("broker: add websocket listener failed, %v", err)
+		}
+	}
+	if err := server.Serve(); err != nil {
+		return fmt.Errorf("broker: serve failed, %v", err)
+	}
+	slog.Info("Broker: initialized", "listen", listen, "websocket", config.WebsocketListen)
+
+	if config.Bridge != nil {
+		if err := initBridge(ctx, config.Bridge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于broker配置
+func ValidateConfig(config *entity.BrokerConfig) error {
+	if len(config.Users) == 0 && !config.AllowAnonymous {
+		return fmt.Errorf("users is required, or set allow_anonymous to true explicitly")
+	}
+	if len(config.Users) > 0 && config.AllowAnonymous {
+		return fmt.Errorf("allow_anonymous can not be used together with users")
+	}
+	for i, user := range config.Users {
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("users[%v] needs username and password", i)
+		}
+	}
+	if config.Bridge != nil {
+		if config.Bridge.MQTT == nil {
+			return fmt.Errorf("bridge.mqtt is required")
+		}
+		if err := mqttclient.Validate(config.Bridge.MQTT); err != nil {
+			return fmt.Errorf("bridge.mqtt.%v", err)
+		}
+		for i, filter := range config.Bridge.In {
+			levels := strings.Split(filter, "/")
+			if len(levels) >= 2 && levels[len(levels)-2] == controlTopicLevel {
+				return fmt.Errorf("bridge.in[%v] %q matches yespeed control topics, commands must go through the gateway", i, filter)
+			}
+		}
+	}
+	return nil
+}
+
+// isControlTopic Yespeed的控制主题为{topic_prefix}/{vendor}/{节点ID}/in/{消息ID}
+func isControlTopic(topic string) bool {
+	levels := strings.Split(topic, "/")
+	return len(levels) >= 4 && levels[len(levels)-2] == controlTopicLevel
+}
+
+func Stop(ctx context.Context) {
+	if bridge != nil {
+		bridge.Done()
+		status.Remove(bridgeStatusName)
+	}
+	if server != nil {
+		_ = server.Close()
+		slog.Info("Broker: stopped")
+	}
+}
+
+// Enabled 内置broker是否已启动
+func Enabled() bool {
+	return server != nil
+}
+
+// Publish 以进程内客户端的身份发布消息
+func Publish(topic string, payload []byte, retain bool, qos byte) error {
+	if server == nil {
+		return fmt.Errorf("broker: embedded broker is not enabled")
+	}
+	return server.Publish(topic, payload, retain, qos)
+}
+
+// Subscribe 进程内订阅，handler在broker的分发流程中同步调用，不应阻塞
+func Subscribe(filter string, handler func(topic string, payload []byte)) (int, error) {
+	if server == nil {
+		return 0, fmt.Errorf("broker: embedded broker is not enabled")
+	}
+	id := nextSubscriptionId()
+	err := server.Subscribe(filter, id, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		handler(pk.TopicName, pk.Payload)
+	})
+	return id, err
+}
+
+func nextSubscriptionId() int {
+	lock.Lock()
+	defer lock.Unlock()
+	subscriptionId++
+	return subscriptionId
+}
+
+func Unsubscribe(filter string, id int) {
+	if server != nil {
+		_ = server.Unsubscribe(filter, id)
+	}
+}
+
+// initBridge out方向只转发真实客户端发布的消息，in方向以进程内客户端发布，两者不会互相回环
+func initBridge(ctx context.Context, config *entity.BridgeConfig) error {
+	subscriptions := make([]paho.SubscribeOptions, 0, len(config.In))
+	for _, filter := range config.In {
+		subscriptions = append(subscriptions, paho.SubscribeOptions{Topic: filter, QoS: mqttclient.SubscribeQoS(config.MQTT), NoLocal: true})
+	}
+	clientConfig := autopaho.ClientConfig{
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connAck *paho.Connack) {
+			slog.Info("Broker: bridge connected to upstream")
+			status.Set(bridgeStatusName, status.StateUp, nil)
+			if len(subscriptions) == 0 {
+				return
+			}
+			if _, err := connectionManager.Subscribe(context.Background(), &paho.Subscribe{Subscriptions: subscriptions}); err != nil {
+				slog.Error("Broker: bridge subscribe failed", "err", err)
+			}
+		},
+		OnConnectError: func(err error) {
+			slog.Error("Broker: bridge connect failed", "err", err)
+			status.Set(bridgeStatusName, status.StateDown, err)
+		},
+		OnConnectionDown: func() bool {
+			slog.Warn("Broker: bridge connection down, reconnecting")
+			status.Set(bridgeStatusName, status.StateDown, nil)
+			return true
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: config.MQTT.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(publishReceived paho.PublishReceived) (bool, error) {
+					packet := publishReceived.Packet
+					if isControlTopic(packet.Topic) {
+						slog.Warn("Broker: bridge dropped upstream control message", "topic", packet.Topic)
+						return true, nil
+					}
+					if err := server.Publish(packet.Topic, packet.Payload, packet.Retain, packet.QoS); err != nil {
+						slog.Error("Broker: bridge forward in failed", "topic", packet.Topic, "err", err)
+					}
+					return true, nil
+				}},
+			OnClientError: func(err error) {
+				slog.Info("Broker: bridge client error", "err", err)
+			},
+		},
+	}
+	if err := mqttclient.Configure(&clientConfig, config.MQTT); err != nil {
+		return fmt.Errorf("broker: bridge %v", err)
+	}
+	var err error
+	status.Set(bridgeStatusName, status.StateConnecting, nil)
+	if bridge, err = autopaho.NewConnection(ctx, clientConfig); err != nil {
+		return fmt.Errorf("broker: bridge NewConnection failed, %v", err)
+	}
+
+	// 发往上游可能等待确认，放到队列中按顺序发送，避免阻塞broker的分发
+	queue := make(chan *paho.Publish, bridgeQueueSize)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case publish := <-queue:
+				if _, err := bridge.Publish(ctx, publish); err != nil {
+					slog.Warn("Broker: bridge forward out failed", "topic", publish.Topic, "err", err)
+				}
+			}
+		}
+	}()
+	for _, filter := range config.Out {
+		err = server.Subscribe(filter, nextSubscriptionId(), func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+			if pk.Origin == mqtt.InlineClientId {
+				return
+			}
+			select {
+			case queue <- &paho.Publish{
+				QoS:     pk.FixedHeader.Qos,
+				Retain:  pk.FixedHeader.Retain,
+				Topic:   pk.TopicName,
+				Payload: pk.Payload,
+			}:
+			default:
+				slog.Warn("Broker: bridge queue full, message dropped", "topic", pk.TopicName)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("broker: bridge subscribe %v failed, %v", filter, err)
+		}
+	}
+	slog.Info("Broker: bridge initialized", "servers", clientConfig.ServerUrls, "out", config.Out, "in", config.In)
+	return nil
+}
@@ -0,0 +1,240 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestValidateConfig(t *testing.T) {
+	user := &entity.BrokerUserConfig{Username: "pdu", Password: "secret"}
+	tests := []struct {
+		name    string
+		config  *entity.BrokerConfig
+		wantErr string
+	}{
+		{"no users", &entity.BrokerConfig{}, "users is required"},
+		{"anonymous", &entity.BrokerConfig{AllowAnonymous: true}, ""},
+		{"users", &entity.BrokerConfig{Users: []*entity.BrokerUserConfig{user}}, ""},
+		{"users and anonymous", &entity.BrokerConfig{Users: []*entity.BrokerUserConfig{user}, AllowAnonymous: true},
+			"allow_anonymous can not be used together with users"},
+		{"empty password", &entity.BrokerConfig{Users: []*entity.BrokerUserConfig{{Username: "pdu"}}},
+			"users[0] needs username and password"},
+		{"bridge without mqtt", &entity.BrokerConfig{AllowAnonymous: true, Bridge: &entity.BridgeConfig{}},
+			"bridge.mqtt is required"},
+		{"bridge in control topics", &entity.BrokerConfig{AllowAnonymous: true, Bridge: &entity.BridgeConfig{
+			MQTT: &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", ClientID: "bridge"},
+			In:   []string{"homeassistant/device/+/set", "/yespeed/pdu/yespeed/+/in/+"},
+		}}, `bridge.in[1] "/yespeed/pdu/yespeed/+/in/+" matches yespeed control topics`},
+		{"bridge in all control topics", &entity.BrokerConfig{AllowAnonymous: true, Bridge: &entity.BridgeConfig{
+			MQTT: &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", ClientID: "bridge"},
+			In:   []string{"/yespeed/pdu/yespeed/node/in/#"},
+		}}, `bridge.in[0] "/yespeed/pdu/yespeed/node/in/#" matches yespeed control topics`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsControlTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"/yespeed/pdu/yespeed/node/in/2000000", true},
+		{"site/yespeed/node/in/2000000", true},
+		{"/yespeed/pdu/yespeed/node/out/1000000", false},
+		{"homeassistant/device/node/set", false},
+		{"in/1", false},
+	}
+	for _, tt := range tests {
+		if got := isControlTopic(tt.topic); got != tt.want {
+			t.Errorf("isControlTopic(%v) = %v, want %v", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// topicCounter 记录进程内订阅收到的每个主题的次数
+type topicCounter struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func (counter *topicCounter) add(topic string) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	counter.counts[topic]++
+}
+
+func (counter *topicCounter) get(topic string) int {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	return counter.counts[topic]
+}
+
+func waitFor(t *testing.T, name string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func connectClient(ctx context.Context, address string, username string, password string) (*paho.Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	client := paho.NewClient(paho.ClientConfig{Conn: conn, ClientID: "test_" + username})
+	_, err = client.Connect(ctx, &paho.Connect{
+		ClientID: "test_" + username, KeepAlive: 30, CleanStart: true,
+		Username: username, UsernameFlag: username != "", Password: []byte(password), PasswordFlag: password != "",
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func TestBrokerAuthAndBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	upstreamAddress := freeAddress(t)
+	upstream := mqtt.New(&mqtt.Options{InlineClient: true, Logger: slog.Default()})
+	if err := upstream.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.AddListener(listeners.NewTCP(listeners.Config{ID: "upstream", Address: upstreamAddress})); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	upstreamCounter := &topicCounter{counts: make(map[string]int)}
+	if err := upstream.Subscribe("#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		upstreamCounter.add(pk.TopicName)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	address := freeAddress(t)
+	err := Init(ctx, &entity.BrokerConfig{
+		Listen: address,
+		Users:  []*entity.BrokerUserConfig{{Username: "pdu", Password: "secret"}},
+		Bridge: &entity.BridgeConfig{
+			MQTT: &entity.MQTTConfig{URL: "mqtt://" + upstreamAddress, ClientID: "bridge"},
+			Out:  []string{"shared/#"},
+			In:   []string{"shared/#", "pdu/#"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		Stop(context.Background())
+		server, bridge = nil, nil
+	}()
+	localCounter := &topicCounter{counts: make(map[string]int)}
+	if _, err = Subscribe("#", func(topic string, _ []byte) { localCounter.add(topic) }); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "bridge connected", func() bool {
+		return slices.ContainsFunc(status.GetAll(), func(component *entity.ComponentStatus) bool {
+			return component.Name == bridgeStatusName && component.State == status.StateUp
+		})
+	})
+
+	authTests := []struct {
+		username string
+		password string
+		wantErr  bool
+	}{
+		{"", "", true},
+		{"pdu", "wrong", true},
+		{"other", "secret", true},
+		{"pdu", "secret", false},
+	}
+	var client *paho.Client
+	for _, tt := range authTests {
+		connected, err := connectClient(ctx, address, tt.username, tt.password)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("connect as %q/%q: got error %v, want error %v", tt.username, tt.password, err, tt.wantErr)
+		}
+		if err == nil {
+			client = connected
+		}
+	}
+	if client == nil {
+		t.Fatal("authorized client not connected")
+	}
+	defer client.Disconnect(&paho.Disconnect{})
+
+	// 真实客户端发布的消息转发到上游
+	if _, err = client.Publish(ctx, &paho.Publish{Topic: "shared/out", Payload: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "out forwarded", func() bool { return upstreamCounter.get("shared/out") == 1 })
+
+	// 从上游转发进来的消息由进程内客户端发布，不会再被out转发回上游
+	published := 0
+	waitFor(t, "in subscribed", func() bool {
+		if err := upstream.Publish("shared/in", []byte("1"), false, 0); err == nil {
+			published++
+		}
+		return localCounter.get("shared/in") > 0
+	})
+	time.Sleep(200 * time.Millisecond)
+	if got := upstreamCounter.get("shared/in"); got != published {
+		t.Errorf("upstream got shared/in %v times, published %v times", got, published)
+	}
+
+	// 上游发布的控制主题被丢弃，随后的普通消息照常转发
+	if err = upstream.Publish("pdu/yespeed/node/in/2000000", []byte("{}"), false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = upstream.Publish("pdu/yespeed/node/out/1000000", []byte("{}"), false, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "marker forwarded", func() bool { return localCounter.get("pdu/yespeed/node/out/1000000") == 1 })
+	if got := localCounter.get("pdu/yespeed/node/in/2000000"); got != 0 {
+		t.Errorf("control topic forwarded %v times", got)
+	}
+}
@@ -2,53 +2,241 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second // 轮询类采集器的默认间隔
+	defaultPollTimeout  = 5 * time.Second
 )
 
 var (
-	collectors []YespeedPDUCollector
+	lock       sync.RWMutex
+	baseCtx    context.Context
+	collectors []*runningCollector
+
+	// createCollector 启动和重新加载时创建采集器的入口，测试时替换
+	createCollector = newCollector
 )
 
 type YespeedPDUCollector interface {
 	Run(ctx context.Context, config *entity.CollectorConfig) error
 	Stop(ctx context.Context)
-	SendCommand(ctx context.Context, command *entity.Command)
+	SendCommand(ctx context.Context, command *entity.Command) error
+}
+
+// runningCollector 保留启动时的配置，重新加载时据此判断采集器是否需要重启
+type runningCollector struct {
+	config    *entity.CollectorConfig
+	collector YespeedPDUCollector
+	cancel    context.CancelFunc
+}
+
+// stop 每个实例使用独立的context，停止后取消以结束实例在后台启动的协程
+func (running *runningCollector) stop(ctx context.Context) {
+	running.collector.Stop(ctx)
+	running.cancel()
 }
 
 func Init(ctx context.Context, configs []*entity.CollectorConfig) error {
+	baseCtx = ctx
+	return Reload(ctx, configs)
+}
+
+// Reload 按名称对比新旧配置，只停止、启动或重启有变化的采集器
+// 任一采集器启动失败时恢复到调用前的状态，未变化的采集器始终保持运行
+func Reload(ctx context.Context, configs []*entity.CollectorConfig) error {
 	if len(configs) == 0 {
 		return fmt.Errorf("collector config is empty")
 	}
+	if err := setDefaultNames(configs); err != nil {
+		return err
+	}
 
-	collectors = make([]YespeedPDUCollector, 0, len(configs))
-	for _, config := range configs {
-		var collector YespeedPDUCollector
-		switch config.Type {
-		case "mqtt":
-			collector = &MQTTCollector{}
-		default:
-			return fmt.Errorf("unknown collector type %v", config.Type)
+	lock.Lock()
+	defer lock.Unlock()
+	previous := make(map[string]*runningCollector, len(collectors))
+	for _, running := range collectors {
+		previous[running.config.Name] = running
+	}
+	result := make([]*runningCollector, 0, len(configs))
+	started := make([]*runningCollector, 0)
+	stopped := make([]*runningCollector, 0)
+	// rollback 停止本次启动的实例，用原来的配置重新启动被停止的采集器
+	rollback := func() {
+		for _, running := range started {
+			running.stop(ctx)
+		}
+		restored := make([]*runningCollector, 0, len(collectors))
+		for _, running := range collectors {
+			if !slices.Contains(stopped, running) {
+				restored = append(restored, running)
+				continue
+			}
+			restarted, err := startCollector(running.config)
+			if err != nil {
+				slog.Error("Collector: restore collector failed", "name", running.config.Name, "err", err)
+				continue
+			}
+			restored = append(restored, restarted)
+		}
+		collectors = restored
+	}
+
+	for i, config := range configs {
+		if running, ok := previous[config.Name]; ok {
+			delete(previous, config.Name)
+			if reflect.DeepEqual(running.config, config) {
+				result = append(result, running)
+				continue
+			}
+			// 先停止旧的实例，避免两个实例以相同的客户端ID同时连接
+			slog.Info("Collector: restarting changed collector", "name", config.Name)
+			running.stop(ctx)
+			stopped = append(stopped, running)
+		} else if collectors != nil {
+			slog.Info("Collector: starting added collector", "name", config.Name)
 		}
 
-		if err := collector.Run(ctx, config); err != nil {
-			return fmt.Errorf("collector: run %v collector failed, %v", config.Type, err)
+		running, err := startCollector(config)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("collector: collectors[%v].%v", i, err)
 		}
-		collectors = append(collectors, collector)
+		started = append(started, running)
+		result = append(result, running)
 	}
 
+	for name, running := range previous {
+		slog.Info("Collector: stopping removed collector", "name", name)
+		running.stop(ctx)
+	}
+	collectors = result
 	return nil
 }
 
+// setDefaultNames 未配置名称的采集器以{type}_{序号}命名
+func setDefaultNames(configs []*entity.CollectorConfig) error {
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("%v_%v", config.Type, i)
+		}
+		if names[config.Name] {
+			return fmt.Errorf("collector: collectors[%v].name %q is duplicated", i, config.Name)
+		}
+		names[config.Name] = true
+	}
+	return nil
+}
+
+// startCollector Run只校验配置并在后台建立连接，连接状态通过status包报告
+func startCollector(config *entity.CollectorConfig) (*runningCollector, error) {
+	collector, err := createCollector(config.Type)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(baseCtx)
+	if err = collector.Run(ctx, config); err != nil {
+		cancel()
+		return nil, fmt.Errorf("run %v collector failed, %v", config.Name, err)
+	}
+	return &runningCollector{config: config, collector: collector, cancel: cancel}, nil
+}
+
+// Types 支持的采集器类型
+var Types = []string{"mqtt", "embedded", "http", "snmp", "modbus"}
+
+func newCollector(collectorType string) (configurableCollector, error) {
+	switch collectorType {
+	case "mqtt":
+		return &MQTTCollector{}, nil
+	case "embedded":
+		return &EmbeddedCollector{}, nil
+	case "http":
+		return &HTTPCollector{}, nil
+	case "snmp":
+		return &SNMPCollector{}, nil
+	case "modbus":
+		return &ModbusCollector{}, nil
+	}
+	return nil, fmt.Errorf("type %q must be one of %v", collectorType, strings.Join(Types, ", "))
+}
+
+// configurableCollector setup只校验配置并初始化内部状态，不建立连接也不启动轮询
+type configurableCollector interface {
+	YespeedPDUCollector
+	setup(config *entity.CollectorConfig) error
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于采集器配置
+func ValidateConfig(config *entity.CollectorConfig) error {
+	collector, err := newCollector(config.Type)
+	if err != nil {
+		return err
+	}
+	return collector.setup(config)
+}
+
 func Stop(ctx context.Context) {
-	for _, collector := range collectors {
-		collector.Stop(ctx)
+	lock.Lock()
+	defer lock.Unlock()
+	for _, running := range collectors {
+		running.stop(ctx)
 	}
+	collectors = nil
 }
 
-func SendCommand(ctx context.Context, command *entity.Command) {
-	for _, collector := range collectors {
-		collector.SendCommand(ctx, command)
+// SendCommand 所有命令的统一入口，被保护或互锁拒绝时返回错误且不会下发
+func SendCommand(ctx context.Context, command *entity.Command) error {
+	if err := checkProtection(ctx, command); err != nil {
+		slog.Warn("Collector: command rejected", "nodeId", command.NodeID, "deviceId", command.DeviceID,
+			"command", command.Command, "err", err)
+		return err
+	}
+	if command.Type == "switch" {
+		database.SetDesiredState(ctx, command.NodeID, command.DeviceID, command.Command == "ON")
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+	errs := make([]error, 0)
+	for _, running := range collectors {
+		if err := running.collector.SendCommand(ctx, command); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// 只要有一个采集器可能已经下发，就保留互锁登记直到超时
+	if len(errs) == len(collectors) {
+		releasePending(command)
+	}
+	return errors.Join(errs...)
+}
+
+// deviceStatusName 轮询类采集器按设备分别报告状态
+func deviceStatusName(collectorName string, nodeId string) string {
+	return collectorName + "/" + nodeId
+}
+
+// reportPollState 停止过程中被取消的轮询不改变状态
+func reportPollState(ctx context.Context, collectorName string, nodeId string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		status.Set(deviceStatusName(collectorName, nodeId), status.StateDown, err)
+	} else {
+		status.Set(deviceStatusName(collectorName, nodeId), status.StateUp, nil)
 	}
 }
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+// lifecycleRecorder 记录假采集器的启动和停止顺序，failing中的采集器启动失败
+type lifecycleRecorder struct {
+	lock    sync.Mutex
+	events  []string
+	failing map[string]bool
+}
+
+func (recorder *lifecycleRecorder) add(event string) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.events = append(recorder.events, event)
+}
+
+func (recorder *lifecycleRecorder) take() []string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	events := recorder.events
+	recorder.events = nil
+	return events
+}
+
+type fakeCollector struct {
+	recorder *lifecycleRecorder
+	name     string
+}
+
+func (collector *fakeCollector) setup(*entity.CollectorConfig) error {
+	return nil
+}
+
+func (collector *fakeCollector) Run(_ context.Context, config *entity.CollectorConfig) error {
+	if collector.recorder.failing[config.Name] {
+		return errors.New("fake failure")
+	}
+	collector.name = config.Name
+	collector.recorder.add("start " + config.Name)
+	return nil
+}
+
+func (collector *fakeCollector) Stop(context.Context) {
+	collector.recorder.add("stop " + collector.name)
+}
+
+func (collector *fakeCollector) SendCommand(context.Context, *entity.Command) error {
+	return nil
+}
+
+func fakeCollectorConfig(name string, url string) *entity.CollectorConfig {
+	return &entity.CollectorConfig{Name: name, Type: "fake", MQTT: &entity.MQTTConfig{URL: url}}
+}
+
+func TestReload(t *testing.T) {
+	recorder := &lifecycleRecorder{failing: map[string]bool{"d": true}}
+	original := createCollector
+	createCollector = func(string) (configurableCollector, error) {
+		return &fakeCollector{recorder: recorder}, nil
+	}
+	defer func() { createCollector = original }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Init(ctx, []*entity.CollectorConfig{fakeCollectorConfig("a", "u1"), fakeCollectorConfig("b", "u1")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.take(); !slices.Equal(got, []string{"start a", "start b"}) {
+		t.Fatalf("init got %v", got)
+	}
+
+	tests := []struct {
+		name        string
+		configs     []*entity.CollectorConfig
+		wantErr     string
+		wantEvents  []string
+		wantRunning []string // 重新加载后运行中的采集器及其地址
+		keep        []string // 实例不应被替换的采集器
+	}{
+		{"changed and added", []*entity.CollectorConfig{fakeCollectorConfig("a", "u1"), fakeCollectorConfig("b", "u2"), fakeCollectorConfig("c", "u1")},
+			"", []string{"stop b", "start b", "start c"}, []string{"a u1", "b u2", "c u1"}, []string{"a"}},
+		{"removed", []*entity.CollectorConfig{fakeCollectorConfig("a", "u1"), fakeCollectorConfig("c", "u1")},
+			"", []string{"stop b"}, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		{"unchanged", []*entity.CollectorConfig{fakeCollectorConfig("a", "u1"), fakeCollectorConfig("c", "u1")},
+			"", nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		// 启动d失败时停止新的a，用原来的配置重新启动a，c始终保持运行
+		{"rollback", []*entity.CollectorConfig{fakeCollectorConfig("a", "u2"), fakeCollectorConfig("d", "u1")},
+			"collector: collectors[1].run d collector failed, fake failure",
+			[]string{"stop a", "start a", "stop a", "start a"}, []string{"a u1", "c u1"}, []string{"c"}},
+		{"empty", nil, "collector config is empty", nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		{"duplicated", []*entity.CollectorConfig{fakeCollectorConfig("a", "u1"), fakeCollectorConfig("a", "u2")},
+			`collector: collectors[1].name "a" is duplicated`, nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		before := runningCollectors()
+		err := Reload(ctx, tt.configs)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := recorder.take(); !slices.Equal(got, tt.wantEvents) {
+			t.Errorf("%v: got events %v, want %v", tt.name, got, tt.wantEvents)
+		}
+		after := runningCollectors()
+		running := make([]string, 0, len(after))
+		for _, collector := range after {
+			running = append(running, collector.config.Name+" "+collector.config.MQTT.URL)
+		}
+		if !slices.Equal(running, tt.wantRunning) {
+			t.Errorf("%v: got running %v, want %v", tt.name, running, tt.wantRunning)
+		}
+		for _, name := range tt.keep {
+			if findRunning(before, name) != findRunning(after, name) {
+				t.Errorf("%v: collector %v was restarted", tt.name, name)
+			}
+		}
+	}
+
+	Stop(ctx)
+	if got := recorder.take(); !slices.Equal(got, []string{"stop a", "stop c"}) {
+		t.Errorf("stop got %v", got)
+	}
+}
+
+func runningCollectors() []*runningCollector {
+	lock.RLock()
+	defer lock.RUnlock()
+	return slices.Clone(collectors)
+}
+
+func findRunning(collectors []*runningCollector, name string) *runningCollector {
+	for _, running := range collectors {
+		if running.config.Name == name {
+			return running
+		}
+	}
+	return nil
+}
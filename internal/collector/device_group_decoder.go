@@ -0,0 +1,327 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/utils"
+)
+
+const (
+	deviceGroupTypeOutlet = 1
+	deviceGroupTypeAC     = 2
+)
+
+var (
+	errFieldMissing = errors.New("missing")
+
+	acModes    = []string{"auto", "cool", "dry", "fan_only", "heat"}
+	acFanModes = []string{"auto", "low", "medium", "high"}
+)
+
+// FlexValue PDU上报的数值字段有时是字符串有时是数字，也可能缺失或为null
+type FlexValue struct {
+	Raw string
+	Set bool // 字段存在且不为null
+}
+
+func (v *FlexValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	switch data[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		v.Raw = strings.TrimSpace(s)
+	case '{', '[':
+		return fmt.Errorf("expect string or number, got %s", utils.Truncate(string(data), 32))
+	default:
+		v.Raw = string(data)
+	}
+	v.Set = true
+	return nil
+}
+
+func (v FlexValue) Float32() (float32, error) {
+	if !v.Set {
+		return 0, errFieldMissing
+	}
+	result, err := strconv.ParseFloat(v.Raw, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", v.Raw)
+	}
+	return float32(result), nil
+}
+
+func (v FlexValue) Int() (int, error) {
+	if !v.Set {
+		return 0, errFieldMissing
+	}
+	switch v.Raw {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+	result, err := strconv.Atoi(v.Raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", v.Raw)
+	}
+	return result, nil
+}
+
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// DecodeError 载荷中无法解析或不合法的字段，合法的部分仍会被使用
+type DecodeError struct {
+	Payload string       `json:"payload"` // 截断后的原始载荷
+	Errors  []FieldError `json:"errors"`
+}
+
+func (e *DecodeError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		messages = append(messages, fieldError.String())
+	}
+	return fmt.Sprintf("decode payload failed: %v", strings.Join(messages, "; "))
+}
+
+// fieldDecoder 记录Yespeed各类消息中不合法的字段及其路径
+type fieldDecoder struct {
+	errors []FieldError
+}
+
+func (d *fieldDecoder) add(path string, err error) {
+	d.errors = append(d.errors, FieldError{Path: path, Message: err.Error()})
+}
+
+// id 标识类字段必须存在且为正整数
+func (d *fieldDecoder) id(path string, value FlexValue) (int, bool) {
+	result, err := value.Int()
+	if err == nil && result <= 0 {
+		err = fmt.Errorf("must be positive, got %v", result)
+	}
+	if err != nil {
+		d.add(path, err)
+		return 0, false
+	}
+	return result, true
+}
+
+// optionalID 组内序号等字段缺失时为0，存在时必须是非负整数
+func (d *fieldDecoder) optionalID(path string, value FlexValue) (int, bool) {
+	result, err := value.Int()
+	if errors.Is(err, errFieldMissing) {
+		return 0, true
+	}
+	if err == nil && result < 0 {
+		err = fmt.Errorf("must not be negative, got %v", result)
+	}
+	if err != nil {
+		d.add(path, err)
+		return 0, false
+	}
+	return result, true
+}
+
+// thresmask 告警位允许缺失，负数或超过32位时记录错误并按没有告警处理
+func (d *fieldDecoder) thresmask(path string, value FlexValue) uint32 {
+	result, err := value.Int()
+	if err == nil && (result < 0 || int64(result) > math.MaxUint32) {
+		err = fmt.Errorf("out of range, got %v", result)
+	}
+	if err != nil {
+		if !errors.Is(err, errFieldMissing) {
+			d.add(path, err)
+		}
+		return 0
+	}
+	return uint32(result)
+}
+
+// result 没有不合法的字段时返回nil
+func (d *fieldDecoder) result(payload []byte) error {
+	if len(d.errors) == 0 {
+		return nil
+	}
+	return &DecodeError{
+		Payload: utils.Truncate(string(payload), unknownMessageSampleSize),
+		Errors:  d.errors,
+	}
+}
+
+// measurement 测量值字段允许缺失，存在但无法解析时记录错误，两种情况都返回nil而不是0
+func (d *fieldDecoder) measurement(path string, value FlexValue) *float32 {
+	result, err := value.Float32()
+	if err != nil {
+		if !errors.Is(err, errFieldMissing) {
+			d.add(path, err)
+		}
+		return nil
+	}
+	return &result
+}
+
+// enum 枚举字段允许缺失，缺失或超出范围时返回空字符串
+func (d *fieldDecoder) enum(path string, value FlexValue, names []string) string {
+	result, err := value.Int()
+	if err == nil && (result < 0 || result >= len(names)) {
+		err = fmt.Errorf("out of range, got %v", result)
+	}
+	if err != nil {
+		if !errors.Is(err, errFieldMissing) {
+			d.add(path, err)
+		}
+		return ""
+	}
+	return names[result]
+}
+
+// deviceGroupReport 一条设备组上报解析出的全部内容
+type deviceGroupReport struct {
+	Groups    []*entity.PDUGroup
+	Devices   []*entity.PDUDevice
+	ACDevices []*entity.ACDevice
+}
+
+// decodeDeviceGroupMessage 解析1000000设备组上报，带或不带最外层大括号都可以，
+// 单个设备组或插座不合法时跳过它并继续解析其它部分
+func decodeDeviceGroupMessage(layout *outletLayout, nodeID string, payload []byte) (*deviceGroupReport, error) {
+	report := &deviceGroupReport{}
+	var message DeviceGroupMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return report, &DecodeError{
+			Payload: utils.Truncate(string(payload), unknownMessageSampleSize),
+			Errors:  []FieldError{{Path: "$", Message: err.Error()}},
+		}
+	}
+
+	d := &fieldDecoder{}
+	if message.Devices == nil {
+		d.add("devices", errFieldMissing)
+	}
+	// 先观察所有插座再分配全局ID，保证每组插座数推导自整条消息
+	for _, switchGroup := range message.Devices {
+		if groupType, err := switchGroup.Type.Int(); err == nil && groupType == deviceGroupTypeAC {
+			continue
+		}
+		for _, _switch := range switchGroup.SubDevices {
+			if switchID, err := _switch.ID.Int(); err == nil {
+				layout.observe(nodeID, switchID)
+			}
+		}
+	}
+	for i, switchGroup := range message.Devices {
+		path := fmt.Sprintf("devices[%v]", i)
+		groupID, ok := d.id(path+".id", switchGroup.ID)
+		if !ok {
+			continue
+		}
+		// 旧固件不上报type，按插座类处理
+		groupType, err := switchGroup.Type.Int()
+		if err != nil && !errors.Is(err, errFieldMissing) {
+			d.add(path+".type", err)
+			continue
+		}
+		if groupType == deviceGroupTypeAC {
+			if acDevice := d.acDevice(path, nodeID, groupID, &switchGroup); acDevice != nil {
+				report.ACDevices = append(report.ACDevices, acDevice)
+			}
+			continue
+		}
+
+		voltage := d.measurement(path+".voltage", switchGroup.Voltage)
+		factor := d.measurement(path+".factor", switchGroup.Factor) // 读上来都是0
+		frequency := d.measurement(path+".freq", switchGroup.Freq)
+		for k, _switch := range switchGroup.SubDevices {
+			subPath := fmt.Sprintf("%v.subdevs[%v]", path, k)
+			switchID, ok := d.id(subPath+".id", _switch.ID)
+			if !ok {
+				continue
+			}
+			on, err := _switch.On.Int()
+			if err != nil {
+				d.add(subPath+".on", err)
+				continue
+			}
+			globalID, err := layout.globalId(nodeID, groupID, switchID)
+			if err != nil {
+				d.add(subPath+".id", err)
+				continue
+			}
+
+			report.Devices = append(report.Devices, &entity.PDUDevice{
+				NodeID:    nodeID,
+				ID:        globalID,
+				GroupID:   fmt.Sprintf("%v", groupID),
+				Name:      _switch.Name,
+				On:        on == 1,
+				Voltage:   voltage,
+				Current:   d.measurement(subPath+".current", _switch.Current),
+				Power:     d.measurement(subPath+".power", _switch.Power),
+				Energy:    d.measurement(subPath+".energy", _switch.Energy),
+				Factor:    factor,
+				Frequency: frequency,
+			})
+		}
+
+		thresmask := d.thresmask(path+".thresmask", switchGroup.Thresmask)
+		report.Groups = append(report.Groups, &entity.PDUGroup{
+			NodeID:       nodeID,
+			ID:           fmt.Sprintf("%v", groupID),
+			Name:         switchGroup.Name,
+			Voltage:      voltage,
+			TotalCurrent: d.measurement(path+".tcurrent", switchGroup.TotalCurrent),
+			Power:        d.measurement(path+".power", switchGroup.Power),
+			Energy:       d.measurement(path+".energy", switchGroup.Energy),
+			Factor:       factor,
+			Frequency:    frequency,
+			Thresmask:    int(thresmask),
+			Alarms:       decodeThresmask(thresmask),
+		})
+	}
+
+	return report, d.result(payload)
+}
+
+// acDevice 空调类设备组没有插座，开关和运行参数直接挂在设备组上
+func (d *fieldDecoder) acDevice(path string, nodeID string, groupID int, group *DeviceGroup) *entity.ACDevice {
+	on, err := group.On.Int()
+	if err != nil {
+		d.add(path+".on", err)
+		return nil
+	}
+	acDevice := &entity.ACDevice{
+		NodeID:      nodeID,
+		ID:          fmt.Sprintf("%v", groupID),
+		Name:        group.Name,
+		On:          on == 1,
+		Mode:        "off",
+		Setpoint:    d.measurement(path+".settemp", group.SetTemp),
+		FanMode:     d.enum(path+".fan", group.Fan, acFanModes),
+		Temperature: d.measurement(path+".temp", group.Temperature),
+		Power:       d.measurement(path+".power", group.Power),
+	}
+	mode := d.enum(path+".mode", group.Mode, acModes)
+	if acDevice.On {
+		acDevice.Mode = mode
+	}
+	return acDevice
+}
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFlexValue(t *testing.T) {
+	tests := []struct {
+		json      string
+		wantSet   bool
+		wantFloat float32
+		wantInt   int
+		wantErr   bool // Float32和Int都不能解析
+	}{
+		{`"230.5"`, true, 230.5, 0, false},
+		{`" 12 "`, true, 12, 12, false},
+		{`7`, true, 7, 7, false},
+		{`true`, true, 0, 1, false},
+		{`null`, false, 0, 0, true},
+		{`"n/a"`, true, 0, 0, true},
+	}
+	for _, tt := range tests {
+		var holder struct {
+			Value FlexValue `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(`{"value":`+tt.json+`}`), &holder); err != nil {
+			t.Errorf("%v: %v", tt.json, err)
+			continue
+		}
+		value := holder.Value
+		if value.Set != tt.wantSet {
+			t.Errorf("%v: got set %v", tt.json, value.Set)
+		}
+		f, floatErr := value.Float32()
+		i, intErr := value.Int()
+		if tt.wantErr && (intErr == nil || floatErr == nil) {
+			t.Errorf("%v: got %v %v, want error", tt.json, f, i)
+		}
+		if !tt.wantErr && ((floatErr == nil && f != tt.wantFloat) || (intErr == nil && i != tt.wantInt)) {
+			t.Errorf("%v: got %v %v, want %v %v", tt.json, f, i, tt.wantFloat, tt.wantInt)
+		}
+	}
+
+	var holder struct {
+		Value FlexValue `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(`{"value":{"a":1}}`), &holder); err == nil {
+		t.Error("object should be rejected")
+	}
+	if _, err := holder.Value.Float32(); !errors.Is(err, errFieldMissing) {
+		t.Errorf("missing value got error %v", err)
+	}
+}
+
+func TestDecodeDeviceGroupMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantDevices int
+		wantGroups  int
+		wantAC      int
+		wantErrors  []string
+	}{
+		{"framed", `{"devices":[{"id":1,"type":1,"voltage":"220","subdevs":[{"id":1,"on":1},{"id":2,"on":0}]}]}`, 2, 1, 0, nil},
+		{"unframed", `"devices":[{"id":"1","voltage":220,"subdevs":[{"id":"1","on":"1"}]}]`, 1, 1, 0, nil},
+		{"not json", `<html>`, 0, 0, 0, []string{"$"}},
+		{"no devices", `{}`, 0, 0, 0, []string{"devices"}},
+		{"invalid group id", `{"devices":[{"id":0,"subdevs":[{"id":1,"on":1}]},{"id":2,"subdevs":[{"id":1,"on":1}]}]}`,
+			1, 1, 0, []string{"devices[0].id"}},
+		{"invalid type", `{"devices":[{"id":1,"type":"x","subdevs":[{"id":1,"on":1}]}]}`, 0, 0, 0, []string{"devices[0].type"}},
+		{"invalid outlet", `{"devices":[{"id":1,"subdevs":[{"on":1},{"id":2},{"id":3,"on":1}]}]}`,
+			1, 1, 0, []string{"devices[0].subdevs[0].id", "devices[0].subdevs[1].on"}},
+		{"invalid measurements", `{"devices":[{"id":1,"voltage":"n/a","thresmask":"x","subdevs":[{"id":1,"on":1,"current":"-","power":{}}]}]}`,
+			0, 0, 0, []string{"$"}},
+		{"invalid measurement keeps outlet", `{"devices":[{"id":1,"voltage":"n/a","thresmask":"x","subdevs":[{"id":1,"on":1,"current":"-"}]}]}`,
+			1, 1, 0, []string{"devices[0].voltage", "devices[0].subdevs[0].current", "devices[0].thresmask"}},
+		{"negative thresmask", `{"devices":[{"id":1,"thresmask":-1,"subdevs":[{"id":1,"on":1}]}]}`,
+			1, 1, 0, []string{"devices[0].thresmask"}},
+		{"thresmask over 32 bits", `{"devices":[{"id":1,"thresmask":"4294967296","subdevs":[{"id":1,"on":1}]}]}`,
+			1, 1, 0, []string{"devices[0].thresmask"}},
+		{"ac", `{"devices":[{"id":3,"type":2,"on":1,"mode":1,"fan":9,"settemp":"26","temp":"27.5"}]}`,
+			0, 0, 1, []string{"devices[0].fan"}},
+		{"ac without on", `{"devices":[{"id":3,"type":2,"mode":1}]}`, 0, 0, 0, []string{"devices[0].on"}},
+	}
+	for _, tt := range tests {
+		layout, _ := newOutletLayout(nil)
+		report, err := decodeDeviceGroupMessage(layout, "node", []byte(tt.payload))
+		if len(report.Devices) != tt.wantDevices || len(report.Groups) != tt.wantGroups || len(report.ACDevices) != tt.wantAC {
+			t.Errorf("%v: got %v outlets %v groups %v ac", tt.name, len(report.Devices), len(report.Groups), len(report.ACDevices))
+		}
+		var paths []string
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			for _, fieldError := range decodeErr.Errors {
+				paths = append(paths, fieldError.Path)
+			}
+		} else if err != nil {
+			t.Errorf("%v: got error %T %v, want DecodeError", tt.name, err, err)
+		}
+		if !reflect.DeepEqual(paths, tt.wantErrors) {
+			t.Errorf("%v: got error paths %v, want %v", tt.name, paths, tt.wantErrors)
+		}
+		for _, group := range report.Groups {
+			if group.Thresmask < 0 || len(group.Alarms) > 32 {
+				t.Errorf("%v: got group %+v", tt.name, group)
+			}
+		}
+	}
+}
+
+func TestDecodeDeviceGroupMeasurements(t *testing.T) {
+	layout, _ := newOutletLayout(nil)
+	report, err := decodeDeviceGroupMessage(layout, "node", []byte(`{"devices":[
+		{"id":2,"voltage":"220.5","tcurrent":"1.5","freq":"50","thresmask":5,"subdevs":[{"id":1,"on":1,"current":"0.5","energy":""}]},
+		{"id":3,"type":2,"on":0,"mode":4,"fan":2,"settemp":"26"}]}`))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || len(decodeErr.Errors) != 1 || decodeErr.Errors[0].Path != "devices[0].subdevs[0].energy" {
+		t.Fatalf("got error %v", err)
+	}
+
+	// 缺失的测量值为nil而不是0
+	outlet := report.Devices[0]
+	if outlet.ID != "5" || outlet.GroupID != "2" || !outlet.On || *outlet.Voltage != 220.5 || *outlet.Current != 0.5 ||
+		outlet.Power != nil || outlet.Energy != nil || *outlet.Frequency != 50 {
+		t.Errorf("got outlet %+v", outlet)
+	}
+	group := report.Groups[0]
+	if *group.TotalCurrent != 1.5 || group.Power != nil || !reflect.DeepEqual(group.Alarms, []string{"bit0", "bit2"}) {
+		t.Errorf("got group %+v", group)
+	}
+	// 关闭时不上报运行模式
+	ac := report.ACDevices[0]
+	if ac.ID != "3" || ac.On || ac.Mode != "off" || ac.FanMode != "medium" || *ac.Setpoint != 26 || ac.Temperature != nil {
+		t.Errorf("got ac %+v", ac)
+	}
+}
+
+func TestDecodeThresmask(t *testing.T) {
+	tests := []struct {
+		thresmask uint32
+		want      []string
+	}{
+		{0, []string{}},
+		{1, []string{"bit0"}},
+		{0b100010, []string{"bit1", "bit5"}},
+		{1 << 31, []string{"bit31"}},
+	}
+	for _, tt := range tests {
+		if got := decodeThresmask(tt.thresmask); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%b: got %v, want %v", tt.thresmask, got, tt.want)
+		}
+	}
+	if got := decodeThresmask(math.MaxUint32); len(got) != 32 || got[31] != "bit31" {
+		t.Errorf("all bits: got %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/broker"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+// EmbeddedCollector 直接挂在内置broker上收发Yespeed消息，不经过网络连接
+type EmbeddedCollector struct {
+	yespeedProtocol
+	name           string
+	filter         string
+	subscriptionId int
+}
+
+// setup 是否配置了内置broker由整体配置校验负责，这里只校验采集器自身的配置
+func (collector *EmbeddedCollector) setup(config *entity.CollectorConfig) error {
+	if err := collector.configure(config); err != nil {
+		return err
+	}
+	collector.name = config.Name
+	collector.filter = collector.topic("+", "out", "+")
+	return nil
+}
+
+func (collector *EmbeddedCollector) Run(ctx context.Context, config *entity.CollectorConfig) error {
+	if !broker.Enabled() {
+		return fmt.Errorf("Collector.Embedded: embedded broker is not enabled, configure broker first")
+	}
+	if err := collector.setup(config); err != nil {
+		return fmt.Errorf("Collector.Embedded: %v", err)
+	}
+
+	var err error
+	collector.subscriptionId, err = broker.Subscribe(collector.filter, func(topic string, payload []byte) {
+		collector.handleMessage(context.Background(), "Collector.Embedded", topic, payload)
+	})
+	if err != nil {
+		return fmt.Errorf("Collector.Embedded: subscribe %v failed, %v", collector.filter, err)
+	}
+	// 进程内订阅没有连接可断开，订阅成功即可用
+	status.Set(collector.name, status.StateUp, nil)
+	slog.Info("Collector.Embedded: initialized", "topic", collector.filter)
+	return nil
+}
+
+func (collector *EmbeddedCollector) Stop(ctx context.Context) {
+	if collector.subscriptionId != 0 {
+		broker.Unsubscribe(collector.filter, collector.subscriptionId)
+	}
+	status.Remove(collector.name)
+	slog.Info("Collector.Embedded: stopped")
+}
+
+func (collector *EmbeddedCollector) SendCommand(ctx context.Context, command *entity.Command) error {
+	topic, payloadBytes, err := collector.controlMessage(command)
+	if err != nil {
+		return fmt.Errorf("Collector.Embedded: SendCommand, %v", err)
+	}
+	if err = broker.Publish(topic, payloadBytes, false, 0); err != nil {
+		return fmt.Errorf("Collector.Embedded: SendCommand failed, %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/utils"
+)
+
+const (
+	maxHTTPResponseSize = 1 << 20
+)
+
+// HTTPCollector 按固定间隔轮询每台PDU的Web接口，响应与MQTT设备组上报格式相同
+type HTTPCollector struct {
+	name    string
+	config  entity.HTTPCollectorConfig
+	devices map[string]*httpDevice // 节点ID->设备
+	layout  *outletLayout
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type httpDevice struct {
+	config *entity.HTTPDeviceConfig
+	client *http.Client
+}
+
+func (collector *HTTPCollector) setup(config *entity.CollectorConfig) error {
+	if config.HTTP == nil {
+		return fmt.Errorf("http is required")
+	}
+	collector.name = config.Name
+	collector.config = *config.HTTP
+	if collector.config.Interval <= 0 {
+		collector.config.Interval = defaultPollInterval
+	}
+	if collector.config.Timeout <= 0 {
+		collector.config.Timeout = defaultPollTimeout
+	}
+	if collector.config.StatePath == "" {
+		return fmt.Errorf("http.state_path is required")
+	}
+	if collector.config.ControlPath == "" {
+		return fmt.Errorf("http.control_path is required")
+	}
+	if len(collector.config.Devices) == 0 {
+		return fmt.Errorf("http.devices is required")
+	}
+
+	var err error
+	if collector.layout, err = newOutletLayout(config.Layout); err != nil {
+		return err
+	}
+	collector.devices = make(map[string]*httpDevice, len(collector.config.Devices))
+	for i, device := range collector.config.Devices {
+		if device.NodeID == "" || collector.devices[device.NodeID] != nil {
+			return fmt.Errorf("http.devices[%v].node_id %q is empty or duplicated", i, device.NodeID)
+		}
+		if u, err := url.Parse(device.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("http.devices[%v].url %q is invalid", i, device.URL)
+		}
+		timeout := collector.config.Timeout
+		if device.Timeout > 0 {
+			timeout = device.Timeout
+		}
+		collector.devices[device.NodeID] = &httpDevice{
+			config: device,
+			client: &http.Client{Timeout: timeout},
+		}
+	}
+	return nil
+}
+
+func (collector *HTTPCollector) Run(ctx context.Context, config *entity.CollectorConfig) error {
+	if err := collector.setup(config); err != nil {
+		return fmt.Errorf("Collector.HTTP: %v", err)
+	}
+
+	ctx, collector.cancel = context.WithCancel(ctx)
+	for nodeId, device := range collector.devices {
+		status.Set(deviceStatusName(collector.name, nodeId), status.StateConnecting, nil)
+		collector.wg.Add(1)
+		go collector.poll(ctx, device)
+	}
+	slog.Info("Collector.HTTP: initialized", "devices", len(collector.devices), "interval", collector.config.Interval)
+	return nil
+}
+
+func (collector *HTTPCollector) Stop(ctx context.Context) {
+	if collector.cancel != nil {
+		collector.cancel()
+		collector.wg.Wait()
+	}
+	for nodeId := range collector.devices {
+		status.Remove(deviceStatusName(collector.name, nodeId))
+	}
+	slog.Info("Collector.HTTP: stopped")
+}
+
+func (collector *HTTPCollector) poll(ctx context.Context, device *httpDevice) {
+	defer collector.wg.Done()
+	ticker := time.NewTicker(collector.config.Interval)
+	defer ticker.Stop()
+	for {
+		err := collector.fetchState(ctx, device)
+		if err != nil && ctx.Err() == nil {
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) {
+				slog.Error("Collector.HTTP: response validation failed", "nodeId", device.config.NodeID,
+					"errors", decodeErr.Errors, "payload", decodeErr.Payload)
+			} else {
+				slog.Error("Collector.HTTP: poll failed", "nodeId", device.config.NodeID, "err", err)
+			}
+		}
+		reportPollState(ctx, collector.name, device.config.NodeID, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (collector *HTTPCollector) fetchState(ctx context.Context, device *httpDevice) error {
+	body, err := collector.do(ctx, device, http.MethodGet, collector.config.StatePath, nil)
+	if err != nil {
+		return err
+	}
+	return parseDeviceGroupMessage(ctx, collector.layout, device.config.NodeID, body)
+}
+
+// SendCommand 只处理本采集器轮询的节点，其它节点由别的采集器负责
+func (collector *HTTPCollector) SendCommand(ctx context.Context, command *entity.Command) error {
+	device, ok := collector.devices[command.NodeID]
+	if !ok {
+		return nil
+	}
+	var req ControlDeviceReq
+	var err error
+	req.GroupID, req.DeviceID, err = collector.layout.address(command.NodeID, command.DeviceID)
+	if err != nil {
+		return fmt.Errorf("Collector.HTTP: SendCommand, parse device id failed, %v", err)
+	}
+	if command.Command == "ON" {
+		req.Action = 3
+	} else {
+		req.Action = 2
+	}
+
+	payloadBytes, _ := json.Marshal(req)
+	if _, err = collector.do(ctx, device, http.MethodPost, collector.config.ControlPath, payloadBytes); err != nil {
+		return fmt.Errorf("Collector.HTTP: SendCommand failed, %v", err)
+	}
+	return nil
+}
+
+func (collector *HTTPCollector) do(ctx context.Context, device *httpDevice, method string, path string, payload []byte) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(device.config.URL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if device.config.Username != "" {
+		request.SetBasicAuth(device.config.Username, device.config.Password)
+	}
+
+	response, err := device.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBytes, err := io.ReadAll(io.LimitReader(response.Body, maxHTTPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("read response failed, %v", err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, fmt.Errorf("%v %v returned %v: %v", method, path, response.Status,
+			utils.Truncate(string(responseBytes), unknownMessageSampleSize))
+	}
+	return responseBytes, nil
+}
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+// fakeHTTPPDU 模拟PDU的Web接口，state为状态接口返回的内容，收到的控制请求依次记录
+type fakeHTTPPDU struct {
+	lock     sync.Mutex
+	state    string
+	status   int
+	controls []ControlDeviceReq
+	auth     []string
+}
+
+func (pdu *fakeHTTPPDU) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pdu.lock.Lock()
+	defer pdu.lock.Unlock()
+	username, password, _ := r.BasicAuth()
+	pdu.auth = append(pdu.auth, username+":"+password)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/state":
+		if pdu.status != 0 {
+			w.WriteHeader(pdu.status)
+		}
+		_, _ = io.WriteString(w, pdu.state)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/control":
+		var req ControlDeviceReq
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pdu.controls = append(pdu.controls, req)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestHTTPCollector(t *testing.T, pdu *fakeHTTPPDU) *HTTPCollector {
+	server := httptest.NewServer(pdu)
+	t.Cleanup(server.Close)
+	collector := &HTTPCollector{}
+	err := collector.setup(&entity.CollectorConfig{Name: "http", Type: "http", HTTP: &entity.HTTPCollectorConfig{
+		StatePath:   "/api/state",
+		ControlPath: "/api/control",
+		Devices:     []*entity.HTTPDeviceConfig{{NodeID: "node", URL: server.URL + "/", Username: "admin", Password: "secret"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector
+}
+
+func TestHTTPCollectorPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	pdu := &fakeHTTPPDU{state: "{" + string(deviceGroupPayload(1, 4)) + "}"}
+	collector := newTestHTTPCollector(t, pdu)
+	config := &entity.CollectorConfig{Name: "http", Type: "http", HTTP: &collector.config}
+	collector.config.Interval = time.Hour
+	if err := collector.Run(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Stop(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(database.GetPDUNodeDevices(ctx, "node")) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("outlets not stored after polling")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if device := database.GetPDUDevice(ctx, "node", "3"); device == nil || !device.On {
+		t.Errorf("got outlet 3 %+v", device)
+	}
+	if state := componentState("http/node"); state != status.StateUp {
+		t.Errorf("got status %v, want up", state)
+	}
+	pdu.lock.Lock()
+	defer pdu.lock.Unlock()
+	if pdu.auth[0] != "admin:secret" {
+		t.Errorf("got basic auth %v", pdu.auth[0])
+	}
+}
+
+func TestHTTPCollectorSendCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	pdu := &fakeHTTPPDU{state: string(deviceGroupPayload(2, 4))}
+	collector := newTestHTTPCollector(t, pdu)
+	if err := collector.fetchState(ctx, collector.devices["node"]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command *entity.Command
+		want    *ControlDeviceReq
+		wantErr bool
+	}{
+		{&entity.Command{NodeID: "node", DeviceID: "6", Type: "switch", Command: "ON"}, &ControlDeviceReq{GroupID: 2, DeviceID: 2, Action: 3}, false},
+		{&entity.Command{NodeID: "node", DeviceID: "1", Type: "switch", Command: "OFF"}, &ControlDeviceReq{GroupID: 1, DeviceID: 1, Action: 2}, false},
+		{&entity.Command{NodeID: "node", DeviceID: "10", Type: "switch", Command: "ON"}, &ControlDeviceReq{GroupID: 3, DeviceID: 2, Action: 3}, false},
+		{&entity.Command{NodeID: "node", DeviceID: "x", Type: "switch", Command: "ON"}, nil, true},
+		{&entity.Command{NodeID: "other", DeviceID: "1", Type: "switch", Command: "ON"}, nil, false},
+	}
+	for _, tt := range tests {
+		pdu.lock.Lock()
+		pdu.controls = nil
+		pdu.lock.Unlock()
+		err := collector.SendCommand(ctx, tt.command)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v: got error %v, want error %v", tt.command, err, tt.wantErr)
+		}
+		pdu.lock.Lock()
+		controls := pdu.controls
+		pdu.lock.Unlock()
+		if tt.want == nil && len(controls) != 0 {
+			t.Errorf("%+v: unexpected control request %+v", tt.command, controls)
+		}
+		if tt.want != nil && (len(controls) != 1 || controls[0] != *tt.want) {
+			t.Errorf("%+v: got control requests %+v, want %+v", tt.command, controls, *tt.want)
+		}
+	}
+}
+
+func TestHTTPCollectorFetchErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tests := []struct {
+		name       string
+		pdu        *fakeHTTPPDU
+		wantDecode bool
+		wantErr    string
+		wantStored int
+	}{
+		{"server error", &fakeHTTPPDU{status: http.StatusInternalServerError, state: "busy"}, false,
+			"GET /api/state returned 500 Internal Server Error: busy", 0},
+		{"not json", &fakeHTTPPDU{state: "<html></html>"}, true, "decode payload failed: $: ", 0},
+		{"invalid outlet", &fakeHTTPPDU{state: `{"devices":[{"id":1,"type":1,"subdevs":[{"id":1,"type":1,"on":1},{"id":0,"type":1,"on":1}]}]}`},
+			true, "decode payload failed: ", 1},
+	}
+	for _, tt := range tests {
+		database.Init(ctx)
+		collector := newTestHTTPCollector(t, tt.pdu)
+		err := collector.fetchState(ctx, collector.devices["node"])
+		var decodeErr *DecodeError
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) || errors.As(err, &decodeErr) != tt.wantDecode {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if stored := len(database.GetPDUNodeDevices(ctx, "node")); stored != tt.wantStored {
+			t.Errorf("%v: got %v stored outlets, want %v", tt.name, stored, tt.wantStored)
+		}
+	}
+}
+
+func componentState(name string) string {
+	for _, component := range status.GetAll() {
+		if component.Name == name {
+			return component.State
+		}
+	}
+	return ""
+}
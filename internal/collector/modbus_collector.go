@@ -0,0 +1,377 @@
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+const (
+	modbusTableCoil          = "coil"
+	modbusTableDiscreteInput = "discrete_input"
+	modbusTableHolding       = "holding"
+	modbusTableInput         = "input"
+)
+
+// modbusRegisterCounts 每种数据类型占用的寄存器数
+var modbusRegisterCounts = map[string]uint16{
+	"uint16":  1,
+	"int16":   1,
+	"uint32":  2,
+	"int32":   2,
+	"float32": 2,
+}
+
+// ModbusCollector 按固定间隔读取每台设备的寄存器表，插座的全局ID即寄存器表中配置的ID
+type ModbusCollector struct {
+	name    string
+	config  entity.ModbusCollectorConfig
+	devices map[string]*modbusDevice // 节点ID->设备
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type modbusDevice struct {
+	config  *entity.ModbusDeviceConfig
+	model   *entity.ModbusModelConfig
+	outlets map[string]*entity.ModbusOutletConfig // 插座ID->插座
+	handler *modbus.TCPClientHandler
+	client  modbus.Client
+}
+
+func (collector *ModbusCollector) setup(config *entity.CollectorConfig) error {
+	if config.Modbus == nil {
+		return fmt.Errorf("modbus is required")
+	}
+	collector.name = config.Name
+	collector.config = *config.Modbus
+	if collector.config.Interval <= 0 {
+		collector.config.Interval = defaultPollInterval
+	}
+	if collector.config.Timeout <= 0 {
+		collector.config.Timeout = defaultPollTimeout
+	}
+	if len(collector.config.Devices) == 0 {
+		return fmt.Errorf("modbus.devices is required")
+	}
+	models := make(map[string]*entity.ModbusModelConfig, len(collector.config.Models))
+	for name, modelConfig := range collector.config.Models {
+		model, err := newModbusModel(modelConfig)
+		if err != nil {
+			return fmt.Errorf("modbus.models.%v.%v", name, err)
+		}
+		models[name] = model
+	}
+
+	collector.devices = make(map[string]*modbusDevice, len(collector.config.Devices))
+	for i, deviceConfig := range collector.config.Devices {
+		if deviceConfig.NodeID == "" || collector.devices[deviceConfig.NodeID] != nil {
+			return fmt.Errorf("modbus.devices[%v].node_id %q is empty or duplicated", i, deviceConfig.NodeID)
+		}
+		model, ok := models[deviceConfig.Model]
+		if !ok {
+			return fmt.Errorf("modbus.devices[%v].model %q not found in models", i, deviceConfig.Model)
+		}
+		address := deviceConfig.Address
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "502")
+		}
+		handler := modbus.NewTCPClientHandler(address)
+		handler.SlaveId = deviceConfig.SlaveID
+		handler.Timeout = collector.config.Timeout
+		if deviceConfig.Timeout > 0 {
+			handler.Timeout = deviceConfig.Timeout
+		}
+		handler.IdleTimeout = 2 * collector.config.Interval
+
+		device := &modbusDevice{
+			config:  deviceConfig,
+			model:   model,
+			outlets: make(map[string]*entity.ModbusOutletConfig, len(model.Outlets)),
+			handler: handler,
+			client:  modbus.NewClient(handler),
+		}
+		for _, outlet := range model.Outlets {
+			device.outlets[outlet.ID] = outlet
+		}
+		collector.devices[deviceConfig.NodeID] = device
+	}
+	return nil
+}
+
+func (collector *ModbusCollector) Run(ctx context.Context, config *entity.CollectorConfig) error {
+	if err := collector.setup(config); err != nil {
+		return fmt.Errorf("Collector.Modbus: %v", err)
+	}
+
+	ctx, collector.cancel = context.WithCancel(ctx)
+	for nodeId, device := range collector.devices {
+		status.Set(deviceStatusName(collector.name, nodeId), status.StateConnecting, nil)
+		collector.wg.Add(1)
+		go collector.poll(ctx, device)
+	}
+	slog.Info("Collector.Modbus: initialized", "devices", len(collector.devices), "interval", collector.config.Interval)
+	return nil
+}
+
+// newModbusModel 复制型号配置并填充寄存器默认值，不修改共享的配置
+func newModbusModel(config *entity.ModbusModelConfig) (*entity.ModbusModelConfig, error) {
+	model := &entity.ModbusModelConfig{Outlets: make([]*entity.ModbusOutletConfig, 0, len(config.Outlets))}
+	if config.Inlet == nil && len(config.Outlets) == 0 {
+		return nil, fmt.Errorf("inlet or outlets is required")
+	}
+	var err error
+	if config.Inlet != nil {
+		inlet := *config.Inlet
+		model.Inlet = &inlet
+		for _, register := range []struct {
+			path  string
+			value **entity.ModbusRegisterConfig
+		}{
+			{"inlet.voltage", &inlet.Voltage},
+			{"inlet.current", &inlet.Current},
+			{"inlet.power", &inlet.Power},
+			{"inlet.energy", &inlet.Energy},
+			{"inlet.factor", &inlet.Factor},
+			{"inlet.frequency", &inlet.Frequency},
+		} {
+			if *register.value, err = newModbusRegister(register.path, *register.value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ids := make(map[string]bool, len(config.Outlets))
+	for i, outletConfig := range config.Outlets {
+		if outletConfig.ID == "" || ids[outletConfig.ID] {
+			return nil, fmt.Errorf("outlets[%v].id %q is empty or duplicated", i, outletConfig.ID)
+		}
+		if outletConfig.State == nil {
+			return nil, fmt.Errorf("outlets[%v].state is required", i)
+		}
+		ids[outletConfig.ID] = true
+		outlet := *outletConfig
+		for _, register := range []struct {
+			name  string
+			value **entity.ModbusRegisterConfig
+		}{
+			{"state", &outlet.State},
+			{"voltage", &outlet.Voltage},
+			{"current", &outlet.Current},
+			{"power", &outlet.Power},
+			{"energy", &outlet.Energy},
+		} {
+			path := fmt.Sprintf("outlets[%v].%v", i, register.name)
+			if *register.value, err = newModbusRegister(path, *register.value); err != nil {
+				return nil, err
+			}
+		}
+		model.Outlets = append(model.Outlets, &outlet)
+	}
+	return model, nil
+}
+
+// newModbusRegister 返回填充了默认值的寄存器配置副本，未配置的寄存器返回nil
+func newModbusRegister(path string, config *entity.ModbusRegisterConfig) (*entity.ModbusRegisterConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+	register := *config
+	switch register.Table {
+	case "":
+		register.Table = modbusTableHolding
+	case modbusTableCoil, modbusTableDiscreteInput, modbusTableHolding, modbusTableInput:
+	default:
+		return nil, fmt.Errorf("%v.table %q is invalid", path, register.Table)
+	}
+	if register.DataType == "" {
+		register.DataType = "uint16"
+	}
+	if _, ok := modbusRegisterCounts[register.DataType]; !ok {
+		return nil, fmt.Errorf("%v.data_type %q is invalid", path, register.DataType)
+	}
+	if register.Scale == 0 {
+		register.Scale = 1
+	}
+	return &register, nil
+}
+
+func (collector *ModbusCollector) Stop(ctx context.Context) {
+	if collector.cancel != nil {
+		collector.cancel()
+		collector.wg.Wait()
+	}
+	for _, device := range collector.devices {
+		_ = device.handler.Close()
+	}
+	for nodeId := range collector.devices {
+		status.Remove(deviceStatusName(collector.name, nodeId))
+	}
+	slog.Info("Collector.Modbus: stopped")
+}
+
+func (collector *ModbusCollector) poll(ctx context.Context, device *modbusDevice) {
+	defer collector.wg.Done()
+	ticker := time.NewTicker(collector.config.Interval)
+	defer ticker.Stop()
+	for {
+		err := collector.fetchState(ctx, device)
+		if err != nil {
+			slog.Error("Collector.Modbus: poll failed", "nodeId", device.config.NodeID, "address", device.config.Address, "err", err)
+		}
+		reportPollState(ctx, collector.name, device.config.NodeID, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchState 单个寄存器读取失败时该测量值为nil，插座状态读取失败时跳过该插座
+func (collector *ModbusCollector) fetchState(ctx context.Context, device *modbusDevice) error {
+	nodeId := device.config.NodeID
+	var firstErr error
+	read := func(register *entity.ModbusRegisterConfig) *float32 {
+		if register == nil {
+			return nil
+		}
+		value, err := device.read(register)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return nil
+		}
+		return &value
+	}
+
+	for _, outlet := range device.model.Outlets {
+		state := read(outlet.State)
+		if state == nil {
+			continue
+		}
+		name := outlet.Name
+		if name == "" {
+			name = fmt.Sprintf("插座%v", outlet.ID)
+		}
+		pduDevice := &entity.PDUDevice{
+			NodeID:  nodeId,
+			ID:      outlet.ID,
+			GroupID: "1",
+			Name:    name,
+			On:      *state != 0,
+			Voltage: read(outlet.Voltage),
+			Current: read(outlet.Current),
+			Power:   read(outlet.Power),
+			Energy:  read(outlet.Energy),
+		}
+		database.SetPUDDevice(ctx, nodeId, pduDevice.ID, pduDevice)
+	}
+
+	if inlet := device.model.Inlet; inlet != nil {
+		pduGroup := &entity.PDUGroup{
+			NodeID:       nodeId,
+			ID:           "1",
+			Name:         "输入",
+			Voltage:      read(inlet.Voltage),
+			TotalCurrent: read(inlet.Current),
+			Power:        read(inlet.Power),
+			Energy:       read(inlet.Energy),
+			Factor:       read(inlet.Factor),
+			Frequency:    read(inlet.Frequency),
+			Alarms:       []string{},
+		}
+		database.SetPDUGroup(ctx, nodeId, pduGroup.ID, pduGroup)
+	}
+	return firstErr
+}
+
+// SendCommand 只处理本采集器轮询的节点，其它节点由别的采集器负责
+func (collector *ModbusCollector) SendCommand(ctx context.Context, command *entity.Command) error {
+	device, ok := collector.devices[command.NodeID]
+	if !ok {
+		return nil
+	}
+	outlet, ok := device.outlets[command.DeviceID]
+	if !ok {
+		return fmt.Errorf("Collector.Modbus: SendCommand, unknown device id %q", command.DeviceID)
+	}
+	if outlet.ControlCoil == nil {
+		return fmt.Errorf("Collector.Modbus: SendCommand, outlet %v has no control_coil", outlet.ID)
+	}
+	var value uint16 = 0x0000
+	if command.Command == "ON" {
+		value = 0xFF00
+	}
+	if _, err := device.client.WriteSingleCoil(*outlet.ControlCoil, value); err != nil {
+		return fmt.Errorf("Collector.Modbus: SendCommand failed, %v", err)
+	}
+	return nil
+}
+
+func (device *modbusDevice) read(register *entity.ModbusRegisterConfig) (float32, error) {
+	switch register.Table {
+	case modbusTableCoil, modbusTableDiscreteInput:
+		var results []byte
+		var err error
+		if register.Table == modbusTableCoil {
+			results, err = device.client.ReadCoils(register.Address, 1)
+		} else {
+			results, err = device.client.ReadDiscreteInputs(register.Address, 1)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read %v %v failed, %v", register.Table, register.Address, err)
+		}
+		if len(results) < 1 {
+			return 0, fmt.Errorf("read %v %v failed, empty response", register.Table, register.Address)
+		}
+		return float32(results[0] & 1), nil
+	}
+
+	count := modbusRegisterCounts[register.DataType]
+	var results []byte
+	var err error
+	if register.Table == modbusTableInput {
+		results, err = device.client.ReadInputRegisters(register.Address, count)
+	} else {
+		results, err = device.client.ReadHoldingRegisters(register.Address, count)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read %v %v failed, %v", register.Table, register.Address, err)
+	}
+	if len(results) < int(count)*2 {
+		return 0, fmt.Errorf("read %v %v failed, short response", register.Table, register.Address)
+	}
+	return decodeModbusRegisters(results, register) * register.Scale, nil
+}
+
+func decodeModbusRegisters(data []byte, register *entity.ModbusRegisterConfig) float32 {
+	switch register.DataType {
+	case "int16":
+		return float32(int16(binary.BigEndian.Uint16(data)))
+	case "uint32", "int32", "float32":
+		high, low := binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+		if register.SwapWords {
+			high, low = low, high
+		}
+		raw := uint32(high)<<16 | uint32(low)
+		switch register.DataType {
+		case "int32":
+			return float32(int32(raw))
+		case "float32":
+			return math.Float32frombits(raw)
+		}
+		return float32(raw)
+	}
+	return float32(binary.BigEndian.Uint16(data))
+}
@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+func TestDecodeModbusRegisters(t *testing.T) {
+	float := math.Float32bits(-12.5)
+	tests := []struct {
+		dataType  string
+		swapWords bool
+		data      []byte
+		want      float32
+	}{
+		{"uint16", false, []byte{0xFF, 0xFE}, 65534},
+		{"int16", false, []byte{0xFF, 0xFE}, -2},
+		{"uint32", false, []byte{0x00, 0x01, 0x00, 0x02}, 65538},
+		{"uint32", true, []byte{0x00, 0x02, 0x00, 0x01}, 65538},
+		{"int32", false, []byte{0xFF, 0xFF, 0xFF, 0xFE}, -2},
+		{"int32", true, []byte{0xFF, 0xFE, 0xFF, 0xFF}, -2},
+		{"float32", false, []byte{byte(float >> 24), byte(float >> 16), byte(float >> 8), byte(float)}, -12.5},
+		{"float32", true, []byte{byte(float >> 8), byte(float), byte(float >> 24), byte(float >> 16)}, -12.5},
+	}
+	for _, tt := range tests {
+		got := decodeModbusRegisters(tt.data, &entity.ModbusRegisterConfig{DataType: tt.dataType, SwapWords: tt.swapWords})
+		if got != tt.want {
+			t.Errorf("%v swap_words=%v % x: got %v, want %v", tt.dataType, tt.swapWords, tt.data, got, tt.want)
+		}
+	}
+}
+
+// fakeModbusServer 最小的Modbus TCP从站，只实现采集器用到的功能码
+type fakeModbusServer struct {
+	lock      sync.Mutex
+	coils     map[uint16]bool
+	holding   map[uint16]uint16
+	input     map[uint16]uint16
+	listener  net.Listener
+	coilWrite []uint16
+}
+
+func newFakeModbusServer(t *testing.T) *fakeModbusServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeModbusServer{
+		coils:    make(map[uint16]bool),
+		holding:  make(map[uint16]uint16),
+		input:    make(map[uint16]uint16),
+		listener: listener,
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeModbusServer) serve(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		response := server.handle(pdu)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(response)+1))
+		if _, err := conn.Write(append(append([]byte{}, header...), response...)); err != nil {
+			return
+		}
+	}
+}
+
+func (server *fakeModbusServer) handle(pdu []byte) []byte {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	function, address, quantity := pdu[0], binary.BigEndian.Uint16(pdu[1:]), binary.BigEndian.Uint16(pdu[3:])
+	switch function {
+	case 1, 2:
+		bits := make([]byte, (quantity+7)/8)
+		for i := range quantity {
+			if server.coils[address+i] {
+				bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{function, byte(len(bits))}, bits...)
+	case 3, 4:
+		registers := server.holding
+		if function == 4 {
+			registers = server.input
+		}
+		response := []byte{function, byte(quantity * 2)}
+		for i := range quantity {
+			response = binary.BigEndian.AppendUint16(response, registers[address+i])
+		}
+		return response
+	case 5:
+		server.coils[address] = quantity == 0xFF00
+		server.coilWrite = append(server.coilWrite, address)
+		return pdu
+	}
+	return []byte{function | 0x80, 1}
+}
+
+func TestModbusCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	server := newFakeModbusServer(t)
+	server.coils[0] = true
+	server.holding[100] = 2305                  // 230.5V，int16，系数0.1
+	server.holding[101] = uint16(0xFFFF)        // -1，int16
+	server.input[200], server.input[201] = 3, 1 // 低位字在前，0x0001_0003
+	frequency := math.Float32bits(50)           // 高位字在前
+	server.input[300], server.input[301] = uint16(frequency>>16), uint16(frequency)
+
+	coil := uint16(0)
+	collector := &ModbusCollector{}
+	err := collector.setup(&entity.CollectorConfig{Name: "modbus", Type: "modbus", Modbus: &entity.ModbusCollectorConfig{
+		Models: map[string]*entity.ModbusModelConfig{"meter": {
+			Inlet: &entity.ModbusInletConfig{
+				Voltage:   &entity.ModbusRegisterConfig{Address: 100, DataType: "int16", Scale: 0.1},
+				Frequency: &entity.ModbusRegisterConfig{Table: "input", Address: 300, DataType: "float32"},
+			},
+			Outlets: []*entity.ModbusOutletConfig{
+				{ID: "1", State: &entity.ModbusRegisterConfig{Table: "coil", Address: 0}, ControlCoil: &coil,
+					Current: &entity.ModbusRegisterConfig{Address: 101, DataType: "int16"},
+					Energy:  &entity.ModbusRegisterConfig{Table: "input", Address: 200, DataType: "uint32", SwapWords: true}},
+				{ID: "2", State: &entity.ModbusRegisterConfig{Table: "discrete_input", Address: 1}},
+			},
+		}},
+		Devices: []*entity.ModbusDeviceConfig{{NodeID: "node", Address: server.listener.Addr().String(), Model: "meter"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Stop(context.Background())
+
+	if err = collector.fetchState(ctx, collector.devices["node"]); err != nil {
+		t.Fatal(err)
+	}
+	outlet := database.GetPDUDevice(ctx, "node", "1")
+	if outlet == nil || !outlet.On || outlet.Current == nil || *outlet.Current != -1 || outlet.Energy == nil || *outlet.Energy != 65539 {
+		t.Errorf("got outlet 1 %+v", outlet)
+	}
+	if outlet = database.GetPDUDevice(ctx, "node", "2"); outlet == nil || outlet.On {
+		t.Errorf("got outlet 2 %+v", outlet)
+	}
+	groups := database.GetPDUNodeGroups(ctx, "node")
+	if len(groups) != 1 || groups[0].Voltage == nil || *groups[0].Voltage != 230.5 || groups[0].Frequency == nil || *groups[0].Frequency != 50 {
+		t.Errorf("got inlet %+v", groups)
+	}
+
+	if err = collector.SendCommand(ctx, &entity.Command{NodeID: "node", DeviceID: "1", Type: "switch", Command: "OFF"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = collector.SendCommand(ctx, &entity.Command{NodeID: "node", DeviceID: "2", Type: "switch", Command: "OFF"}); err == nil {
+		t.Error("outlet without control_coil should not be controllable")
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if len(server.coilWrite) != 1 || server.coils[0] {
+		t.Errorf("coil 0 should be switched off, writes %v", server.coilWrite)
+	}
+}
+
+func TestModbusCollectorSetupKeepsConfig(t *testing.T) {
+	config := &entity.CollectorConfig{Name: "modbus", Type: "modbus", Modbus: &entity.ModbusCollectorConfig{
+		Models: map[string]*entity.ModbusModelConfig{"meter": {
+			Inlet:   &entity.ModbusInletConfig{Voltage: &entity.ModbusRegisterConfig{Address: 100}},
+			Outlets: []*entity.ModbusOutletConfig{{ID: "1", State: &entity.ModbusRegisterConfig{Table: "coil"}}},
+		}},
+		Devices: []*entity.ModbusDeviceConfig{{NodeID: "node", Address: "127.0.0.1", Model: "meter"}},
+	}}
+	voltage, state := *config.Modbus.Models["meter"].Inlet.Voltage, *config.Modbus.Models["meter"].Outlets[0].State
+	for range 2 {
+		collector := &ModbusCollector{}
+		if err := collector.setup(config); err != nil {
+			t.Fatal(err)
+		}
+		model := collector.devices["node"].model
+		if register := model.Inlet.Voltage; register.Table != "holding" || register.DataType != "uint16" || register.Scale != 1 {
+			t.Errorf("got resolved voltage %+v", register)
+		}
+		if register := collector.devices["node"].outlets["1"].State; register.Table != "coil" || register.DataType != "uint16" {
+			t.Errorf("got resolved state %+v", register)
+		}
+	}
+	if *config.Modbus.Models["meter"].Inlet.Voltage != voltage || *config.Modbus.Models["meter"].Outlets[0].State != state {
+		t.Errorf("setup modified the shared model config: %+v", config.Modbus.Models["meter"])
+	}
+}
+
+func TestModbusCollectorSetupErrors(t *testing.T) {
+	state := &entity.ModbusRegisterConfig{Table: "coil"}
+	tests := []struct {
+		name    string
+		model   *entity.ModbusModelConfig
+		wantErr string
+	}{
+		{"empty model", &entity.ModbusModelConfig{}, "modbus.models.meter.inlet or outlets is required"},
+		{"duplicated outlet", &entity.ModbusModelConfig{Outlets: []*entity.ModbusOutletConfig{{ID: "1", State: state}, {ID: "1", State: state}}},
+			`modbus.models.meter.outlets[1].id "1" is empty or duplicated`},
+		{"missing state", &entity.ModbusModelConfig{Outlets: []*entity.ModbusOutletConfig{{ID: "1"}}}, "modbus.models.meter.outlets[0].state is required"},
+		{"invalid table", &entity.ModbusModelConfig{Inlet: &entity.ModbusInletConfig{Power: &entity.ModbusRegisterConfig{Table: "x"}}},
+			`modbus.models.meter.inlet.power.table "x" is invalid`},
+		{"invalid data type", &entity.ModbusModelConfig{Outlets: []*entity.ModbusOutletConfig{
+			{ID: "1", State: state, Energy: &entity.ModbusRegisterConfig{DataType: "uint64"}}}},
+			`modbus.models.meter.outlets[0].energy.data_type "uint64" is invalid`},
+	}
+	for _, tt := range tests {
+		collector := &ModbusCollector{}
+		err := collector.setup(&entity.CollectorConfig{Name: "modbus", Modbus: &entity.ModbusCollectorConfig{
+			Models:  map[string]*entity.ModbusModelConfig{"meter": tt.model},
+			Devices: []*entity.ModbusDeviceConfig{{NodeID: "node", Address: "127.0.0.1", Model: "meter"}},
+		}})
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -3,62 +3,84 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/url"
-	"strconv"
 	"strings"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/mqttclient"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/utils"
 )
 
 type MQTTCollector struct {
+	yespeedProtocol
+	name              string
 	connectionManager *autopaho.ConnectionManager
+	subscribeTopic    string
+	commandPublish    *entity.MQTTPublishConfig
+}
+
+// yespeedProtocol Yespeed的主题和消息格式，与消息通过哪种MQTT连接收发无关
+type yespeedProtocol struct {
+	yespeed      entity.YespeedConfig
+	messageTypes map[string]string // 消息ID->消息类型
+	layout       *outletLayout
+}
+
+func (collector *MQTTCollector) setup(config *entity.CollectorConfig) error {
+	if config.MQTT == nil {
+		return fmt.Errorf("mqtt is required")
+	}
+	if err := mqttclient.Validate(config.MQTT); err != nil {
+		return fmt.Errorf("mqtt.%v", err)
+	}
+	if err := collector.configure(config); err != nil {
+		return err
+	}
+	collector.name = config.Name
+	collector.commandPublish = config.MQTT.CommandPublish
+	collector.subscribeTopic = config.MQTT.Topic
+	if collector.subscribeTopic == "" {
+		collector.subscribeTopic = collector.topic("+", "out", "#")
+	}
+	return nil
 }
 
 func (collector *MQTTCollector) Run(ctx context.Context, config *entity.CollectorConfig) error {
-	u, err := url.Parse(config.MQTT.URL)
-	if err != nil {
-		return fmt.Errorf("Collector.MQTT: parse mqtt url failed: %v, %v", config.MQTT.URL, err)
+	var err error
+	if err = collector.setup(config); err != nil {
+		return fmt.Errorf("Collector.MQTT: %v", err)
 	}
 
-	router := paho.NewStandardRouter()
-	router.DefaultHandler(func(publish *paho.Publish) {
-		slog.Warn("Collector.MQTT: message received without hit any route", "topic", publish.Topic)
-	})
-	router.RegisterHandler("/yespeed/pdu/yespeed/+/out/1000000", queryDeviceGroupHandler)
-	//router.RegisterHandler("/yespeed/pdu/yespeed/+/out/1000101", sendCommandHandler)
+	router := collector.newRouter()
 
 	clientConfig := autopaho.ClientConfig{
-		ServerUrls:      []*url.URL{u},
-		KeepAlive:       config.MQTT.Keepalive,
-		ConnectUsername: config.MQTT.Username,
-		ConnectPassword: []byte(config.MQTT.Password),
-		// CleanStartOnInitialConnection defaults to false. Setting this to true will clear the session on the first connection.
-		CleanStartOnInitialConnection: false,
-		// SessionExpiryInterval - Seconds that a session will survive after disconnection.
-		// It is important to set this because otherwise, any queued messages will be lost if the connection drops and
-		// the server will not queue messages while it is down. The specific setting will depend upon your needs
-		// (60 = 1 minute, 3600 = 1 hour, 86400 = one day, 0xFFFFFFFE = 136 years, 0xFFFFFFFF = don't expire)
-		SessionExpiryInterval: 60,
 		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connAck *paho.Connack) {
 			slog.Info("Collector.MQTT: connected to server")
+			status.Set(collector.name, status.StateUp, nil)
 			if _, err = connectionManager.Subscribe(context.Background(), &paho.Subscribe{
 				Subscriptions: []paho.SubscribeOptions{
-					{Topic: config.MQTT.Topic, QoS: 1},
+					{Topic: collector.subscribeTopic, QoS: mqttclient.SubscribeQoS(config.MQTT)},
 				},
 			}); err != nil {
 				slog.Error("Collector.MQTT: subscribe failed", "err", err)
 				return
 			}
-			slog.Info("Collector.MQTT: subscribed to", "topic", config.MQTT.Topic)
+			slog.Info("Collector.MQTT: subscribed to", "topic", collector.subscribeTopic)
 		},
 		OnConnectError: func(err error) {
 			slog.Error("Collector.MQTT: connect failed", "err", err)
+			status.Set(collector.name, status.StateDown, err)
+		},
+		OnConnectionDown: func() bool {
+			slog.Warn("Collector.MQTT: connection down, reconnecting")
+			status.Set(collector.name, status.StateDown, nil)
+			return true
 		},
 		ClientConfig: paho.ClientConfig{
 			ClientID: config.MQTT.ClientID,
@@ -76,53 +98,127 @@ func (collector *MQTTCollector) Run(ctx context.Context, config *entity.Collecto
 				} else {
 					slog.Error("Collector.MQTT: server requested disconnect", "reasonCode", d.ReasonCode)
 				}
+				status.Set(collector.name, status.StateDown, fmt.Errorf("server requested disconnect, reason code %v", d.ReasonCode))
 			},
 		},
 	}
+	if err = mqttclient.Configure(&clientConfig, config.MQTT); err != nil {
+		return fmt.Errorf("Collector.MQTT: %v", err)
+	}
 
+	// 不等待连接建立，broker暂时不可用时以降级状态启动，由autopaho在后台重连
+	status.Set(collector.name, status.StateConnecting, nil)
 	collector.connectionManager, err = autopaho.NewConnection(ctx, clientConfig)
 	if err != nil {
 		return fmt.Errorf("Collector.MQTT: NewConnection failed, %v", err)
 	}
-	if err = collector.connectionManager.AwaitConnection(ctx); err != nil {
-		return fmt.Errorf("Collector.MQTT: AwaitConnection failed, %v", err)
-	}
-	slog.Info("Collector.MQTT: initialized", "server", config.MQTT.URL)
+	slog.Info("Collector.MQTT: initialized", "servers", clientConfig.ServerUrls)
 
 	return nil
 }
 
+// newRouter 按实际订阅的主题注册处理函数，自定义的订阅主题不会落入默认处理
+func (collector *MQTTCollector) newRouter() *paho.StandardRouter {
+	router := paho.NewStandardRouter()
+	router.DefaultHandler(func(publish *paho.Publish) {
+		slog.Warn("Collector.MQTT: message received without hit any route", "topic", publish.Topic)
+	})
+	router.RegisterHandler(collector.subscribeTopic, func(publish *paho.Publish) {
+		collector.handleMessage(context.Background(), "Collector.MQTT", publish.Topic, publish.Payload)
+	})
+	return router
+}
+
 func (collector *MQTTCollector) Stop(ctx context.Context) {
+	// 等待连接断开，重新加载时新的实例才能以相同的客户端ID连接
 	if collector.connectionManager != nil {
-		collector.connectionManager.Done()
+		if err := collector.connectionManager.Disconnect(ctx); err != nil {
+			slog.Warn("Collector.MQTT: disconnect failed", "err", err)
+		}
 	}
+	status.Remove(collector.name)
 	slog.Info("Collector.MQTT: stopped")
 }
 
-func (collector *MQTTCollector) SendCommand(ctx context.Context, command *entity.Command) {
-	deviceGlobalId, err := strconv.Atoi(command.DeviceID)
+func (collector *MQTTCollector) SendCommand(ctx context.Context, command *entity.Command) error {
+	topic, payloadBytes, err := collector.controlMessage(command)
 	if err != nil {
-		slog.Error("Collector.MQTT: SendCommand, parse device id failed", "err", err)
-		return
+		return fmt.Errorf("Collector.MQTT: SendCommand, %v", err)
+	}
+	publish := &paho.Publish{
+		Topic:   topic,
+		Payload: payloadBytes,
+	}
+	publish.QoS, publish.Retain = mqttclient.PublishOptions(collector.commandPublish, 0, false)
+	if publish.QoS > 0 {
+		// 断线期间命令进入队列，重连后由autopaho发送
+		err = collector.connectionManager.PublishViaQueue(ctx, &autopaho.QueuePublish{Publish: publish})
+	} else {
+		_, err = collector.connectionManager.Publish(ctx, publish)
+	}
+	if err != nil {
+		return fmt.Errorf("Collector.MQTT: SendCommand failed, %v", err)
+	}
+	return nil
+}
+
+// configure 按采集器配置初始化插座布局、主题前缀和消息ID
+func (collector *yespeedProtocol) configure(config *entity.CollectorConfig) error {
+	var err error
+	if collector.layout, err = newOutletLayout(config.Layout); err != nil {
+		return err
+	}
+
+	collector.yespeed = entity.YespeedConfig{
+		TopicPrefix:      "/yespeed/pdu",
+		Vendor:           "yespeed",
+		ReportMessageID:  "1000000",
+		ControlMessageID: "1000101",
 	}
+	if config.Yespeed != nil {
+		if config.Yespeed.TopicPrefix != "" {
+			collector.yespeed.TopicPrefix = strings.TrimSuffix(config.Yespeed.TopicPrefix, "/")
+		}
+		if config.Yespeed.Vendor != "" {
+			collector.yespeed.Vendor = config.Yespeed.Vendor
+		}
+		if config.Yespeed.ReportMessageID != "" {
+			collector.yespeed.ReportMessageID = config.Yespeed.ReportMessageID
+		}
+		if config.Yespeed.ControlMessageID != "" {
+			collector.yespeed.ControlMessageID = config.Yespeed.ControlMessageID
+		}
+	}
+	collector.messageTypes = map[string]string{
+		collector.yespeed.ReportMessageID:  MessageTypeDeviceGroup,
+		collector.yespeed.ControlMessageID: MessageTypeControlResponse,
+	}
+	if config.Yespeed != nil {
+		for messageType, messageID := range config.Yespeed.MessageIDs {
+			if _, ok := yespeedMessageParsers[messageType]; !ok {
+				return fmt.Errorf("yespeed.message_ids.%v is not a known message type", messageType)
+			}
+			collector.messageTypes[messageID] = messageType
+		}
+	}
+	return nil
+}
+
+// controlMessage 生成控制插座开关的主题和载荷
+func (collector *yespeedProtocol) controlMessage(command *entity.Command) (string, []byte, error) {
 	var req ControlDeviceReq
-	req.GroupID, req.DeviceID = deconstructionGlobalId(deviceGlobalId)
+	var err error
+	req.GroupID, req.DeviceID, err = collector.layout.address(command.NodeID, command.DeviceID)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse device id failed, %v", err)
+	}
 	if command.Command == "ON" {
 		req.Action = 3
 	} else {
 		req.Action = 2
 	}
-
 	payloadBytes, _ := json.Marshal(req)
-	_, err = collector.connectionManager.Publish(ctx, &paho.Publish{
-		QoS:     0,
-		Retain:  false,
-		Topic:   fmt.Sprintf("/yespeed/pdu/yespeed/%v/in/1000101", command.NodeID),
-		Payload: payloadBytes,
-	})
-	if err != nil {
-		slog.Error("Collector.MQTT: SendCommand failed", "err", err)
-	}
+	return collector.topic(command.NodeID, "in", collector.yespeed.ControlMessageID), payloadBytes, nil
 }
 
 type DeviceGroupMessage struct {
@@ -130,39 +226,46 @@ type DeviceGroupMessage struct {
 }
 
 type DeviceGroup struct {
-	ID           int         `json:"id"` // 设备组标识号
+	ID           FlexValue   `json:"id"` // 设备组标识号
 	VID          int         `json:"vid"`
-	Type         any         `json:"type"` // 设备组类型，1->插座类设备组，2->空调类设备组
+	Type         FlexValue   `json:"type"` // 设备组类型，1->插座类设备组，2->空调类设备组
 	Slave        int         `json:"slave"`
 	Name         string      `json:"name"`     // 设备组名称
-	Voltage      string      `json:"voltage"`  // 设备组的当前电压
-	TotalCurrent string      `json:"tcurrent"` // 设备组的当前总电流
-	Power        int         `json:"power"`    // 设备组当前功率
-	Freq         string      `json:"freq"`     // 设备组当前频率
-	Factor       string      `json:"factor"`
-	Energy       string      `json:"energy"` // 设备组当前电量
-	Thresmask    int         `json:"thresmask"`
+	Voltage      FlexValue   `json:"voltage"`  // 设备组的当前电压
+	TotalCurrent FlexValue   `json:"tcurrent"` // 设备组的当前总电流
+	Power        FlexValue   `json:"power"`    // 设备组当前功率
+	Freq         FlexValue   `json:"freq"`     // 设备组当前频率
+	Factor       FlexValue   `json:"factor"`
+	Energy       FlexValue   `json:"energy"` // 设备组当前电量
+	Thresmask    FlexValue   `json:"thresmask"`
 	HW           int         `json:"hw"`
 	SubDevices   []SubDevice `json:"subdevs"` // 设备组下的子设备
 	DeviceName   string      `json:"deviceName"`
+
+	// 以下字段仅空调类设备组上报
+	On          FlexValue `json:"on"`      // 空调开关状态，1->打开，0->关闭
+	Mode        FlexValue `json:"mode"`    // 运行模式，0->自动，1->制冷，2->除湿，3->送风，4->制热
+	SetTemp     FlexValue `json:"settemp"` // 设定温度
+	Fan         FlexValue `json:"fan"`     // 风速，0->自动，1->低，2->中，3->高
+	Temperature FlexValue `json:"temp"`    // 当前环境温度
 }
 
 type SubDevice struct {
-	ID          int    `json:"id"`   // 设备标识
-	Type        int    `json:"type"` // 设备类型，1->插座设备
-	On          int    `json:"on"`   // 设备的开关状态，1->打开，0->关闭
-	Name        string `json:"name"` // 设备名称
-	Icon        string `json:"icon"` // 设备图标
-	VID         int    `json:"vid"`
-	Rintv       int    `json:"rintv"`   // 重启间隔，从关到开的延迟时间
-	Dintv       int    `json:"dintv"`   // 延时动作时间
-	Who         string `json:"who"`     // 最后一次操作，来源于哪个接口
-	Action      string `json:"act"`     // 最后一次操作的动作
-	Time        string `json:"tim"`     // 最后一次操作的时间
-	Description string `json:"det"`     // 最后一次操作的描述
-	Current     string `json:"current"` // 设备当前电流
-	Power       string `json:"power"`   // 设备当前功率
-	Energy      string `json:"energy"`  // 设备当前电量
+	ID          FlexValue `json:"id"`   // 设备标识
+	Type        FlexValue `json:"type"` // 设备类型，1->插座设备
+	On          FlexValue `json:"on"`   // 设备的开关状态，1->打开，0->关闭
+	Name        string    `json:"name"` // 设备名称
+	Icon        string    `json:"icon"` // 设备图标
+	VID         int       `json:"vid"`
+	Rintv       int       `json:"rintv"`   // 重启间隔，从关到开的延迟时间
+	Dintv       int       `json:"dintv"`   // 延时动作时间
+	Who         string    `json:"who"`     // 最后一次操作，来源于哪个接口
+	Action      string    `json:"act"`     // 最后一次操作的动作
+	Time        string    `json:"tim"`     // 最后一次操作的时间
+	Description string    `json:"det"`     // 最后一次操作的描述
+	Current     FlexValue `json:"current"` // 设备当前电流
+	Power       FlexValue `json:"power"`   // 设备当前功率
+	Energy      FlexValue `json:"energy"`  // 设备当前电量
 }
 
 type ControlDeviceReq struct {
@@ -171,48 +274,70 @@ type ControlDeviceReq struct {
 	Action   int `json:"actid"`
 }
 
-func queryDeviceGroupHandler(publish *paho.Publish) {
-	ctx := context.Background()
-
-	nodeID := "unknown"
-	topicSeg := strings.Split(publish.Topic, "/")
-	if len(topicSeg) == 7 && topicSeg[4] != "" {
-		nodeID = topicSeg[4]
-	}
-
-	messageBytes := append([]byte{'{'}, publish.Payload...)
-	messageBytes = append(messageBytes, '}')
-	var message DeviceGroupMessage
-	if err := json.Unmarshal(messageBytes, &message); err != nil {
-		slog.Error("Collector.MQTT: DeviceGroupMessage unmarshal failed", "err", err)
-	}
-	for _, switchGroup := range message.Devices {
-		for _, _switch := range switchGroup.SubDevices {
-			pduDevice := entity.PDUDevice{
-				NodeID:    nodeID,
-				ID:        fmt.Sprintf("%v", calculateGlobalId(switchGroup.ID, _switch.ID)),
-				Name:      _switch.Name,
-				Voltage:   utils.ParseFloat32OrZero(switchGroup.Voltage),
-				Current:   utils.ParseFloat32OrZero(_switch.Current),
-				Power:     utils.ParseFloat32OrZero(_switch.Power),
-				Energy:    utils.ParseFloat32OrZero(_switch.Energy),
-				Factor:    utils.ParseFloat32OrZero(switchGroup.Factor), // 读上来都是0
-				Frequency: utils.ParseFloat32OrZero(switchGroup.Freq),
-			}
-			if _switch.On == 1 {
-				pduDevice.On = true
-			}
-			database.SetPUDDevice(ctx, pduDevice.NodeID, pduDevice.ID, &pduDevice)
+// topic 按配置拼接PDU的MQTT主题
+func (collector *yespeedProtocol) topic(nodeID string, direction string, messageID string) string {
+	return fmt.Sprintf("%v/%v/%v/%v/%v", collector.yespeed.TopicPrefix, collector.yespeed.Vendor, nodeID, direction, messageID)
+}
+
+// parseTopic 从{topic_prefix}/{vendor}/{节点ID}/out/{消息ID}中取出节点ID和消息ID
+func (collector *yespeedProtocol) parseTopic(topic string) (string, string) {
+	rest, ok := strings.CutPrefix(topic, collector.yespeed.TopicPrefix+"/"+collector.yespeed.Vendor+"/")
+	if !ok {
+		return "unknown", ""
+	}
+	topicSeg := strings.Split(rest, "/")
+	if len(topicSeg) != 3 || topicSeg[0] == "" {
+		return "unknown", ""
+	}
+	return topicSeg[0], topicSeg[2]
+}
+
+// handleMessage 按消息ID分发到对应的解析器，未注册的消息ID进入未知消息采样
+func (collector *yespeedProtocol) handleMessage(ctx context.Context, logPrefix string, topic string, payload []byte) {
+	nodeID, messageID := collector.parseTopic(topic)
+	messageType, ok := collector.messageTypes[messageID]
+	if !ok {
+		recordUnknownMessage(messageID, topic, payload)
+		return
+	}
+	if err := yespeedMessageParsers[messageType](ctx, collector.layout, nodeID, payload); err != nil {
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			slog.Error(logPrefix+": message validation failed", "type", messageType, "topic", topic,
+				"errors", decodeErr.Errors, "payload", decodeErr.Payload)
+			return
 		}
+		slog.Error(logPrefix+": parse message failed", "type", messageType, "topic", topic,
+			"err", err, "payload", utils.Truncate(string(payload), unknownMessageSampleSize))
 	}
 }
 
-func calculateGlobalId(groupId int, deviceId int) int {
-	return (groupId-1)*4 + deviceId
+func parseDeviceGroupMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	report, err := decodeDeviceGroupMessage(layout, nodeID, payload)
+	for _, pduDevice := range report.Devices {
+		database.SetPUDDevice(ctx, pduDevice.NodeID, pduDevice.ID, pduDevice)
+	}
+	for _, pduGroup := range report.Groups {
+		database.SetPDUGroup(ctx, pduGroup.NodeID, pduGroup.ID, pduGroup)
+	}
+	for _, acDevice := range report.ACDevices {
+		database.SetACDevice(ctx, acDevice.NodeID, ACDeviceKey(acDevice.ID), acDevice)
+	}
+	return err
 }
 
-func deconstructionGlobalId(globalId int) (int, int) {
-	groupId := (globalId-1)/4 + 1
-	deviceId := globalId % 4
-	return groupId, deviceId
+// ACDeviceKey 空调在数据库中的键，避免与插座的全局ID冲突
+func ACDeviceKey(groupId string) string {
+	return "ac_" + groupId
+}
+
+// decodeThresmask 把PDU上报的阈值告警位按从低到高的顺序解析为bitN，协议未说明每一位的含义
+func decodeThresmask(thresmask uint32) []string {
+	result := make([]string, 0)
+	for bit := range 32 {
+		if thresmask&(1<<bit) != 0 {
+			result = append(result, fmt.Sprintf("bit%v", bit))
+		}
+	}
+	return result
 }
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+func TestMQTTCollectorRoutesSubscribedTopic(t *testing.T) {
+	tests := []struct {
+		name      string
+		subscribe string
+		topic     string
+	}{
+		{"default", "", "/yespeed/pdu/yespeed/node/out/9000001"},
+		{"single node", "/yespeed/pdu/yespeed/node/out/#", "/yespeed/pdu/yespeed/node/out/9000002"},
+		{"shared subscription", "$share/gateway//yespeed/pdu/yespeed/+/out/+", "/yespeed/pdu/yespeed/node/out/9000003"},
+		{"custom topic", "site/+/+/+/out/+", "site/a/yespeed/node/out/9000004"},
+	}
+	for _, tt := range tests {
+		collector := &MQTTCollector{}
+		err := collector.setup(&entity.CollectorConfig{
+			Name: "mqtt",
+			MQTT: &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", ClientID: "test", Topic: tt.subscribe},
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		routed := countUnknownTopic(tt.topic)
+		collector.newRouter().Route(&packets.Publish{Topic: tt.topic, Payload: []byte("{}"), Properties: &packets.Properties{}})
+		if got := countUnknownTopic(tt.topic); got != routed+1 {
+			t.Errorf("%v: message on %v did not reach the handler", tt.name, tt.topic)
+		}
+	}
+}
+
+// countUnknownTopic 未注册的消息ID会进入未知消息采样，用来判断消息是否到达了处理函数
+func countUnknownTopic(topic string) int {
+	count := 0
+	for _, message := range GetUnknownMessages(context.Background()) {
+		for _, sample := range message.Topics {
+			if sample == topic {
+				count += message.Count
+			}
+		}
+	}
+	return count
+}
+
+// TestMQTTCollectorUnreachableBroker broker不可用时采集器以降级状态启动，不返回错误
+func TestMQTTCollectorUnreachableBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = Init(ctx, []*entity.CollectorConfig{{
+		Name: "unreachable",
+		Type: "mqtt",
+		MQTT: &entity.MQTTConfig{URL: "mqtt://" + address, ClientID: "test", ConnectTimeout: time.Second, ReconnectMinDelay: time.Second},
+	}})
+	if err != nil {
+		t.Fatalf("collector should start degraded, got %v", err)
+	}
+	defer func() {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+		defer stopCancel()
+		Stop(stopCtx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		component := findComponent("unreachable")
+		if component == nil {
+			t.Fatal("collector status is not reported")
+		}
+		if component.State == status.StateDown && component.Error != "" {
+			break
+		}
+		if component.State != status.StateConnecting && component.State != status.StateDown {
+			t.Fatalf("got state %+v", component)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for connect error, got %+v", component)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func findComponent(name string) *entity.ComponentStatus {
+	for _, component := range status.GetAll() {
+		if component.Name == name {
+			return component
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+const (
+	defaultOutletsPerGroup = 4
+)
+
+type outletAddress struct {
+	GroupID  int `json:"group_id"`
+	DeviceID int `json:"device_id"`
+}
+
+// outletLayout 维护每个节点上插座全局ID与(设备组, 组内序号)的映射，
+// 已分配的ID会持久化，之后设备组扩容也不会改变已有插座的ID
+type outletLayout struct {
+	lock            sync.Mutex
+	stateFile       string
+	outletsPerGroup int
+	nodeOverrides   map[string]int
+	observed        map[string]int                      // 节点上观察到的最大组内序号
+	nodes           map[string]map[string]outletAddress // 节点->全局ID->地址
+	reverse         map[string]map[outletAddress]string // 节点->地址->全局ID
+}
+
+func newOutletLayout(config *entity.OutletLayoutConfig) (*outletLayout, error) {
+	layout := &outletLayout{
+		outletsPerGroup: defaultOutletsPerGroup,
+		nodeOverrides:   make(map[string]int),
+		observed:        make(map[string]int),
+		nodes:           make(map[string]map[string]outletAddress),
+		reverse:         make(map[string]map[outletAddress]string),
+	}
+	if config == nil {
+		return layout, nil
+	}
+	if config.OutletsPerGroup > 0 {
+		layout.outletsPerGroup = config.OutletsPerGroup
+	}
+	for nodeId, outletsPerGroup := range config.Nodes {
+		if outletsPerGroup <= 0 {
+			return nil, fmt.Errorf("layout.nodes.%v must be positive", nodeId)
+		}
+		layout.nodeOverrides[nodeId] = outletsPerGroup
+	}
+
+	layout.stateFile = config.StateFile
+	if layout.stateFile == "" {
+		return layout, nil
+	}
+	stateBytes, err := os.ReadFile(layout.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return layout, nil
+		}
+		return nil, fmt.Errorf("read layout state file %v failed, %v", layout.stateFile, err)
+	}
+	if err = json.Unmarshal(stateBytes, &layout.nodes); err != nil {
+		return nil, fmt.Errorf("unmarshal layout state file %v failed, %v", layout.stateFile, err)
+	}
+	for nodeId, outlets := range layout.nodes {
+		layout.reverse[nodeId] = make(map[outletAddress]string, len(outlets))
+		for globalId, address := range outlets {
+			layout.reverse[nodeId][address] = globalId
+		}
+	}
+	return layout, nil
+}
+
+// observe 记录遥测中出现的组内序号，用于推导每组插座数
+func (layout *outletLayout) observe(nodeId string, deviceId int) {
+	layout.lock.Lock()
+	defer layout.lock.Unlock()
+	if deviceId > layout.observed[nodeId] {
+		layout.observed[nodeId] = deviceId
+	}
+}
+
+func (layout *outletLayout) nodeOutletsPerGroup(nodeId string) int {
+	result := layout.outletsPerGroup
+	if override, ok := layout.nodeOverrides[nodeId]; ok {
+		result = override
+	}
+	return max(result, layout.observed[nodeId])
+}
+
+// globalId 返回插座的全局ID，首次出现时优先分配(groupId-1)*每组插座数+deviceId，被占用则顺延
+// 只能在设备组遥测中observe之后调用，此时每组插座数已由整条消息推导，分配结果与其它消息的到达顺序无关
+func (layout *outletLayout) globalId(nodeId string, groupId int, deviceId int) (string, error) {
+	if groupId < 1 || deviceId < 1 {
+		return "", fmt.Errorf("invalid outlet address, devid %v, linid %v", groupId, deviceId)
+	}
+	address := outletAddress{GroupID: groupId, DeviceID: deviceId}
+	layout.lock.Lock()
+	defer layout.lock.Unlock()
+	if globalId, ok := layout.reverse[nodeId][address]; ok {
+		return globalId, nil
+	}
+
+	outlets, ok := layout.nodes[nodeId]
+	if !ok {
+		outlets = make(map[string]outletAddress)
+		layout.nodes[nodeId] = outlets
+		layout.reverse[nodeId] = make(map[outletAddress]string)
+	}
+	candidate := (groupId-1)*layout.nodeOutletsPerGroup(nodeId) + deviceId
+	for {
+		if _, ok := outlets[strconv.Itoa(candidate)]; !ok {
+			break
+		}
+		candidate++
+	}
+	globalId := strconv.Itoa(candidate)
+	outlets[globalId] = address
+	layout.reverse[nodeId][address] = globalId
+	slog.Info("Collector: outlet global id assigned", "nodeId", nodeId, "groupId", groupId, "deviceId", deviceId, "globalId", globalId)
+	layout.save()
+	return globalId, nil
+}
+
+// lookupGlobalId 控制响应、告警等非遥测消息只查询已分配的全局ID，不会分配新的ID
+func (layout *outletLayout) lookupGlobalId(nodeId string, groupId int, deviceId int) (string, error) {
+	if groupId < 1 || deviceId < 1 {
+		return "", fmt.Errorf("invalid outlet address, devid %v, linid %v", groupId, deviceId)
+	}
+	layout.lock.Lock()
+	defer layout.lock.Unlock()
+	if globalId, ok := layout.reverse[nodeId][outletAddress{GroupID: groupId, DeviceID: deviceId}]; ok {
+		return globalId, nil
+	}
+	return "", fmt.Errorf("outlet devid %v, linid %v has not been reported in telemetry yet", groupId, deviceId)
+}
+
+// address 全局ID转回(设备组, 组内序号)，未见过的ID按每组插座数计算
+func (layout *outletLayout) address(nodeId string, globalId string) (int, int, error) {
+	layout.lock.Lock()
+	defer layout.lock.Unlock()
+	if address, ok := layout.nodes[nodeId][globalId]; ok {
+		return address.GroupID, address.DeviceID, nil
+	}
+	id, err := strconv.Atoi(globalId)
+	if err != nil || id <= 0 {
+		return 0, 0, fmt.Errorf("invalid device id %q", globalId)
+	}
+	outletsPerGroup := layout.nodeOutletsPerGroup(nodeId)
+	return (id-1)/outletsPerGroup + 1, (id-1)%outletsPerGroup + 1, nil
+}
+
+func (layout *outletLayout) save() {
+	if layout.stateFile == "" {
+		return
+	}
+	stateBytes, _ := json.MarshalIndent(layout.nodes, "", "  ")
+	if err := os.WriteFile(layout.stateFile, stateBytes, 0644); err != nil {
+		slog.Error("Collector: write layout state file failed", "file", layout.stateFile, "err", err)
+	}
+}
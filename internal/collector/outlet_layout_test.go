@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+// deviceGroupPayload 生成groups个设备组、每组outlets个插座的设备组上报，不带最外层大括号
+func deviceGroupPayload(groups int, outlets int) []byte {
+	devices := make([]string, 0, groups)
+	for group := 1; group <= groups; group++ {
+		subDevices := make([]string, 0, outlets)
+		for outlet := 1; outlet <= outlets; outlet++ {
+			subDevices = append(subDevices, fmt.Sprintf(`{"id":%v,"type":1,"on":1,"current":"0.1"}`, outlet))
+		}
+		devices = append(devices, fmt.Sprintf(`{"id":%v,"type":1,"voltage":"220","subdevs":[%v]}`,
+			group, strings.Join(subDevices, ",")))
+	}
+	return []byte(fmt.Sprintf(`"devices":[%v]`, strings.Join(devices, ",")))
+}
+
+func TestOutletLayoutControlResponseBeforeTelemetry(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "layout.json")
+	layout, err := newOutletLayout(&entity.OutletLayoutConfig{StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 8路插座的节点，第一条遥测之前先收到控制响应
+	if err = parseControlResponseMessage(ctx, layout, "node", []byte(`"devid":2,"linid":3,"actid":1,"result":0`)); err == nil {
+		t.Fatal("control response before telemetry should not be resolved")
+	}
+	if _, err = os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Fatalf("control response should not persist any mapping, stat err %v", err)
+	}
+
+	report, err := decodeDeviceGroupMessage(layout, "node", deviceGroupPayload(2, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool, len(report.Devices))
+	for _, device := range report.Devices {
+		ids[device.ID] = true
+	}
+	for id := 1; id <= 16; id++ {
+		if !ids[fmt.Sprint(id)] {
+			t.Errorf("global id %v not assigned, got %v", id, ids)
+		}
+	}
+
+	globalId, err := layout.lookupGlobalId("node", 2, 3)
+	if err != nil || globalId != "11" {
+		t.Errorf("lookupGlobalId(2, 3) = %q, %v, want 11", globalId, err)
+	}
+	stateBytes, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var persisted map[string]map[string]outletAddress
+	if err = json.Unmarshal(stateBytes, &persisted); err != nil {
+		t.Fatal(err)
+	}
+	if len(persisted["node"]) != 16 {
+		t.Errorf("persisted %v outlets, want 16", len(persisted["node"]))
+	}
+}
+
+func TestOutletLayoutRejectsInvalidAddress(t *testing.T) {
+	layout, err := newOutletLayout(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groupId  int
+		deviceId int
+	}{
+		{0, 1},
+		{1, 0},
+		{0, 0},
+		{-1, 8},
+	}
+	for _, tt := range tests {
+		if _, err = layout.globalId("node", tt.groupId, tt.deviceId); err == nil {
+			t.Errorf("globalId(%v, %v) should fail", tt.groupId, tt.deviceId)
+		}
+		if _, err = layout.lookupGlobalId("node", tt.groupId, tt.deviceId); err == nil {
+			t.Errorf("lookupGlobalId(%v, %v) should fail", tt.groupId, tt.deviceId)
+		}
+	}
+	if len(layout.nodes) != 0 {
+		t.Errorf("invalid address should not be assigned, got %v", layout.nodes)
+	}
+}
+
+func TestOutletLayoutKeepsAssignedIds(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "layout.json")
+	layout, err := newOutletLayout(&entity.OutletLayoutConfig{StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decodeDeviceGroupMessage(layout, "node", deviceGroupPayload(2, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后设备组扩容为8路，已分配的ID保持不变，新插座顺延
+	layout, err = newOutletLayout(&entity.OutletLayoutConfig{StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decodeDeviceGroupMessage(layout, "node", deviceGroupPayload(2, 8)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groupId  int
+		deviceId int
+		want     string
+	}{
+		{1, 1, "1"},
+		{1, 4, "4"},
+		{2, 1, "5"},
+		{2, 4, "8"},
+		{1, 5, "9"},
+		{2, 8, "16"},
+	}
+	for _, tt := range tests {
+		if got, err := layout.lookupGlobalId("node", tt.groupId, tt.deviceId); err != nil || got != tt.want {
+			t.Errorf("lookupGlobalId(%v, %v) = %q, %v, want %v", tt.groupId, tt.deviceId, got, err, tt.want)
+		}
+	}
+}
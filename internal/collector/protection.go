@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+const (
+	ProtectModeReject  = "reject"
+	ProtectModeConfirm = "confirm"
+)
+
+const (
+	// interlockPendingTimeout 已下发的ON命令在这段时间内即使遥测尚未确认也计入互锁
+	interlockPendingTimeout = 30 * time.Second
+)
+
+var (
+	ErrProtected            = errors.New("outlet is protected")
+	ErrConfirmationRequired = errors.New("outlet is protected, confirmation token required")
+	ErrInterlocked          = errors.New("outlet is interlocked")
+
+	// rules 整体构建后替换，API和HASS的协程可以无锁读取
+	rules atomic.Pointer[protectionRules]
+	// interlockLock 互锁检查和登记待确认的ON命令必须原子完成，否则连续两条ON命令都能通过检查
+	interlockLock sync.Mutex
+	pendingOn     = make(map[entity.OutletRef]time.Time) // 已下发但遥测尚未确认的ON命令
+)
+
+type protectionRules struct {
+	protectedOutlets map[entity.OutletRef]*entity.ProtectedOutletConfig
+	interlocks       map[entity.OutletRef][]*entity.InterlockConfig
+}
+
+func InitProtection(_ context.Context, config *entity.ProtectionConfig) error {
+	result := &protectionRules{
+		protectedOutlets: make(map[entity.OutletRef]*entity.ProtectedOutletConfig),
+		interlocks:       make(map[entity.OutletRef][]*entity.InterlockConfig),
+	}
+	if config != nil {
+		if err := ValidateProtection(config); err != nil {
+			return fmt.Errorf("collector: protection.%v", err)
+		}
+		for _, protected := range config.Protected {
+			for _, deviceId := range protected.Outlets {
+				result.protectedOutlets[entity.OutletRef{NodeID: protected.NodeID, ID: deviceId}] = protected
+			}
+		}
+		for _, interlock := range config.Interlocks {
+			result.interlocks[interlock.Outlet] = append(result.interlocks[interlock.Outlet], interlock)
+		}
+	}
+	rules.Store(result)
+	return nil
+}
+
+// ValidateProtection 用于检查配置，错误信息中的字段路径相对于protection配置
+func ValidateProtection(config *entity.ProtectionConfig) error {
+	for i, protected := range config.Protected {
+		switch protected.Mode {
+		case ProtectModeReject:
+		case ProtectModeConfirm:
+			if protected.Token == "" {
+				return fmt.Errorf("protected[%v].token is empty", i)
+			}
+		default:
+			return fmt.Errorf("protected[%v].mode %q must be reject or confirm", i, protected.Mode)
+		}
+	}
+	for i, interlock := range config.Interlocks {
+		if interlock.Outlet.NodeID == "" || interlock.Outlet.ID == "" {
+			return fmt.Errorf("interlocks[%v].outlet needs node_id and id", i)
+		}
+		if len(interlock.Conflicts) == 0 {
+			return fmt.Errorf("interlocks[%v].conflicts is required", i)
+		}
+	}
+	return nil
+}
+
+// checkProtection 在命令下发到PDU之前执行保护和互锁检查，
+// 通过检查的ON命令登记为待确认，下发失败时调用方需要调用releasePending
+func checkProtection(ctx context.Context, command *entity.Command) error {
+	current := rules.Load()
+	if current == nil {
+		return nil
+	}
+	outlet := entity.OutletRef{NodeID: command.NodeID, ID: command.DeviceID}
+	if protected, ok := current.protectedOutlets[outlet]; ok {
+		switch protected.Mode {
+		case ProtectModeReject:
+			return ErrProtected
+		case ProtectModeConfirm:
+			if subtle.ConstantTimeCompare([]byte(command.Token), []byte(protected.Token)) != 1 {
+				return ErrConfirmationRequired
+			}
+		}
+	}
+
+	interlockLock.Lock()
+	defer interlockLock.Unlock()
+	if command.Command != "ON" {
+		delete(pendingOn, outlet)
+		return nil
+	}
+	now := time.Now()
+	for _, interlock := range current.interlocks[outlet] {
+		for _, conflict := range interlock.Conflicts {
+			if sentAt, ok := pendingOn[*conflict]; ok && now.Sub(sentAt) < interlockPendingTimeout {
+				return fmt.Errorf("%w by %v, outlet %v/%v is being turned on", ErrInterlocked, interlock.Name, conflict.NodeID, conflict.ID)
+			}
+			if device := database.GetPDUDevice(ctx, conflict.NodeID, conflict.ID); device != nil && device.On {
+				return fmt.Errorf("%w by %v, outlet %v/%v is on", ErrInterlocked, interlock.Name, conflict.NodeID, conflict.ID)
+			}
+		}
+	}
+	pendingOn[outlet] = now
+	return nil
+}
+
+// releasePending ON命令没有下发成功时撤销登记，不再阻塞与它互锁的插座
+func releasePending(command *entity.Command) {
+	if command.Command != "ON" {
+		return
+	}
+	interlockLock.Lock()
+	defer interlockLock.Unlock()
+	delete(pendingOn, entity.OutletRef{NodeID: command.NodeID, ID: command.DeviceID})
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+func initTestProtection(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	database.Init(ctx)
+	clear(pendingOn)
+	err := InitProtection(ctx, &entity.ProtectionConfig{
+		Protected: []*entity.ProtectedOutletConfig{
+			{NodeID: "node", Outlets: []string{"1"}, Mode: ProtectModeReject},
+			{NodeID: "node", Outlets: []string{"2"}, Mode: ProtectModeConfirm, Token: "secret"},
+		},
+		Interlocks: []*entity.InterlockConfig{
+			{Name: "ab", Outlet: entity.OutletRef{NodeID: "node", ID: "3"}, Conflicts: []*entity.OutletRef{{NodeID: "node", ID: "4"}}},
+			{Name: "ba", Outlet: entity.OutletRef{NodeID: "node", ID: "4"}, Conflicts: []*entity.OutletRef{{NodeID: "node", ID: "3"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func switchCommand(deviceId string, command string, token string) *entity.Command {
+	return &entity.Command{NodeID: "node", DeviceID: deviceId, Type: "switch", Command: command, Token: token}
+}
+
+func TestCheckProtection(t *testing.T) {
+	ctx := initTestProtection(t)
+	tests := []struct {
+		name    string
+		command *entity.Command
+		want    error
+	}{
+		{"rejected", switchCommand("1", "OFF", ""), ErrProtected},
+		{"missing token", switchCommand("2", "OFF", ""), ErrConfirmationRequired},
+		{"wrong token", switchCommand("2", "OFF", "guess"), ErrConfirmationRequired},
+		{"confirmed", switchCommand("2", "OFF", "secret"), nil},
+		{"unprotected", switchCommand("5", "ON", ""), nil},
+	}
+	for _, tt := range tests {
+		if err := checkProtection(ctx, tt.command); !errors.Is(err, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	database.SetPUDDevice(ctx, "node", "4", &entity.PDUDevice{NodeID: "node", ID: "4", On: true})
+	if err := checkProtection(ctx, switchCommand("3", "ON", "")); !errors.Is(err, ErrInterlocked) {
+		t.Errorf("conflict on in telemetry: got %v, want %v", err, ErrInterlocked)
+	}
+	if err := checkProtection(ctx, switchCommand("3", "OFF", "")); err != nil {
+		t.Errorf("OFF should never be interlocked, got %v", err)
+	}
+}
+
+func TestCheckProtectionBackToBack(t *testing.T) {
+	ctx := initTestProtection(t)
+
+	// 两条ON命令连续到达，遥测还没有更新
+	if err := checkProtection(ctx, switchCommand("3", "ON", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkProtection(ctx, switchCommand("4", "ON", "")); !errors.Is(err, ErrInterlocked) {
+		t.Fatalf("second ON should be interlocked by the pending one, got %v", err)
+	}
+
+	// 下发失败撤销登记，OFF命令同样清除登记
+	releasePending(switchCommand("3", "ON", ""))
+	if err := checkProtection(ctx, switchCommand("4", "ON", "")); err != nil {
+		t.Fatalf("released ON should not block, got %v", err)
+	}
+	if err := checkProtection(ctx, switchCommand("4", "OFF", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkProtection(ctx, switchCommand("3", "ON", "")); err != nil {
+		t.Fatalf("OFF should clear the pending ON, got %v", err)
+	}
+
+	// 超时后不再计入
+	pendingOn[entity.OutletRef{NodeID: "node", ID: "3"}] = time.Now().Add(-interlockPendingTimeout)
+	if err := checkProtection(ctx, switchCommand("4", "ON", "")); err != nil {
+		t.Fatalf("expired pending ON should not block, got %v", err)
+	}
+}
+
+func TestCheckProtectionConcurrent(t *testing.T) {
+	ctx := initTestProtection(t)
+	var wg sync.WaitGroup
+	results := make(chan error, 2)
+	for _, deviceId := range []string{"3", "4"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- checkProtection(ctx, switchCommand(deviceId, "ON", ""))
+		}()
+	}
+	wg.Wait()
+	close(results)
+	passed := 0
+	for err := range results {
+		if err == nil {
+			passed++
+		}
+	}
+	if passed != 1 {
+		t.Errorf("exactly one of two interlocked ON commands should pass, got %v", passed)
+	}
+}
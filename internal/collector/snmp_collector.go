@@ -0,0 +1,378 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+var (
+	snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+		"MD5":    gosnmp.MD5,
+		"SHA":    gosnmp.SHA,
+		"SHA224": gosnmp.SHA224,
+		"SHA256": gosnmp.SHA256,
+		"SHA384": gosnmp.SHA384,
+		"SHA512": gosnmp.SHA512,
+	}
+	snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+		"DES":    gosnmp.DES,
+		"AES":    gosnmp.AES,
+		"AES192": gosnmp.AES192,
+		"AES256": gosnmp.AES256,
+	}
+)
+
+// SNMPCollector 按固定间隔轮询每台PDU的插座表，插座的全局ID即插座序号
+type SNMPCollector struct {
+	name    string
+	config  entity.SNMPCollectorConfig
+	devices map[string]*snmpDevice // 节点ID->设备
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type snmpDevice struct {
+	lock   sync.Mutex // gosnmp的连接不能并发使用
+	config *entity.SNMPDeviceConfig
+	model  *snmpModel
+	client *gosnmp.GoSNMP
+}
+
+// snmpModel 填充默认值后的型号配置，配置中的型号在多个采集器和重新加载之间共享，不能修改
+type snmpModel struct {
+	entity.SNMPModelConfig
+	stateOn   int
+	controlOn int
+}
+
+func newSNMPModel(config *entity.SNMPModelConfig) *snmpModel {
+	model := &snmpModel{SNMPModelConfig: *config, stateOn: 1, controlOn: 1}
+	if config.StateOn != nil {
+		model.stateOn = *config.StateOn
+	}
+	if config.ControlOn != nil {
+		model.controlOn = *config.ControlOn
+	}
+	return model
+}
+
+func (collector *SNMPCollector) setup(config *entity.CollectorConfig) error {
+	if config.SNMP == nil {
+		return fmt.Errorf("snmp is required")
+	}
+	collector.name = config.Name
+	collector.config = *config.SNMP
+	if collector.config.Interval <= 0 {
+		collector.config.Interval = defaultPollInterval
+	}
+	if collector.config.Timeout <= 0 {
+		collector.config.Timeout = defaultPollTimeout
+	}
+	if len(collector.config.Devices) == 0 {
+		return fmt.Errorf("snmp.devices is required")
+	}
+	models := make(map[string]*snmpModel, len(collector.config.Models))
+	for name, model := range collector.config.Models {
+		if model == nil || model.Outlets <= 0 || model.StateOID == "" {
+			return fmt.Errorf("snmp.models.%v needs outlets and state_oid", name)
+		}
+		models[name] = newSNMPModel(model)
+	}
+
+	collector.devices = make(map[string]*snmpDevice, len(collector.config.Devices))
+	for i, deviceConfig := range collector.config.Devices {
+		if deviceConfig.NodeID == "" || collector.devices[deviceConfig.NodeID] != nil {
+			return fmt.Errorf("snmp.devices[%v].node_id %q is empty or duplicated", i, deviceConfig.NodeID)
+		}
+		model, ok := models[deviceConfig.Model]
+		if !ok {
+			return fmt.Errorf("snmp.devices[%v].model %q not found in models", i, deviceConfig.Model)
+		}
+		client, err := collector.newClient(deviceConfig)
+		if err != nil {
+			return fmt.Errorf("snmp.devices[%v].%v", i, err)
+		}
+		collector.devices[deviceConfig.NodeID] = &snmpDevice{config: deviceConfig, model: model, client: client}
+	}
+	return nil
+}
+
+func (collector *SNMPCollector) Run(ctx context.Context, config *entity.CollectorConfig) error {
+	if err := collector.setup(config); err != nil {
+		return fmt.Errorf("Collector.SNMP: %v", err)
+	}
+	for _, device := range collector.devices {
+		if err := device.client.Connect(); err != nil {
+			return fmt.Errorf("Collector.SNMP: connect %v failed, %v", device.config.Address, err)
+		}
+	}
+
+	ctx, collector.cancel = context.WithCancel(ctx)
+	for nodeId, device := range collector.devices {
+		status.Set(deviceStatusName(collector.name, nodeId), status.StateConnecting, nil)
+		collector.wg.Add(1)
+		go collector.poll(ctx, device)
+	}
+	slog.Info("Collector.SNMP: initialized", "devices", len(collector.devices), "interval", collector.config.Interval)
+	return nil
+}
+
+func (collector *SNMPCollector) newClient(config *entity.SNMPDeviceConfig) (*gosnmp.GoSNMP, error) {
+	host, port := config.Address, uint16(161)
+	if h, p, err := net.SplitHostPort(config.Address); err == nil {
+		portNumber, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("address %q has invalid port", config.Address)
+		}
+		host, port = h, uint16(portNumber)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:             host,
+		Port:               port,
+		Transport:          "udp",
+		Timeout:            collector.config.Timeout,
+		Retries:            collector.config.Retries,
+		ExponentialTimeout: true,
+		MaxOids:            gosnmp.MaxOids,
+	}
+	if config.Timeout > 0 {
+		client.Timeout = config.Timeout
+	}
+
+	switch config.Version {
+	case "", "2c":
+		client.Version = gosnmp.Version2c
+		client.Community = config.Community
+		if client.Community == "" {
+			client.Community = "public"
+		}
+	case "3":
+		if config.Username == "" {
+			return nil, fmt.Errorf("username is required for version 3")
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		params := &gosnmp.UsmSecurityParameters{UserName: config.Username}
+		switch config.SecurityLevel {
+		case "", "noAuthNoPriv":
+			client.MsgFlags = gosnmp.NoAuthNoPriv
+		case "authNoPriv", "authPriv":
+			authProtocol, ok := snmpAuthProtocols[strings.ToUpper(config.AuthProtocol)]
+			if !ok {
+				return nil, fmt.Errorf("auth_protocol %q is invalid", config.AuthProtocol)
+			}
+			params.AuthenticationProtocol = authProtocol
+			params.AuthenticationPassphrase = config.AuthPassword
+			client.MsgFlags = gosnmp.AuthNoPriv
+			if config.SecurityLevel == "authPriv" {
+				privProtocol, ok := snmpPrivProtocols[strings.ToUpper(config.PrivProtocol)]
+				if !ok {
+					return nil, fmt.Errorf("priv_protocol %q is invalid", config.PrivProtocol)
+				}
+				params.PrivacyProtocol = privProtocol
+				params.PrivacyPassphrase = config.PrivPassword
+				client.MsgFlags = gosnmp.AuthPriv
+			}
+		default:
+			return nil, fmt.Errorf("security_level %q is invalid", config.SecurityLevel)
+		}
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("version %q must be 2c or 3", config.Version)
+	}
+	return client, nil
+}
+
+func (collector *SNMPCollector) Stop(ctx context.Context) {
+	if collector.cancel != nil {
+		collector.cancel()
+		collector.wg.Wait()
+	}
+	for _, device := range collector.devices {
+		if device.client.Conn != nil {
+			_ = device.client.Conn.Close()
+		}
+	}
+	for nodeId := range collector.devices {
+		status.Remove(deviceStatusName(collector.name, nodeId))
+	}
+	slog.Info("Collector.SNMP: stopped")
+}
+
+func (collector *SNMPCollector) poll(ctx context.Context, device *snmpDevice) {
+	defer collector.wg.Done()
+	ticker := time.NewTicker(collector.config.Interval)
+	defer ticker.Stop()
+	for {
+		err := collector.fetchState(ctx, device)
+		if err != nil {
+			slog.Error("Collector.SNMP: poll failed", "nodeId", device.config.NodeID, "address", device.config.Address, "err", err)
+		}
+		reportPollState(ctx, collector.name, device.config.NodeID, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (collector *SNMPCollector) fetchState(ctx context.Context, device *snmpDevice) error {
+	model := device.model
+	oids := make([]string, 0)
+	for outlet := 1; outlet <= model.Outlets; outlet++ {
+		for _, tableOID := range []string{model.NameOID, model.StateOID, model.VoltageOID, model.CurrentOID, model.PowerOID, model.EnergyOID} {
+			if tableOID != "" {
+				oids = append(oids, outletOID(tableOID, outlet))
+			}
+		}
+	}
+	values, err := device.get(oids)
+	if err != nil {
+		return err
+	}
+
+	for outlet := 1; outlet <= model.Outlets; outlet++ {
+		state, ok := values[outletOID(model.StateOID, outlet)]
+		if !ok {
+			continue
+		}
+		on, err := snmpFloat32(state)
+		if err != nil {
+			slog.Warn("Collector.SNMP: invalid outlet state", "nodeId", device.config.NodeID, "outlet", outlet, "err", err)
+			continue
+		}
+		pduDevice := &entity.PDUDevice{
+			NodeID:  device.config.NodeID,
+			ID:      strconv.Itoa(outlet),
+			GroupID: "1",
+			Name:    fmt.Sprintf("插座%v", outlet),
+			On:      int(on) == model.stateOn,
+			Voltage: snmpMeasurement(values, model.VoltageOID, outlet, model.VoltageScale),
+			Current: snmpMeasurement(values, model.CurrentOID, outlet, model.CurrentScale),
+			Power:   snmpMeasurement(values, model.PowerOID, outlet, model.PowerScale),
+			Energy:  snmpMeasurement(values, model.EnergyOID, outlet, model.EnergyScale),
+		}
+		if name, ok := values[outletOID(model.NameOID, outlet)].([]byte); ok && len(name) > 0 {
+			pduDevice.Name = string(name)
+		}
+		database.SetPUDDevice(ctx, pduDevice.NodeID, pduDevice.ID, pduDevice)
+	}
+	return nil
+}
+
+// SendCommand 只处理本采集器轮询的节点，其它节点由别的采集器负责
+func (collector *SNMPCollector) SendCommand(ctx context.Context, command *entity.Command) error {
+	device, ok := collector.devices[command.NodeID]
+	if !ok {
+		return nil
+	}
+	if device.model.ControlOID == "" {
+		return fmt.Errorf("Collector.SNMP: SendCommand, model %v has no control_oid", device.config.Model)
+	}
+	outlet, err := strconv.Atoi(command.DeviceID)
+	if err != nil || outlet <= 0 || outlet > device.model.Outlets {
+		return fmt.Errorf("Collector.SNMP: SendCommand, invalid device id %q", command.DeviceID)
+	}
+	value := device.model.ControlOff
+	if command.Command == "ON" {
+		value = device.model.controlOn
+	}
+
+	device.lock.Lock()
+	defer device.lock.Unlock()
+	result, err := device.client.Set([]gosnmp.SnmpPDU{{
+		Name:  outletOID(device.model.ControlOID, outlet),
+		Type:  gosnmp.Integer,
+		Value: value,
+	}})
+	if err != nil {
+		return fmt.Errorf("Collector.SNMP: SendCommand failed, %v", err)
+	}
+	if result.Error != gosnmp.NoError {
+		return fmt.Errorf("Collector.SNMP: SendCommand failed, %v", result.Error)
+	}
+	return nil
+}
+
+// get 按MaxOids分批读取，没有该对象的OID不会出现在结果中
+func (device *snmpDevice) get(oids []string) (map[string]any, error) {
+	device.lock.Lock()
+	defer device.lock.Unlock()
+	result := make(map[string]any, len(oids))
+	for start := 0; start < len(oids); start += device.client.MaxOids {
+		end := min(start+device.client.MaxOids, len(oids))
+		packet, err := device.client.Get(oids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if packet.Error != gosnmp.NoError {
+			return nil, fmt.Errorf("get failed, %v at index %v", packet.Error, packet.ErrorIndex)
+		}
+		for _, variable := range packet.Variables {
+			switch variable.Type {
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.Null:
+				continue
+			}
+			result[strings.TrimPrefix(variable.Name, ".")] = variable.Value
+		}
+	}
+	return result, nil
+}
+
+func outletOID(tableOID string, outlet int) string {
+	return fmt.Sprintf("%v.%v", strings.Trim(tableOID, "."), outlet)
+}
+
+func snmpFloat32(value any) (float32, error) {
+	if text, ok := value.([]byte); ok {
+		result, err := strconv.ParseFloat(strings.TrimSpace(string(text)), 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", text)
+		}
+		return float32(result), nil
+	}
+	if result, ok := value.(float32); ok {
+		return result, nil
+	}
+	if result, ok := value.(float64); ok {
+		return float32(result), nil
+	}
+	// 其它类型按整数处理，无法识别时为0
+	result, _ := gosnmp.ToBigInt(value).Float64()
+	return float32(result), nil
+}
+
+// snmpMeasurement 未配置OID或读不到时返回nil，与MQTT上报缺失测量值的处理一致
+func snmpMeasurement(values map[string]any, tableOID string, outlet int, scale float32) *float32 {
+	if tableOID == "" {
+		return nil
+	}
+	value, ok := values[outletOID(tableOID, outlet)]
+	if !ok {
+		return nil
+	}
+	result, err := snmpFloat32(value)
+	if err != nil {
+		return nil
+	}
+	if scale != 0 {
+		result *= scale
+	}
+	return &result
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestNewSNMPModel(t *testing.T) {
+	zero, two := 0, 2
+	tests := []struct {
+		name          string
+		config        *entity.SNMPModelConfig
+		wantStateOn   int
+		wantControlOn int
+	}{
+		{"defaults", &entity.SNMPModelConfig{}, 1, 1},
+		{"explicit zero", &entity.SNMPModelConfig{StateOn: &zero, ControlOn: &zero}, 0, 0},
+		{"custom", &entity.SNMPModelConfig{StateOn: &two, ControlOn: &two}, 2, 2},
+	}
+	for _, tt := range tests {
+		model := newSNMPModel(tt.config)
+		if model.stateOn != tt.wantStateOn || model.controlOn != tt.wantControlOn {
+			t.Errorf("%v: got state_on %v control_on %v, want %v %v", tt.name, model.stateOn, model.controlOn, tt.wantStateOn, tt.wantControlOn)
+		}
+	}
+}
+
+func TestSNMPCollectorSetupKeepsConfig(t *testing.T) {
+	config := &entity.CollectorConfig{Name: "snmp", Type: "snmp", SNMP: &entity.SNMPCollectorConfig{
+		Models: map[string]*entity.SNMPModelConfig{
+			"pdu": {Outlets: 8, StateOID: "1.3.6.1.4.1.1.1", ControlOID: "1.3.6.1.4.1.1.2"},
+		},
+		Devices: []*entity.SNMPDeviceConfig{
+			{NodeID: "a", Address: "127.0.0.1", Model: "pdu"},
+			{NodeID: "b", Address: "127.0.0.1:1161", Model: "pdu", Version: "3", Username: "user", SecurityLevel: "authPriv",
+				AuthProtocol: "sha", AuthPassword: "password", PrivProtocol: "aes", PrivPassword: "password"},
+		},
+	}}
+	original := *config.SNMP.Models["pdu"]
+	for range 2 {
+		collector := &SNMPCollector{}
+		if err := collector.setup(config); err != nil {
+			t.Fatal(err)
+		}
+		if model := collector.devices["a"].model; model.stateOn != 1 || model.controlOn != 1 {
+			t.Errorf("got resolved model %+v", model)
+		}
+	}
+	if !reflect.DeepEqual(*config.SNMP.Models["pdu"], original) {
+		t.Errorf("setup modified the shared model config: %+v", config.SNMP.Models["pdu"])
+	}
+}
+
+func TestSNMPCollectorSetupErrors(t *testing.T) {
+	model := map[string]*entity.SNMPModelConfig{"pdu": {Outlets: 8, StateOID: "1.3.6.1.4.1.1.1"}}
+	tests := []struct {
+		name    string
+		config  *entity.SNMPCollectorConfig
+		wantErr string
+	}{
+		{"no devices", &entity.SNMPCollectorConfig{Models: model}, "snmp.devices is required"},
+		{"incomplete model", &entity.SNMPCollectorConfig{
+			Models:  map[string]*entity.SNMPModelConfig{"pdu": {Outlets: 8}},
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1", Model: "pdu"}},
+		}, "snmp.models.pdu needs outlets and state_oid"},
+		{"unknown model", &entity.SNMPCollectorConfig{Models: model,
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1", Model: "other"}},
+		}, `snmp.devices[0].model "other" not found in models`},
+		{"duplicated node", &entity.SNMPCollectorConfig{Models: model,
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1", Model: "pdu"}, {NodeID: "a", Address: "127.0.0.2", Model: "pdu"}},
+		}, `snmp.devices[1].node_id "a" is empty or duplicated`},
+		{"invalid port", &entity.SNMPCollectorConfig{Models: model,
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1:x", Model: "pdu"}},
+		}, `snmp.devices[0].address "127.0.0.1:x" has invalid port`},
+		{"missing username", &entity.SNMPCollectorConfig{Models: model,
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1", Model: "pdu", Version: "3"}},
+		}, "snmp.devices[0].username is required for version 3"},
+		{"invalid auth protocol", &entity.SNMPCollectorConfig{Models: model,
+			Devices: []*entity.SNMPDeviceConfig{{NodeID: "a", Address: "127.0.0.1", Model: "pdu", Version: "3", Username: "u", SecurityLevel: "authNoPriv", AuthProtocol: "md4"}},
+		}, `snmp.devices[0].auth_protocol "md4" is invalid`},
+	}
+	for _, tt := range tests {
+		collector := &SNMPCollector{}
+		err := collector.setup(&entity.CollectorConfig{Name: "snmp", SNMP: tt.config})
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSNMPMeasurement(t *testing.T) {
+	values := map[string]any{
+		"1.3.1.1": 2305,
+		"1.3.1.2": []byte(" 1.5 "),
+		"1.3.1.3": []byte("n/a"),
+		"1.3.1.4": uint32(7),
+	}
+	tests := []struct {
+		tableOID string
+		outlet   int
+		scale    float32
+		want     *float32
+	}{
+		{".1.3.1.", 1, 0.1, ptr(float32(230.5))},
+		{"1.3.1", 2, 0, ptr(float32(1.5))},
+		{"1.3.1", 3, 1, nil},
+		{"1.3.1", 4, 0, ptr(float32(7))},
+		{"1.3.1", 5, 1, nil},
+		{"", 1, 1, nil},
+	}
+	for _, tt := range tests {
+		got := snmpMeasurement(values, tt.tableOID, tt.outlet, tt.scale)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%v.%v: got %v, want %v", tt.tableOID, tt.outlet, deref(got), deref(tt.want))
+		}
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func deref(value *float32) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
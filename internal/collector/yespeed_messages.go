@@ -0,0 +1,305 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/utils"
+)
+
+const (
+	MessageTypeDeviceGroup     = "device_group"
+	MessageTypeDeviceInfo      = "device_info"
+	MessageTypeNetworkConfig   = "network_config"
+	MessageTypeAlarm           = "alarm"
+	MessageTypeThreshold       = "threshold"
+	MessageTypeEnergyReset     = "energy_reset"
+	MessageTypeControlResponse = "control_response"
+
+	unknownMessageSamples    = 5
+	unknownMessageSampleSize = 1024
+)
+
+// yespeedMessageParser 解析PDU在out方向上报的一种消息
+type yespeedMessageParser func(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error
+
+var (
+	yespeedMessageParsers = map[string]yespeedMessageParser{
+		MessageTypeDeviceGroup:     parseDeviceGroupMessage,
+		MessageTypeDeviceInfo:      parseDeviceInfoMessage,
+		MessageTypeNetworkConfig:   parseNetworkConfigMessage,
+		MessageTypeAlarm:           parseAlarmMessage,
+		MessageTypeThreshold:       parseThresholdMessage,
+		MessageTypeEnergyReset:     parseEnergyResetMessage,
+		MessageTypeControlResponse: parseControlResponseMessage,
+	}
+
+	unknownMessagesLock sync.Mutex
+	unknownMessages     = make(map[string]*entity.UnknownMessage)
+)
+
+// GetUnknownMessages 返回采集到的未知消息ID及样本
+func GetUnknownMessages(_ context.Context) []*entity.UnknownMessage {
+	unknownMessagesLock.Lock()
+	defer unknownMessagesLock.Unlock()
+	result := make([]*entity.UnknownMessage, 0, len(unknownMessages))
+	for _, message := range unknownMessages {
+		messageCopy := *message
+		result = append(result, &messageCopy)
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].MessageID < result[k].MessageID
+	})
+	return result
+}
+
+func recordUnknownMessage(messageID string, topic string, payload []byte) {
+	now := time.Now()
+	unknownMessagesLock.Lock()
+	defer unknownMessagesLock.Unlock()
+
+	message, ok := unknownMessages[messageID]
+	if !ok {
+		slog.Warn("Collector: unknown message id, capturing samples", "messageId", messageID, "topic", topic)
+		message = &entity.UnknownMessage{MessageID: messageID, FirstSeen: now}
+		unknownMessages[messageID] = message
+	}
+	message.Count++
+	message.LastSeen = now
+	if len(message.Topics) < unknownMessageSamples && !slices.Contains(message.Topics, topic) {
+		message.Topics = append(message.Topics, topic)
+	}
+	if len(message.Samples) < unknownMessageSamples {
+		message.Samples = append(message.Samples, utils.Truncate(string(payload), unknownMessageSampleSize))
+	}
+}
+
+// unmarshalYespeedPayload Yespeed的载荷通常缺少最外层的大括号，两种格式都尝试
+func unmarshalYespeedPayload(payload []byte, v any) error {
+	err := json.Unmarshal(payload, v)
+	if err == nil {
+		return nil
+	}
+	framed := append([]byte{'{'}, payload...)
+	framed = append(framed, '}')
+	if json.Unmarshal(framed, v) == nil {
+		return nil
+	}
+	return err
+}
+
+type deviceInfoMessage struct {
+	Model   string `json:"model"`
+	SN      string `json:"sn"`
+	HW      any    `json:"hw"`
+	Version string `json:"ver"`
+	MAC     string `json:"mac"`
+}
+
+func parseDeviceInfoMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message deviceInfoMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	database.SetNodeInfo(ctx, nodeID, MessageTypeDeviceInfo, &entity.PDUDeviceInfo{
+		NodeID:          nodeID,
+		Model:           message.Model,
+		SerialNumber:    message.SN,
+		HardwareVersion: anyToString(message.HW),
+		SoftwareVersion: message.Version,
+		MAC:             message.MAC,
+	})
+	return nil
+}
+
+type networkConfigMessage struct {
+	DHCP    any    `json:"dhcp"`
+	IP      string `json:"ip"`
+	Netmask string `json:"mask"`
+	Gateway string `json:"gw"`
+	DNS     string `json:"dns"`
+}
+
+func parseNetworkConfigMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message networkConfigMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	dhcp := anyToString(message.DHCP)
+	database.SetNodeInfo(ctx, nodeID, MessageTypeNetworkConfig, &entity.PDUNetworkConfig{
+		NodeID:  nodeID,
+		DHCP:    dhcp == "1" || dhcp == "true",
+		IP:      message.IP,
+		Netmask: message.Netmask,
+		Gateway: message.Gateway,
+		DNS:     message.DNS,
+	})
+	return nil
+}
+
+type alarmMessage struct {
+	GroupID     FlexValue `json:"devid"`
+	DeviceID    FlexValue `json:"linid"`
+	Type        any       `json:"type"`
+	Description string    `json:"det"`
+	Time        string    `json:"tim"`
+}
+
+func parseAlarmMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message alarmMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	d := &fieldDecoder{}
+	groupID, groupOK := d.id("devid", message.GroupID)
+	deviceID, deviceOK := d.optionalID("linid", message.DeviceID)
+	if !groupOK || !deviceOK {
+		return d.result(payload)
+	}
+	alarm := &entity.PDUAlarm{
+		NodeID:      nodeID,
+		GroupID:     fmt.Sprintf("%v", groupID),
+		Type:        anyToString(message.Type),
+		Description: message.Description,
+		Time:        message.Time,
+	}
+	// linid为0表示整组告警，插座尚未在遥测中出现时按整组告警处理
+	if deviceID != 0 {
+		globalID, err := layout.lookupGlobalId(nodeID, groupID, deviceID)
+		if err != nil {
+			slog.Warn("Collector: alarm outlet unresolved", "nodeId", nodeID, "err", err)
+		}
+		alarm.DeviceID = globalID
+	}
+	database.SetNodeInfo(ctx, nodeID, MessageTypeAlarm, alarm)
+	event.Publish(ctx, &entity.Event{
+		Type:     entity.EventTypePDUAlarm,
+		NodeID:   nodeID,
+		DeviceID: alarm.DeviceID,
+		Payload:  alarm,
+	})
+	return nil
+}
+
+type thresholdMessage struct {
+	GroupID    FlexValue `json:"devid"`
+	VoltageMin FlexValue `json:"vmin"`
+	VoltageMax FlexValue `json:"vmax"`
+	CurrentMax FlexValue `json:"cmax"`
+	PowerMax   FlexValue `json:"pmax"`
+}
+
+// parseThresholdMessage 缺失或无法解析的阈值为null，其它阈值仍会保存
+func parseThresholdMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message thresholdMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	d := &fieldDecoder{}
+	groupID, ok := d.id("devid", message.GroupID)
+	if !ok {
+		return d.result(payload)
+	}
+	database.SetNodeInfo(ctx, nodeID, MessageTypeThreshold, &entity.PDUThresholdSettings{
+		NodeID:     nodeID,
+		GroupID:    fmt.Sprintf("%v", groupID),
+		VoltageMin: d.measurement("vmin", message.VoltageMin),
+		VoltageMax: d.measurement("vmax", message.VoltageMax),
+		CurrentMax: d.measurement("cmax", message.CurrentMax),
+		PowerMax:   d.measurement("pmax", message.PowerMax),
+	})
+	return d.result(payload)
+}
+
+type energyResetMessage struct {
+	GroupID  FlexValue `json:"devid"`
+	DeviceID FlexValue `json:"linid"`
+	Time     string    `json:"tim"`
+}
+
+func parseEnergyResetMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message energyResetMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	d := &fieldDecoder{}
+	groupID, groupOK := d.id("devid", message.GroupID)
+	deviceID, deviceOK := d.optionalID("linid", message.DeviceID)
+	if !groupOK || !deviceOK {
+		return d.result(payload)
+	}
+	reset := &entity.PDUEnergyReset{
+		NodeID:  nodeID,
+		GroupID: fmt.Sprintf("%v", groupID),
+		Time:    message.Time,
+	}
+	if deviceID != 0 {
+		globalID, err := layout.lookupGlobalId(nodeID, groupID, deviceID)
+		if err != nil {
+			slog.Warn("Collector: energy reset outlet unresolved", "nodeId", nodeID, "err", err)
+		}
+		reset.DeviceID = globalID
+	}
+	slog.Info("Collector: energy reset", "nodeId", nodeID, "groupId", reset.GroupID, "deviceId", reset.DeviceID)
+	database.SetNodeInfo(ctx, nodeID, MessageTypeEnergyReset, reset)
+	return nil
+}
+
+type controlResponseMessage struct {
+	GroupID  FlexValue `json:"devid"`
+	DeviceID FlexValue `json:"linid"`
+	Action   FlexValue `json:"actid"`
+	Result   any       `json:"result"`
+}
+
+func parseControlResponseMessage(ctx context.Context, layout *outletLayout, nodeID string, payload []byte) error {
+	var message controlResponseMessage
+	if err := unmarshalYespeedPayload(payload, &message); err != nil {
+		return err
+	}
+	d := &fieldDecoder{}
+	groupID, groupOK := d.id("devid", message.GroupID)
+	deviceID, deviceOK := d.id("linid", message.DeviceID)
+	action, actionOK := d.optionalID("actid", message.Action)
+	if !groupOK || !deviceOK || !actionOK {
+		return d.result(payload)
+	}
+	globalID, err := layout.lookupGlobalId(nodeID, groupID, deviceID)
+	if err != nil {
+		return err
+	}
+	result := anyToString(message.Result)
+	response := &entity.PDUControlResponse{
+		NodeID:   nodeID,
+		DeviceID: globalID,
+		Action:   action,
+		Success:  result == "" || result == "0" || result == "ok" || result == "true",
+	}
+	if !response.Success {
+		slog.Warn("Collector: control command failed on PDU", "nodeId", nodeID, "deviceId", response.DeviceID, "result", result)
+	}
+	database.SetNodeInfo(ctx, nodeID, MessageTypeControlResponse, response)
+	event.Publish(ctx, &entity.Event{
+		Type:     entity.EventTypeCommandResult,
+		NodeID:   nodeID,
+		DeviceID: response.DeviceID,
+		Payload:  response,
+	})
+	return nil
+}
+
+func anyToString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+func TestYespeedMessageParsers(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType string
+		payload     string
+		want        string   // 保存到节点信息中的JSON，为空表示没有保存
+		wantErrors  []string // DecodeError中的字段路径
+		wantErr     bool     // 其它错误
+	}{
+		{"device info", MessageTypeDeviceInfo, `"model":"YS-PDU","sn":"123","hw":2,"ver":"1.0","mac":"aa"`,
+			`{"node_id":"node","model":"YS-PDU","serial_number":"123","hw_version":"2","sw_version":"1.0","mac":"aa"}`, nil, false},
+		{"network config", MessageTypeNetworkConfig, `{"dhcp":1,"ip":"10.0.0.2","mask":"255.255.255.0","gw":"10.0.0.1","dns":"10.0.0.1"}`,
+			`{"node_id":"node","dhcp":true,"ip":"10.0.0.2","netmask":"255.255.255.0","gateway":"10.0.0.1","dns":"10.0.0.1"}`, nil, false},
+		{"group alarm", MessageTypeAlarm, `"devid":"1","linid":0,"type":3,"det":"over current","tim":"12:00"`,
+			`{"node_id":"node","group_id":"1","type":"3","description":"over current","time":"12:00"}`, nil, false},
+		{"outlet alarm", MessageTypeAlarm, `"devid":2,"linid":"1","type":3`,
+			`{"node_id":"node","group_id":"2","device_id":"5","type":"3","description":"","time":""}`, nil, false},
+		{"alarm without devid", MessageTypeAlarm, `"linid":1`, "", []string{"devid"}, false},
+		{"alarm negative linid", MessageTypeAlarm, `"devid":1,"linid":-1`, "", []string{"linid"}, false},
+		{"threshold", MessageTypeThreshold, `"devid":1,"vmin":"180","vmax":260,"cmax":"16","pmax":"3520"`,
+			`{"node_id":"node","group_id":"1","voltage_min":180,"voltage_max":260,"current_max":16,"power_max":3520}`, nil, false},
+		{"threshold missing values", MessageTypeThreshold, `"devid":"1","cmax":"16"`,
+			`{"node_id":"node","group_id":"1","voltage_min":null,"voltage_max":null,"current_max":16,"power_max":null}`, nil, false},
+		{"threshold invalid value", MessageTypeThreshold, `"devid":1,"vmin":"n/a","cmax":"16"`,
+			`{"node_id":"node","group_id":"1","voltage_min":null,"voltage_max":null,"current_max":16,"power_max":null}`, []string{"vmin"}, false},
+		{"threshold invalid devid", MessageTypeThreshold, `"devid":"x","cmax":"16"`, "", []string{"devid"}, false},
+		{"energy reset", MessageTypeEnergyReset, `"devid":"2","linid":"4","tim":"12:00"`,
+			`{"node_id":"node","group_id":"2","device_id":"8","time":"12:00"}`, nil, false},
+		{"energy reset group", MessageTypeEnergyReset, `"devid":2`, `{"node_id":"node","group_id":"2","time":""}`, nil, false},
+		{"control response", MessageTypeControlResponse, `"devid":"2","linid":"3","actid":"1","result":0`,
+			`{"node_id":"node","device_id":"7","action":1,"success":true}`, nil, false},
+		{"control response failed", MessageTypeControlResponse, `"devid":1,"linid":1,"actid":2,"result":"err"`,
+			`{"node_id":"node","device_id":"1","action":2,"success":false}`, nil, false},
+		{"control response invalid", MessageTypeControlResponse, `"devid":1,"linid":0,"actid":"x"`, "", []string{"linid", "actid"}, false},
+		{"control response unknown outlet", MessageTypeControlResponse, `"devid":9,"linid":1`, "", nil, true},
+		{"not json", MessageTypeThreshold, `<html>`, "", nil, true},
+	}
+	ctx := context.Background()
+	for i, tt := range tests {
+		// 节点信息不随database.Init清空，每个用例使用单独的节点
+		nodeID := fmt.Sprintf("node%v", i)
+		layout, _ := newOutletLayout(nil)
+		if _, err := decodeDeviceGroupMessage(layout, nodeID, deviceGroupPayload(2, 4)); err != nil {
+			t.Fatal(err)
+		}
+
+		err := yespeedMessageParsers[tt.messageType](ctx, layout, nodeID, []byte(tt.payload))
+		var paths []string
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			for _, fieldError := range decodeErr.Errors {
+				paths = append(paths, fieldError.Path)
+			}
+		} else if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(paths, tt.wantErrors) {
+			t.Errorf("%v: got error paths %v, want %v", tt.name, paths, tt.wantErrors)
+		}
+
+		info, ok := database.GetNodeInfo(ctx, nodeID)[tt.messageType]
+		got := ""
+		if ok {
+			data, _ := json.Marshal(info)
+			got = strings.Replace(string(data), nodeID, "node", 1)
+		}
+		if got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordUnknownMessage(t *testing.T) {
+	collector := &MQTTCollector{}
+	err := collector.setup(&entity.CollectorConfig{Name: "mqtt", MQTT: &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", ClientID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range unknownMessageSamples + 2 {
+		topic := "/yespeed/pdu/yespeed/node/out/7000001"
+		if i%2 == 1 {
+			topic = "/yespeed/pdu/yespeed/other/out/7000001"
+		}
+		collector.handleMessage(context.Background(), "Collector.MQTT", topic, []byte(`"i":`+string(rune('0'+i))))
+	}
+	collector.handleMessage(context.Background(), "Collector.MQTT", "/yespeed/pdu/yespeed/node/out/7000002", make([]byte, 2*unknownMessageSampleSize))
+
+	messages := make(map[string]*entity.UnknownMessage)
+	for _, message := range GetUnknownMessages(context.Background()) {
+		messages[message.MessageID] = message
+	}
+	first := messages["7000001"]
+	if first == nil || first.Count != unknownMessageSamples+2 || len(first.Samples) != unknownMessageSamples ||
+		len(first.Topics) != 2 || first.Samples[0] != `"i":0` {
+		t.Errorf("got %+v", first)
+	}
+	// 过长的样本被截断
+	if second := messages["7000002"]; second == nil || len(second.Samples[0]) != unknownMessageSampleSize+len("...") {
+		t.Errorf("got %+v", second)
+	}
+}
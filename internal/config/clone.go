@@ -0,0 +1,57 @@
+package config
+
+import "reflect"
+
+// Clone 深拷贝配置，各模块Init时会在配置上填充默认值，需要保留加载时的原样用于比较
+func (config *Config) Clone() *Config {
+	result := deepCopy(reflect.ValueOf(config))
+	return result.Interface().(*Config)
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		result := reflect.New(v.Type().Elem())
+		result.Elem().Set(deepCopy(v.Elem()))
+		return result
+	case reflect.Struct:
+		result := reflect.New(v.Type()).Elem()
+		for i := range v.NumField() {
+			if result.Field(i).CanSet() {
+				result.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return result
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		result := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			result.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		result := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			result.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return result
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		result := reflect.New(v.Type()).Elem()
+		result.Set(deepCopy(v.Elem()))
+		return result
+	}
+	result := reflect.New(v.Type()).Elem()
+	result.Set(v)
+	return result
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestClone(t *testing.T) {
+	limit := float32(10)
+	config := &Config{
+		Collectors: []*entity.CollectorConfig{{Name: "pdu", Type: "mqtt", MQTT: &entity.MQTTConfig{URL: "mqtt://127.0.0.1"}}},
+		Alarms:     []*entity.AlarmConfig{{Name: "hot", Max: &limit}},
+		Restore:    &entity.RestoreConfig{Nodes: map[string]string{"node": "always_on"}},
+	}
+	clone := config.Clone()
+	if !reflect.DeepEqual(config, clone) {
+		t.Fatalf("clone differs from the original")
+	}
+
+	config.Collectors[0].MQTT.URL = "mqtt://10.0.0.1"
+	*config.Alarms[0].Max = 20
+	config.Restore.Nodes["node"] = "always_off"
+	config.Restore.Settle = time.Second
+	if clone.Collectors[0].MQTT.URL != "mqtt://127.0.0.1" || *clone.Alarms[0].Max != 10 ||
+		clone.Restore.Nodes["node"] != "always_on" || clone.Restore.Settle != 0 {
+		t.Errorf("clone shares memory with the original: %+v", clone)
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+//go:generate go run ../../cmd/schema -o ../../configs/gateway.schema.json
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/alarm"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/broker"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/outletgroup"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/policy"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/publisher"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/scheduler"
+)
+
+type Config struct {
+	Broker       *entity.BrokerConfig         `yaml:"broker"`
+	Collectors   []*entity.CollectorConfig    `yaml:"collectors"`
+	Publishers   []*entity.PublisherConfig    `yaml:"publishers"`
+	Alarms       []*entity.AlarmConfig        `yaml:"alarms"`
+	LoadShedding []*entity.LoadSheddingConfig `yaml:"load_shedding"`
+	Scheduler    *entity.SchedulerConfig      `yaml:"scheduler"`
+	OutletGroups []*entity.OutletGroupConfig  `yaml:"outlet_groups"`
+	Restore      *entity.RestoreConfig        `yaml:"restore"`
+	Protection   *entity.ProtectionConfig     `yaml:"protection"`
+	API          *entity.APIConfig            `yaml:"api"`
+}
+
+// Load 严格解析配置文件，未知字段、重复字段和类型不匹配都会报错
+// 解析前展开${ENV}并读取X_file引用的文件，解析后应用GATEWAY__开头的环境变量，最后校验各组件的配置
+func Load(path string) (*Config, error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file failed, %v", err)
+	}
+	file, err := parser.ParseBytes(configBytes, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse config file failed\n%v", yaml.FormatError(err, false, true))
+	}
+
+	var config Config
+	if len(file.Docs) > 0 && file.Docs[0].Body != nil {
+		body, err := resolveNode(file.Docs[0].Body, reflect.TypeFor[Config](), "")
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.NodeToValue(body, &config, yaml.Strict()); err != nil {
+			return nil, fmt.Errorf("unmarshal config file failed\n%v", yaml.FormatError(err, false, true))
+		}
+	}
+	if err = applyEnvOverrides(&config, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate 收集全部错误一次返回，每条错误都带有从配置根开始的字段路径
+func (config *Config) Validate() error {
+	var errs []error
+	if config.Broker != nil {
+		if err := broker.ValidateConfig(config.Broker); err != nil {
+			errs = append(errs, fmt.Errorf("broker.%v", err))
+		}
+	}
+
+	if len(config.Collectors) == 0 {
+		errs = append(errs, fmt.Errorf("collectors is required"))
+	}
+	collectorNames := make(map[string]bool, len(config.Collectors))
+	for i, collectorConfig := range config.Collectors {
+		if collectorConfig == nil {
+			errs = append(errs, fmt.Errorf("collectors[%v] is empty", i))
+			continue
+		}
+		if err := collector.ValidateConfig(collectorConfig); err != nil {
+			errs = append(errs, fmt.Errorf("collectors[%v].%v", i, err))
+		}
+		if collectorConfig.Type == "embedded" && config.Broker == nil {
+			errs = append(errs, fmt.Errorf("collectors[%v].type embedded requires broker to be configured", i))
+		}
+		if err := checkName(collectorNames, collectorConfig.Name); err != nil {
+			errs = append(errs, fmt.Errorf("collectors[%v].%v", i, err))
+		}
+	}
+
+	if len(config.Publishers) == 0 {
+		errs = append(errs, fmt.Errorf("publishers is required"))
+	}
+	publisherNames := make(map[string]bool, len(config.Publishers))
+	for i, publisherConfig := range config.Publishers {
+		if publisherConfig == nil {
+			errs = append(errs, fmt.Errorf("publishers[%v] is empty", i))
+			continue
+		}
+		if err := publisher.ValidateConfig(publisherConfig); err != nil {
+			errs = append(errs, fmt.Errorf("publishers[%v].%v", i, err))
+		}
+		if err := checkName(publisherNames, publisherConfig.Name); err != nil {
+			errs = append(errs, fmt.Errorf("publishers[%v].%v", i, err))
+		}
+	}
+
+	alarmNames := make(map[string]bool, len(config.Alarms))
+	for i, alarmConfig := range config.Alarms {
+		if alarmConfig == nil {
+			errs = append(errs, fmt.Errorf("alarms[%v] is empty", i))
+			continue
+		}
+		if err := alarm.ValidateConfig(alarmConfig); err != nil {
+			errs = append(errs, fmt.Errorf("alarms[%v].%v", i, err))
+		}
+		if err := checkName(alarmNames, alarmConfig.Name); err != nil {
+			errs = append(errs, fmt.Errorf("alarms[%v].%v", i, err))
+		}
+	}
+	for i, sheddingConfig := range config.LoadShedding {
+		if sheddingConfig == nil {
+			errs = append(errs, fmt.Errorf("load_shedding[%v] is empty", i))
+		} else if err := policy.ValidateLoadShedding(sheddingConfig); err != nil {
+			errs = append(errs, fmt.Errorf("load_shedding[%v].%v", i, err))
+		}
+	}
+	if config.Scheduler != nil {
+		if err := scheduler.ValidateConfig(config.Scheduler); err != nil {
+			errs = append(errs, fmt.Errorf("scheduler.%v", err))
+		}
+	}
+	groupNames := make(map[string]bool, len(config.OutletGroups))
+	for i, groupConfig := range config.OutletGroups {
+		if groupConfig == nil {
+			errs = append(errs, fmt.Errorf("outlet_groups[%v] is empty", i))
+			continue
+		}
+		if err := outletgroup.ValidateConfig(groupConfig); err != nil {
+			errs = append(errs, fmt.Errorf("outlet_groups[%v].%v", i, err))
+		}
+		if err := checkName(groupNames, groupConfig.Name); err != nil {
+			errs = append(errs, fmt.Errorf("outlet_groups[%v].%v", i, err))
+		}
+	}
+	if config.Restore != nil {
+		if err := policy.ValidateRestore(config.Restore); err != nil {
+			errs = append(errs, fmt.Errorf("restore.%v", err))
+		}
+	}
+	if config.Protection != nil {
+		if err := collector.ValidateProtection(config.Protection); err != nil {
+			errs = append(errs, fmt.Errorf("protection.%v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkName 未配置名称时由Init按类型和序号生成，不会重复
+func checkName(names map[string]bool, name string) error {
+	if name == "" {
+		return nil
+	}
+	if names[name] {
+		return fmt.Errorf("name %q is duplicated", name)
+	}
+	names[name] = true
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const validTestConfig = `
+collectors:
+  - type: mqtt
+    mqtt:
+      url: mqtt://127.0.0.1:1883
+      client_id: collector
+publishers:
+  - type: webhook
+    webhook:
+      urls: [http://127.0.0.1/hook]
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadValid(t *testing.T) {
+	config, err := Load(writeTestConfig(t, validTestConfig+`
+alarms:
+  - name: over_current
+    scope: outlet
+    metric: current
+    max: 10
+restore:
+  nodes:
+    node: always_on
+outlet_groups:
+  - name: rack
+    members:
+      - node_id: node
+        outlets: ["1"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 校验不能填充默认值，默认值由各模块Init时处理
+	if config.Restore.Policy != "" || config.OutletGroups[0].DisplayName != "" {
+		t.Errorf("validate modified the config: %+v %+v", config.Restore, config.OutletGroups[0])
+	}
+}
+
+func TestLoadInvalidPolicySections(t *testing.T) {
+	_, err := Load(writeTestConfig(t, validTestConfig+`
+alarms:
+  - name: Over Current
+    scope: outlet
+    metric: current
+    max: 10
+  - name: no_limit
+    scope: group
+    metric: power
+  - name: over_current
+    scope: outlet
+    metric: current
+    max: 10
+  - name: over_current
+    scope: group
+    metric: current
+    max: 16
+load_shedding:
+  - name: rack
+    node_id: node
+    group_id: "1"
+    limit: 16
+  - name: negative
+    node_id: node
+    group_id: "1"
+    limit: 16
+    outlets: ["1"]
+    cooldown: -1s
+scheduler:
+  jobs:
+    - name: nightly
+      cron: "0 25 * * *"
+      node_id: node
+      action: off
+outlet_groups:
+  - name: rack
+    members:
+      - node_id: node
+        outlets: ["1"]
+  - name: rack
+    members: []
+restore:
+  policy: restore_first
+protection:
+  protected:
+    - node_id: node
+      outlets: ["1"]
+      mode: confirm
+`))
+	if err == nil {
+		t.Fatal("invalid config should be rejected")
+	}
+	wantPrefixes := []string{
+		`alarms[0].name "Over Current" must match`,
+		"alarms[1].min or max is required",
+		`alarms[3].name "over_current" is duplicated`,
+		"load_shedding[0].outlets is required",
+		"load_shedding[1].cooldown must not be negative",
+		`scheduler.jobs[0].cron "0 25 * * *" is invalid`,
+		"outlet_groups[1].members is empty",
+		`outlet_groups[1].name "rack" is duplicated`,
+		`restore.policy "restore_first" is invalid`,
+		"protection.protected[0].token is empty",
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(wantPrefixes) {
+		t.Errorf("got %v errors, want %v:\n%v", len(lines), len(wantPrefixes), err)
+	}
+	for _, prefix := range wantPrefixes {
+		if !slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, prefix) }) {
+			t.Errorf("missing error %q in:\n%v", prefix, err)
+		}
+	}
+}
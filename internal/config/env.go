@@ -0,0 +1,309 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+const (
+	// EnvPrefix 以该前缀开头的环境变量覆盖配置文件中的值，层级之间用__分隔，例如GATEWAY__COLLECTORS__0__MQTT__PASSWORD
+	EnvPrefix    = "GATEWAY__"
+	envSeparator = "__"
+	// fileSuffix 字符串字段X可以改写为X_file，值为文件路径，读取文件内容作为X的值
+	fileSuffix = "_file"
+)
+
+// envPattern ${NAME}或${NAME:-默认值}，$${转义为字面量${
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv 变量未设置且没有默认值时报错，避免带着空密码启动
+func expandEnv(value string) (string, error) {
+	var err error
+	result := envPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := envPattern.FindStringSubmatch(match)
+		env, ok := os.LookupEnv(groups[1])
+		if (!ok || env == "") && groups[2] != "" {
+			return groups[3]
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %v is not set", groups[1])
+		}
+		return env
+	})
+	return result, err
+}
+
+// readSecretFile Docker和Kubernetes的secret文件通常带有结尾换行
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// resolveNode 按目标类型遍历语法树，展开${ENV}并读取X_file引用的文件，在解码之前完成以保留原始的行号
+func resolveNode(node ast.Node, t reflect.Type, path string) (ast.Node, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch n := node.(type) {
+	case nil, *ast.NullNode, *ast.AliasNode:
+		return node, nil
+	case *ast.AnchorNode:
+		value, err := resolveNode(n.Value, t, path)
+		n.Value = value
+		return node, err
+	case *ast.TagNode:
+		value, err := resolveNode(n.Value, t, path)
+		n.Value = value
+		return node, err
+	}
+
+	// 整块写成${ENV}的列表和配置块按标量处理，展开后再转换为目标类型
+	if _, ok := node.(ast.ScalarNode); !ok && t != durationType {
+		switch t.Kind() {
+		case reflect.Struct:
+			return node, resolveStruct(node, t, path)
+		case reflect.Map:
+			for _, mappingValue := range mappingValues(node) {
+				key := mappingKey(mappingValue)
+				value, err := resolveNode(mappingValue.Value, t.Elem(), path+"."+key)
+				if err != nil {
+					return node, err
+				}
+				mappingValue.Value = value
+			}
+			return node, nil
+		case reflect.Slice:
+			sequence, ok := node.(*ast.SequenceNode)
+			if !ok {
+				return node, nil
+			}
+			for i, item := range sequence.Values {
+				value, err := resolveNode(item, t.Elem(), fmt.Sprintf("%v[%v]", path, i))
+				if err != nil {
+					return node, err
+				}
+				sequence.Values[i] = value
+			}
+			return node, nil
+		}
+	}
+	return resolveScalar(node, t, path)
+}
+
+// resolveScalar 字符串字段直接替换值，其它类型的字段先按目标类型转换展开后的文本，
+// 成功后重新解析为YAML节点并沿用原来的位置，后续解码报错时仍指向配置文件中的行号
+func resolveScalar(node ast.Node, t reflect.Type, path string) (ast.Node, error) {
+	var stringNode *ast.StringNode
+	switch n := node.(type) {
+	case *ast.StringNode:
+		stringNode = n
+	case *ast.LiteralNode:
+		stringNode = n.Value
+	default:
+		return node, nil
+	}
+	if !strings.Contains(stringNode.Value, "${") {
+		return node, nil
+	}
+	expanded, err := expandEnv(stringNode.Value)
+	if err != nil {
+		return node, fmt.Errorf("%v %v", path, err)
+	}
+	if t.Kind() == reflect.String && t != durationType {
+		stringNode.Value = expanded
+		return node, nil
+	}
+	if err = yaml.UnmarshalWithOptions([]byte(expanded), reflect.New(t).Interface(), yaml.Strict()); err != nil {
+		return node, fmt.Errorf("%v: %q is not a valid %v", path, expanded, typeName(t))
+	}
+	file, err := parser.ParseBytes([]byte(expanded), 0)
+	if err != nil || len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return node, fmt.Errorf("%v: %q is not a valid %v", path, expanded, typeName(t))
+	}
+	body := file.Docs[0].Body
+	if token := body.GetToken(); token != nil {
+		token.Position = stringNode.GetToken().Position
+	}
+	return body, nil
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t.Kind() == reflect.Slice:
+		return "list"
+	case t.Kind() == reflect.Struct || t.Kind() == reflect.Map:
+		return "mapping"
+	}
+	return t.Kind().String()
+}
+
+func resolveStruct(node ast.Node, t reflect.Type, path string) error {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if name := yamlFieldName(field); name != "" {
+			fields[name] = field
+		}
+	}
+
+	values := mappingValues(node)
+	keys := make([]string, 0, len(values))
+	for _, mappingValue := range values {
+		keys = append(keys, mappingKey(mappingValue))
+	}
+	for i, mappingValue := range values {
+		key := keys[i]
+		fieldPath := strings.TrimPrefix(path+"."+key, ".")
+		if field, ok := fields[key]; ok {
+			value, err := resolveNode(mappingValue.Value, field.Type, fieldPath)
+			if err != nil {
+				return err
+			}
+			mappingValue.Value = value
+			continue
+		}
+
+		// 未知字段留给严格解码报错，这里只处理X_file形式的引用
+		name, ok := strings.CutSuffix(key, fileSuffix)
+		if !ok {
+			continue
+		}
+		field, ok := fields[name]
+		if !ok || field.Type.Kind() != reflect.String {
+			continue
+		}
+		if slices.Contains(keys, name) {
+			return fmt.Errorf("%v and %v%v can not be set at the same time", strings.TrimPrefix(path+"."+name, "."), name, fileSuffix)
+		}
+		keyNode, ok := mappingValue.Key.(*ast.StringNode)
+		valueNode, isString := mappingValue.Value.(*ast.StringNode)
+		if !ok || !isString {
+			return fmt.Errorf("%v must be a file path", fieldPath)
+		}
+		filePath, err := expandEnv(valueNode.Value)
+		if err != nil {
+			return fmt.Errorf("%v %v", fieldPath, err)
+		}
+		content, err := readSecretFile(filePath)
+		if err != nil {
+			return fmt.Errorf("%v read %v failed, %v", fieldPath, filePath, err)
+		}
+		keyNode.Value = name
+		valueNode.Value = content
+	}
+	return nil
+}
+
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+func mappingKey(mappingValue *ast.MappingValueNode) string {
+	if scalar, ok := mappingValue.Key.(ast.ScalarNode); ok {
+		return fmt.Sprint(scalar.GetValue())
+	}
+	return mappingValue.Key.String()
+}
+
+// applyEnvOverrides 按变量名排序后依次覆盖，路径中间缺少的配置块会自动创建
+func applyEnvOverrides(config *Config, environ []string) error {
+	slices.Sort(environ)
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		segments, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || segments == "" {
+			continue
+		}
+		if err := setPath(reflect.ValueOf(config).Elem(), strings.Split(segments, envSeparator), value, ""); err != nil {
+			return fmt.Errorf("environment variable %v %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setPath(v reflect.Value, segments []string, value string, path string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), segments, value, path)
+	}
+	if len(segments) == 0 {
+		if v.Kind() == reflect.String {
+			v.SetString(value)
+			return nil
+		}
+		if err := yaml.UnmarshalWithOptions([]byte(value), v.Addr().Interface(), yaml.Strict()); err != nil {
+			return fmt.Errorf("can not set %v, %v", path, err)
+		}
+		return nil
+	}
+
+	segment := strings.ToLower(segments[0])
+	if v.Type() == durationType {
+		return fmt.Errorf("field %v.%v is unknown", path, segment)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			name := yamlFieldName(v.Type().Field(i))
+			if name != "" && name == segment {
+				return setPath(v.Field(i), segments[1:], value, strings.TrimPrefix(path+"."+name, "."))
+			}
+		}
+		return fmt.Errorf("field %v is unknown", strings.TrimPrefix(path+"."+segment, "."))
+	case reflect.Slice:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index > v.Len() {
+			return fmt.Errorf("%v index %v is out of range, %v items", path, segments[0], v.Len())
+		}
+		if index == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return setPath(v.Index(index), segments[1:], value, fmt.Sprintf("%v[%v]", path, index))
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		// 环境变量名一般是大写，优先匹配忽略大小写后相同的已有键
+		key := reflect.ValueOf(segment)
+		for _, existing := range v.MapKeys() {
+			if strings.EqualFold(existing.String(), segment) {
+				key = existing
+			}
+		}
+		element := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			element.Set(existing)
+		}
+		if err := setPath(element, segments[1:], value, path+"."+key.String()); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, element)
+		return nil
+	}
+	return fmt.Errorf("field %v.%v is unknown", path, segment)
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GATEWAY_TEST_HOST", "broker.local")
+	t.Setenv("GATEWAY_TEST_EMPTY", "")
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"mqtt://${GATEWAY_TEST_HOST}:1883", "mqtt://broker.local:1883", false},
+		{"${GATEWAY_TEST_UNSET:-fallback}", "fallback", false},
+		{"${GATEWAY_TEST_EMPTY:-fallback}", "fallback", false},
+		{"${GATEWAY_TEST_EMPTY}", "", false},
+		{"${GATEWAY_TEST_UNSET}", "", true},
+		{"$${GATEWAY_TEST_HOST}", "${GATEWAY_TEST_HOST}", false},
+		{"${GATEWAY_TEST_HOST}/${GATEWAY_TEST_UNSET:-a}", "broker.local/a", false},
+		{"no variables $HOME", "no variables $HOME", false},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// decodeTestConfig 与Load相同的解析流程，但不做校验
+func decodeTestConfig(t *testing.T, content string) (*Config, error) {
+	file, err := parser.ParseBytes([]byte(content), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := resolveNode(file.Docs[0].Body, reflect.TypeFor[Config](), "")
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err = yaml.NodeToValue(body, &config, yaml.Strict()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func TestResolveNode(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GATEWAY_TEST_SECRET", secret)
+	t.Setenv("GATEWAY_TEST_KEEPALIVE", "30")
+	t.Setenv("GATEWAY_TEST_TIMEOUT", "5s")
+	t.Setenv("GATEWAY_TEST_URLS", "[mqtt://a, mqtt://b]")
+	t.Setenv("GATEWAY_TEST_WORD", "abc")
+
+	tests := []struct {
+		name    string
+		mqtt    string
+		check   func(config *Config) bool
+		wantErr string
+	}{
+		{name: "password file", mqtt: "password_file: " + secret,
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.Password == "s3cret" }},
+		{name: "password file from env", mqtt: "password_file: ${GATEWAY_TEST_SECRET}",
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.Password == "s3cret" }},
+		{name: "escaped password", mqtt: "password: p$${x}",
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.Password == "p${x}" }},
+		{name: "integer", mqtt: "keepalive: ${GATEWAY_TEST_KEEPALIVE}",
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.Keepalive == 30 }},
+		{name: "duration", mqtt: "connect_timeout: ${GATEWAY_TEST_TIMEOUT}",
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.ConnectTimeout == 5*time.Second }},
+		{name: "list", mqtt: "urls: ${GATEWAY_TEST_URLS}",
+			check: func(config *Config) bool { return len(config.Collectors[0].MQTT.URLs) == 2 }},
+		{name: "password and file", mqtt: "password: a\n      password_file: " + secret,
+			wantErr: "collectors[0].mqtt.password and password_file can not be set at the same time"},
+		{name: "missing file", mqtt: "password_file: /nonexistent",
+			wantErr: "collectors[0].mqtt.password_file read /nonexistent failed"},
+		{name: "unset variable", mqtt: "password: ${GATEWAY_TEST_UNSET}",
+			wantErr: "collectors[0].mqtt.password environment variable GATEWAY_TEST_UNSET is not set"},
+		{name: "invalid integer", mqtt: "keepalive: ${GATEWAY_TEST_WORD}",
+			wantErr: `collectors[0].mqtt.keepalive: "abc" is not a valid uint16`},
+		{name: "invalid duration", mqtt: "connect_timeout: ${GATEWAY_TEST_WORD}",
+			wantErr: `collectors[0].mqtt.connect_timeout: "abc" is not a valid duration`},
+		{name: "invalid list", mqtt: "urls: ${GATEWAY_TEST_WORD}",
+			wantErr: `collectors[0].mqtt.urls: "abc" is not a valid list`},
+	}
+	for _, tt := range tests {
+		config, err := decodeTestConfig(t, "collectors:\n  - type: mqtt\n    mqtt:\n      "+tt.mqtt+"\n")
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if !tt.check(config) {
+			t.Errorf("%v: unexpected result %+v", tt.name, config.Collectors[0].MQTT)
+		}
+	}
+}
+
+func TestResolveNodeKeepsPosition(t *testing.T) {
+	t.Setenv("GATEWAY_TEST_KEEPALIVE", "30")
+	file, err := parser.ParseBytes([]byte("collectors:\n  - type: mqtt\n    mqtt:\n      keepalive: ${GATEWAY_TEST_KEEPALIVE}\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := resolveNode(file.Docs[0].Body, reflect.TypeFor[Config](), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := yaml.PathString("$.collectors[0].mqtt.keepalive")
+	node, err := path.FilterNode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := node.GetToken().Position; node.String() != "30" || position.Line != 4 || position.Column != 18 {
+		t.Errorf("got %v at %v:%v, want 30 at 4:18", node, position.Line, position.Column)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		check   func(config *Config) bool
+		wantErr string
+	}{
+		{name: "existing item", environ: []string{"GATEWAY__COLLECTORS__0__MQTT__PASSWORD=secret"},
+			check: func(config *Config) bool { return config.Collectors[0].MQTT.Password == "secret" }},
+		{name: "append item", environ: []string{"GATEWAY__COLLECTORS__1__TYPE=http", "GATEWAY__COLLECTORS__1__NAME=second"},
+			check: func(config *Config) bool {
+				return len(config.Collectors) == 2 && config.Collectors[1].Type == "http" && config.Collectors[1].Name == "second"
+			}},
+		{name: "typed value", environ: []string{"GATEWAY__COLLECTORS__0__MQTT__KEEPALIVE=15", "GATEWAY__COLLECTORS__0__MQTT__URLS=[mqtt://a]"},
+			check: func(config *Config) bool {
+				return config.Collectors[0].MQTT.Keepalive == 15 && len(config.Collectors[0].MQTT.URLs) == 1
+			}},
+		{name: "new section", environ: []string{"GATEWAY__API__LISTEN=:9090"},
+			check: func(config *Config) bool { return config.API != nil && config.API.Listen == ":9090" }},
+		{name: "map existing key", environ: []string{"GATEWAY__RESTORE__NODES__NODEA=always_off"},
+			check: func(config *Config) bool {
+				return len(config.Restore.Nodes) == 1 && config.Restore.Nodes["NodeA"] == "always_off"
+			}},
+		{name: "map new key", environ: []string{"GATEWAY__RESTORE__NODES__NODEB=always_on"},
+			check: func(config *Config) bool { return config.Restore.Nodes["nodeb"] == "always_on" }},
+		{name: "other variables", environ: []string{"HOME=/root", "GATEWAY__=x"},
+			check: func(config *Config) bool { return config.API == nil }},
+		{name: "unknown field", environ: []string{"GATEWAY__COLLECTORS__0__MQTT__UNKNOWN=1"},
+			wantErr: "environment variable GATEWAY__COLLECTORS__0__MQTT__UNKNOWN field collectors[0].mqtt.unknown is unknown"},
+		{name: "index out of range", environ: []string{"GATEWAY__COLLECTORS__5__TYPE=http"},
+			wantErr: "environment variable GATEWAY__COLLECTORS__5__TYPE collectors index 5 is out of range, 1 items"},
+		{name: "invalid value", environ: []string{"GATEWAY__COLLECTORS__0__MQTT__KEEPALIVE=abc"},
+			wantErr: "environment variable GATEWAY__COLLECTORS__0__MQTT__KEEPALIVE can not set collectors[0].mqtt.keepalive"},
+	}
+	for _, tt := range tests {
+		config, err := decodeTestConfig(t, "collectors:\n  - type: mqtt\n    mqtt:\n      url: mqtt://127.0.0.1\nrestore:\n  nodes:\n    NodeA: always_on\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = applyEnvOverrides(config, tt.environ)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if !tt.check(config) {
+			t.Errorf("%v: unexpected result %+v", tt.name, config)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/publisher"
+)
+
+const (
+	schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	// durationPattern time.ParseDuration接受的格式，例如10s、1m30s
+	durationPattern = `^(0|-?([0-9]*\.?[0-9]+(ns|us|µs|ms|s|m|h))+)$`
+	// envReferencePattern 非字符串字段也可以写成${ENV}，在解析前展开
+	envReferencePattern = `\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}`
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// schemaEnums 反射拿不到的取值范围，键为{结构体名}.{字段名}
+var schemaEnums = map[string][]any{
+	"CollectorConfig.Type":     toAny(collector.Types),
+	"PublisherConfig.Type":     toAny(publisher.Types),
+	"TLSConfig.MinVersion":     {"1.0", "1.1", "1.2", "1.3"},
+	"SNMPDeviceConfig.Version": {"2c", "3"},
+	"SNMPDeviceConfig.SecurityLevel": {
+		"noAuthNoPriv", "authNoPriv", "authPriv",
+	},
+	"ModbusRegisterConfig.Table":    {"coil", "discrete_input", "holding", "input"},
+	"ModbusRegisterConfig.DataType": {"uint16", "int16", "uint32", "int32", "float32"},
+}
+
+// schemaDescriptions 编辑器中显示的结构体说明，键为结构体名
+var schemaDescriptions = map[string]string{
+	"MQTTConfig": "Only MQTT 5 brokers are supported. Devices on an MQTT 3.1.1 only broker can connect to the built-in broker instead.",
+}
+
+// schemaRequiredBlocks 采集器和发布器按type要求对应的配置块
+var schemaRequiredBlocks = map[string]map[string]string{
+	"CollectorConfig": {"mqtt": "mqtt", "http": "http", "snmp": "snmp", "modbus": "modbus"},
+	"PublisherConfig": {"hass_mqtt": "mqtt", "webhook": "webhook"},
+}
+
+// Schema 根据Config的yaml标签通过反射生成JSON Schema，供编辑器补全和校验
+func Schema() map[string]any {
+	builder := &schemaBuilder{defs: make(map[string]any)}
+	root := builder.object(reflect.TypeFor[Config]())
+	root["$schema"] = schemaDraft
+	root["title"] = "Yespeed PDU Gateway"
+	root["$defs"] = builder.defs
+	return root
+}
+
+type schemaBuilder struct {
+	defs map[string]any
+}
+
+func (builder *schemaBuilder) build(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		return builder.build(t.Elem())
+	}
+	if t == durationType {
+		return withEnvReference(map[string]any{"type": "string", "pattern": durationPattern})
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := builder.defs[t.Name()]; !ok {
+			builder.defs[t.Name()] = nil // 先占位，避免自引用的结构体无限递归
+			builder.defs[t.Name()] = builder.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": builder.build(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": builder.build(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return withEnvReference(map[string]any{"type": "boolean"})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return withEnvReference(map[string]any{"type": "integer"})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		result := map[string]any{"type": "integer", "minimum": 0}
+		if t.Bits() < 64 {
+			result["maximum"] = uint64(1)<<t.Bits() - 1
+		}
+		return withEnvReference(result)
+	case reflect.Float32, reflect.Float64:
+		return withEnvReference(map[string]any{"type": "number"})
+	}
+	return map[string]any{}
+}
+
+func (builder *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := yamlFieldName(field)
+		if name == "" {
+			continue
+		}
+		property := builder.build(field.Type)
+		if enum, ok := schemaEnums[t.Name()+"."+field.Name]; ok {
+			if alternatives, ok := property["anyOf"].([]any); ok {
+				alternatives[0].(map[string]any)["enum"] = enum
+			} else {
+				property["enum"] = enum
+			}
+		}
+		properties[name] = property
+		// 本身就是文件路径的字段不再提供X_file写法
+		if field.Type.Kind() == reflect.String && !strings.HasSuffix(name, fileSuffix) {
+			properties[name+fileSuffix] = map[string]any{"type": "string"}
+		}
+	}
+	result := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if description, ok := schemaDescriptions[t.Name()]; ok {
+		result["description"] = description
+	}
+
+	if blocks, ok := schemaRequiredBlocks[t.Name()]; ok {
+		rules := make([]any, 0, len(blocks))
+		for _, typeName := range slices.Sorted(maps.Keys(blocks)) {
+			block := blocks[typeName]
+			rules = append(rules, map[string]any{
+				"if":   map[string]any{"properties": map[string]any{"type": map[string]any{"const": typeName}}},
+				"then": map[string]any{"required": []string{block}},
+			})
+		}
+		result["required"] = []string{"type"}
+		result["allOf"] = rules
+	}
+	return result
+}
+
+func withEnvReference(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "string", "pattern": envReferencePattern}}}
+}
+
+func toAny(values []string) []any {
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+// yamlFieldName 没有yaml标签或不导出的字段返回空字符串
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" || !field.IsExported() {
+		return ""
+	}
+	return name
+}
@@ -3,25 +3,60 @@ package database
 import (
 	"context"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+const (
+	nodeOfflineTimeout = 3 * time.Minute
+	// reportBoundary 同一条上报会连续写入多个设备，间隔小于它的写入视为同一次上报
+	reportBoundary = time.Second
+	// resumeGapFactor 两次上报的间隔超过平均上报间隔的这个倍数时认为节点中断过，通常是重启，
+	// 丢失一两条QoS 0上报不会达到这个倍数
+	resumeGapFactor = 3
+	// resumeMinGap 同时要求间隔不小于它，上报很频繁的节点短暂抖动不视为重启
+	resumeMinGap = time.Minute
 )
 
 var (
-	lock  sync.RWMutex
-	memDb map[string]map[string]*MemoryCell
+	lock         sync.RWMutex
+	memDb        map[string]map[string]*MemoryCell
+	groupDb      map[string]map[string]*entity.PDUGroup
+	nodeLastSeen map[string]time.Time
+	nodeInterval map[string]time.Duration // 节点的平均上报间隔，用于识别短时间的中断
+	offlineNodes map[string]bool
 )
 
 type MemoryCell struct {
 	LastSeen  time.Time
 	Type      entity.DeviceType
 	PduDevice *entity.PDUDevice
+	AcDevice  *entity.ACDevice
 }
 
 func Init(ctx context.Context) {
 	memDb = make(map[string]map[string]*MemoryCell)
+	groupDb = make(map[string]map[string]*entity.PDUGroup)
+	nodeLastSeen = make(map[string]time.Time)
+	nodeInterval = make(map[string]time.Duration)
+	offlineNodes = make(map[string]bool)
+
+	offlineTicker := time.NewTicker(30 * time.Second)
+	go func() {
+		defer offlineTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-offlineTicker.C:
+				checkOfflineNodes(ctx)
+			}
+		}
+	}()
 
 	//ticker := time.NewTicker(1 * time.Hour)
 	//go func() {
@@ -37,6 +72,24 @@ func Init(ctx context.Context) {
 	//}()
 }
 
+func checkOfflineNodes(ctx context.Context) {
+	now := time.Now()
+	events := make([]*entity.Event, 0)
+	lock.Lock()
+	for nodeId, lastSeen := range nodeLastSeen {
+		if !offlineNodes[nodeId] && lastSeen.Add(nodeOfflineTimeout).Before(now) {
+			offlineNodes[nodeId] = true
+			events = append(events, &entity.Event{Type: entity.EventTypeNodeOffline, NodeID: nodeId, Timestamp: now})
+		}
+	}
+	lock.Unlock()
+
+	for _, e := range events {
+		slog.Warn("Database: node offline", "nodeId", e.NodeID)
+		event.Publish(ctx, e)
+	}
+}
+
 //func cleanOfflineDevices() {
 //	now := time.Now()
 //	lock.Lock()
@@ -48,23 +101,31 @@ func Init(ctx context.Context) {
 //	}
 //}
 
-func SetPUDDevice(_ context.Context, nodeId string, deviceId string, device *entity.PDUDevice) {
+func SetPUDDevice(ctx context.Context, nodeId string, deviceId string, device *entity.PDUDevice) {
 	now := time.Now()
+	events := make([]*entity.Event, 0, 3)
+	defer func() {
+		for _, e := range events {
+			event.Publish(ctx, e)
+		}
+	}()
+
 	lock.Lock()
 	defer lock.Unlock()
 
-	nodeDevices, ok := memDb[nodeId]
-	if !ok {
-		nodeDevices = make(map[string]*MemoryCell)
-		memDb[nodeId] = nodeDevices
+	if e := touchNode(nodeId, now); e != nil {
+		events = append(events, e)
 	}
+	nodeDevices := nodeCells(nodeId)
 
+	var old *entity.PDUDevice
 	if value, ok := nodeDevices[deviceId]; ok {
 		if value.Type != entity.DeviceTypePDU {
 			slog.Warn("Database: set device failed, type changed",
 				"deviceId", deviceId, "nodeId", nodeId, "old", value.Type)
 			return
 		}
+		old = value.PduDevice
 		value.LastSeen = now
 		value.PduDevice = device
 	} else {
@@ -74,6 +135,87 @@ func SetPUDDevice(_ context.Context, nodeId string, deviceId string, device *ent
 			PduDevice: device,
 		}
 	}
+
+	events = append(events, &entity.Event{
+		Type: entity.EventTypeDeviceUpdated, NodeID: nodeId, DeviceID: deviceId, Old: old, New: device, Timestamp: now,
+	})
+	if old != nil && old.On != device.On {
+		events = append(events, &entity.Event{
+			Type: entity.EventTypeOutletSwitched, NodeID: nodeId, DeviceID: deviceId, Old: old, New: device, Timestamp: now,
+		})
+	}
+}
+
+// touchNode 刷新节点的最后上报时间，调用方需持有写锁
+// 节点首次出现或从离线恢复时返回上线事件；未到离线超时，但上报间隔明显变长时返回恢复事件，
+// PDU断电重启通常在离线超时之前就恢复上报
+func touchNode(nodeId string, now time.Time) *entity.Event {
+	lastSeen, ok := nodeLastSeen[nodeId]
+	nodeLastSeen[nodeId] = now
+	if !ok || offlineNodes[nodeId] {
+		if ok {
+			slog.Info("Database: node back online", "nodeId", nodeId, "lastSeen", lastSeen)
+		}
+		delete(offlineNodes, nodeId)
+		delete(nodeInterval, nodeId)
+		return &entity.Event{Type: entity.EventTypeNodeOnline, NodeID: nodeId, Timestamp: now}
+	}
+
+	gap := now.Sub(lastSeen)
+	if gap < reportBoundary {
+		return nil
+	}
+	interval, ok := nodeInterval[nodeId]
+	if !ok {
+		nodeInterval[nodeId] = gap
+		return nil
+	}
+	if gap > resumeGapFactor*interval && gap >= resumeMinGap {
+		slog.Info("Database: node resumed after report gap", "nodeId", nodeId, "gap", gap, "interval", interval)
+		return &entity.Event{Type: entity.EventTypeNodeResumed, NodeID: nodeId, Timestamp: now}
+	}
+	// 平滑更新，偶尔的抖动不会让间隔剧烈变化
+	nodeInterval[nodeId] = (interval*3 + gap) / 4
+	return nil
+}
+
+// nodeCells 调用方需持有写锁
+func nodeCells(nodeId string) map[string]*MemoryCell {
+	nodeDevices, ok := memDb[nodeId]
+	if !ok {
+		nodeDevices = make(map[string]*MemoryCell)
+		memDb[nodeId] = nodeDevices
+	}
+	return nodeDevices
+}
+
+// SetACDevice 空调类设备组以ac_{设备组ID}为键，与插座的全局ID区分
+func SetACDevice(ctx context.Context, nodeId string, deviceId string, device *entity.ACDevice) {
+	now := time.Now()
+	lock.Lock()
+	e := touchNode(nodeId, now)
+	nodeDevices := nodeCells(nodeId)
+	if value, ok := nodeDevices[deviceId]; ok {
+		if value.Type != entity.DeviceTypeAC {
+			lock.Unlock()
+			slog.Warn("Database: set device failed, type changed",
+				"deviceId", deviceId, "nodeId", nodeId, "old", value.Type)
+			return
+		}
+		value.LastSeen = now
+		value.AcDevice = device
+	} else {
+		nodeDevices[deviceId] = &MemoryCell{
+			LastSeen: now,
+			Type:     entity.DeviceTypeAC,
+			AcDevice: device,
+		}
+	}
+	lock.Unlock()
+
+	if e != nil {
+		event.Publish(ctx, e)
+	}
 }
 
 func GetAllPDUNodes(_ context.Context) []string {
@@ -86,6 +228,15 @@ func GetAllPDUNodes(_ context.Context) []string {
 	return result
 }
 
+func GetPDUDevice(_ context.Context, nodeId string, deviceId string) *entity.PDUDevice {
+	lock.RLock()
+	defer lock.RUnlock()
+	if value, ok := memDb[nodeId][deviceId]; ok && value.Type == entity.DeviceTypePDU {
+		return value.PduDevice
+	}
+	return nil
+}
+
 func GetPDUNodeDevices(_ context.Context, nodeId string) []*MemoryCell {
 	lock.RLock()
 	defer lock.RUnlock()
@@ -98,3 +249,46 @@ func GetPDUNodeDevices(_ context.Context, nodeId string) []*MemoryCell {
 	}
 	return nil
 }
+
+func SetPDUGroup(ctx context.Context, nodeId string, groupId string, group *entity.PDUGroup) {
+	lock.Lock()
+	nodeGroups, ok := groupDb[nodeId]
+	if !ok {
+		nodeGroups = make(map[string]*entity.PDUGroup)
+		groupDb[nodeId] = nodeGroups
+	}
+	nodeGroups[groupId] = group
+	lock.Unlock()
+
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeGroupUpdated, NodeID: nodeId, Group: group})
+}
+
+func GetPDUNodeGroups(_ context.Context, nodeId string) []*entity.PDUGroup {
+	lock.RLock()
+	defer lock.RUnlock()
+	if groups, ok := groupDb[nodeId]; ok {
+		result := make([]*entity.PDUGroup, 0, len(groups))
+		for _, group := range groups {
+			result = append(result, group)
+		}
+		return result
+	}
+	return nil
+}
+
+// GetFreshness 返回最近一次收到任意节点数据的时间、节点总数和当前离线的节点，没有数据时lastUpdate为零值
+func GetFreshness(_ context.Context) (lastUpdate time.Time, nodes int, offline []string) {
+	lock.RLock()
+	defer lock.RUnlock()
+	offline = make([]string, 0, len(offlineNodes))
+	for nodeId, lastSeen := range nodeLastSeen {
+		if lastSeen.After(lastUpdate) {
+			lastUpdate = lastSeen
+		}
+		if offlineNodes[nodeId] {
+			offline = append(offline, nodeId)
+		}
+	}
+	sort.Strings(offline)
+	return lastUpdate, len(nodeLastSeen), offline
+}
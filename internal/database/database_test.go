@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestTouchNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Init(ctx)
+
+	start := time.Now()
+	at := func(offset time.Duration) time.Time {
+		return start.Add(offset)
+	}
+	tests := []struct {
+		name    string
+		now     time.Time
+		offline bool             // 模拟离线检查已将节点标记为离线
+		want    entity.EventType // 空字符串表示没有事件
+	}{
+		{"first report", at(0), false, entity.EventTypeNodeOnline},
+		{"same report", at(10 * time.Millisecond), false, ""},
+		{"learn interval", at(10 * time.Second), false, ""},
+		{"regular report", at(20 * time.Second), false, ""},
+		{"jitter", at(32 * time.Second), false, ""},
+		{"one report dropped", at(53 * time.Second), false, ""},
+		{"two reports dropped", at(85 * time.Second), false, ""},
+		{"reboot under offline timeout", at(150 * time.Second), false, entity.EventTypeNodeResumed},
+		{"regular after reboot", at(160 * time.Second), false, ""},
+		{"back from offline", at(160*time.Second + nodeOfflineTimeout), true, entity.EventTypeNodeOnline},
+		{"interval relearned", at(170*time.Second + nodeOfflineTimeout), false, ""},
+	}
+	for _, tt := range tests {
+		lock.Lock()
+		if tt.offline {
+			offlineNodes["node"] = true
+		}
+		e := touchNode("node", tt.now)
+		lock.Unlock()
+		var got entity.EventType
+		if e != nil {
+			got = e.Type
+		}
+		if got != tt.want {
+			t.Errorf("%v: got event %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+var (
+	desiredLock      sync.RWMutex
+	desiredStates    = make(map[string]map[string]bool)
+	desiredStateFile string
+)
+
+// LoadDesiredStates 从文件恢复插座的期望状态，之后每次修改都会写回该文件
+func LoadDesiredStates(_ context.Context, file string) error {
+	desiredLock.Lock()
+	defer desiredLock.Unlock()
+	desiredStateFile = file
+	stateBytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(stateBytes, &desiredStates)
+}
+
+// SetDesiredState 记录最后一次下发给插座的开关状态
+func SetDesiredState(_ context.Context, nodeId string, deviceId string, on bool) {
+	desiredLock.Lock()
+	defer desiredLock.Unlock()
+	nodeStates, ok := desiredStates[nodeId]
+	if !ok {
+		nodeStates = make(map[string]bool)
+		desiredStates[nodeId] = nodeStates
+	}
+	if old, ok := nodeStates[deviceId]; ok && old == on {
+		return
+	}
+	nodeStates[deviceId] = on
+
+	if desiredStateFile == "" {
+		return
+	}
+	stateBytes, _ := json.MarshalIndent(desiredStates, "", "  ")
+	if err := os.WriteFile(desiredStateFile, stateBytes, 0644); err != nil {
+		slog.Error("Database: write desired state file failed", "file", desiredStateFile, "err", err)
+	}
+}
+
+func GetDesiredState(_ context.Context, nodeId string, deviceId string) (bool, bool) {
+	desiredLock.RLock()
+	defer desiredLock.RUnlock()
+	on, ok := desiredStates[nodeId][deviceId]
+	return on, ok
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+var (
+	nodeInfoLock sync.RWMutex
+	nodeInfos    = make(map[string]map[string]any)
+)
+
+// SetNodeInfo 保存节点上报的非遥测类消息，key为消息类型，只保留最新一条
+func SetNodeInfo(_ context.Context, nodeId string, key string, value any) {
+	nodeInfoLock.Lock()
+	defer nodeInfoLock.Unlock()
+	infos, ok := nodeInfos[nodeId]
+	if !ok {
+		infos = make(map[string]any)
+		nodeInfos[nodeId] = infos
+	}
+	infos[key] = value
+}
+
+func GetNodeInfo(_ context.Context, nodeId string) map[string]any {
+	nodeInfoLock.RLock()
+	defer nodeInfoLock.RUnlock()
+	return maps.Clone(nodeInfos[nodeId])
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+var (
+	lock        sync.RWMutex
+	subscribers = make(map[chan *entity.Event]string)
+)
+
+// Subscribe 订阅事件流，name仅用于日志，size为缓冲区大小，缓冲区满时新事件会被丢弃
+func Subscribe(name string, size int) chan *entity.Event {
+	ch := make(chan *entity.Event, size)
+	lock.Lock()
+	defer lock.Unlock()
+	subscribers[ch] = name
+	return ch
+}
+
+func Unsubscribe(ch chan *entity.Event) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := subscribers[ch]; ok {
+		delete(subscribers, ch)
+		close(ch)
+	}
+}
+
+func Publish(_ context.Context, event *entity.Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+	for ch, name := range subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Event: subscriber is full, event dropped", "subscriber", name, "type", event.Type)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package mqttclient
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/utils"
+)
+
+// schemes autopaho支持的broker地址协议
+var schemes = []string{"mqtt", "tcp", "mqtts", "ssl", "tls", "mqtt+ssl", "tcps", "ws", "wss"}
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultReconnectDelay = 10 * time.Second
+	defaultSessionExpiry  = 60 * time.Second
+	defaultSubscribeQoS   = 1
+	backoffFactor         = 2
+)
+
+// Configure 按MQTTConfig填充连接相关的配置，回调和paho.ClientConfig由调用方设置
+func Configure(clientConfig *autopaho.ClientConfig, config *entity.MQTTConfig) error {
+	clientConfig.KeepAlive = config.Keepalive
+	clientConfig.ConnectUsername = config.Username
+	clientConfig.ConnectPassword = []byte(config.Password)
+	if err := validateOptions(config); err != nil {
+		return err
+	}
+	// CleanStartOnInitialConnection defaults to false. Setting this to true will clear the session on the first connection.
+	clientConfig.CleanStartOnInitialConnection = config.CleanStart
+	// SessionExpiryInterval - Seconds that a session will survive after disconnection.
+	// It is important to set this because otherwise, any queued messages will be lost if the connection drops and
+	// the server will not queue messages while it is down. The specific setting will depend upon your needs
+	// (60 = 1 minute, 3600 = 1 hour, 86400 = one day, 0xFFFFFFFE = 136 years, 0xFFFFFFFF = don't expire)
+	sessionExpiry := defaultSessionExpiry
+	if config.SessionExpiry != nil {
+		sessionExpiry = *config.SessionExpiry
+	}
+	clientConfig.SessionExpiryInterval = uint32(min(sessionExpiry/time.Second, math.MaxUint32))
+
+	var err error
+	if clientConfig.ServerUrls, err = ServerURLs(config); err != nil {
+		return err
+	}
+	if clientConfig.TlsCfg, err = utils.NewTLSConfig(config.TLS); err != nil {
+		return err
+	}
+	clientConfig.ConnectTimeout = defaultConnectTimeout
+	if config.ConnectTimeout > 0 {
+		clientConfig.ConnectTimeout = config.ConnectTimeout
+	}
+	if clientConfig.ReconnectBackoff, err = reconnectBackoff(config); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate 只校验配置，不建立连接，错误信息中的字段路径相对于mqtt配置
+func Validate(config *entity.MQTTConfig) error {
+	if err := validateOptions(config); err != nil {
+		return err
+	}
+	if _, err := ServerURLs(config); err != nil {
+		return err
+	}
+	if _, err := utils.NewTLSConfig(config.TLS); err != nil {
+		return err
+	}
+	if _, err := reconnectBackoff(config); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateOptions(config *entity.MQTTConfig) error {
+	if config.SessionExpiry != nil && *config.SessionExpiry < 0 {
+		return fmt.Errorf("session_expiry must not be negative")
+	}
+	if config.SubscribeQoS != nil && *config.SubscribeQoS > 2 {
+		return fmt.Errorf("subscribe_qos %v must be 0, 1 or 2", *config.SubscribeQoS)
+	}
+	for name, publish := range map[string]*entity.MQTTPublishConfig{
+		"state_publish":     config.StatePublish,
+		"discovery_publish": config.DiscoveryPublish,
+		"command_publish":   config.CommandPublish,
+	} {
+		if publish != nil && publish.QoS != nil && *publish.QoS > 2 {
+			return fmt.Errorf("%v.qos %v must be 0, 1 or 2", name, *publish.QoS)
+		}
+	}
+	return nil
+}
+
+// SubscribeQoS 订阅使用的QoS，默认1
+func SubscribeQoS(config *entity.MQTTConfig) byte {
+	if config.SubscribeQoS != nil {
+		return *config.SubscribeQoS
+	}
+	return defaultSubscribeQoS
+}
+
+// PublishOptions 未配置的项使用调用方给出的默认值
+func PublishOptions(config *entity.MQTTPublishConfig, defaultQoS byte, defaultRetain bool) (byte, bool) {
+	qos, retain := defaultQoS, defaultRetain
+	if config != nil && config.QoS != nil {
+		qos = *config.QoS
+	}
+	if config != nil && config.Retain != nil {
+		retain = *config.Retain
+	}
+	return qos, retain
+}
+
+// ServerURLs 返回按故障转移顺序排列的broker地址，每次重连都从第一个开始尝试，重复的地址只保留第一次出现的位置
+func ServerURLs(config *entity.MQTTConfig) ([]*url.URL, error) {
+	rawURLs := make([]string, 0, len(config.URLs)+1)
+	if config.URL != "" {
+		rawURLs = append(rawURLs, config.URL)
+	}
+	rawURLs = append(rawURLs, config.URLs...)
+	if len(rawURLs) == 0 {
+		return nil, fmt.Errorf("url or urls is required")
+	}
+
+	result := make([]*url.URL, 0, len(rawURLs))
+	for _, rawURL := range rawURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("url %q is invalid, %v", rawURL, err)
+		}
+		if !slices.Contains(schemes, u.Scheme) {
+			return nil, fmt.Errorf("url %q scheme must be one of %v", rawURL, strings.Join(schemes, ", "))
+		}
+		if slices.ContainsFunc(result, func(existing *url.URL) bool { return existing.String() == u.String() }) {
+			continue
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+func reconnectBackoff(config *entity.MQTTConfig) (autopaho.Backoff, error) {
+	minDelay := config.ReconnectMinDelay
+	if minDelay <= 0 {
+		minDelay = defaultReconnectDelay
+	}
+	if config.ReconnectMaxDelay <= 0 || config.ReconnectMaxDelay == minDelay {
+		return autopaho.NewConstantBackoff(minDelay), nil
+	}
+	if config.ReconnectMaxDelay < minDelay {
+		return nil, fmt.Errorf("reconnect_max_delay %v is less than reconnect_min_delay %v", config.ReconnectMaxDelay, minDelay)
+	}
+	return autopaho.NewExponentialBackoff(minDelay, config.ReconnectMaxDelay, minDelay, backoffFactor), nil
+}
@@ -0,0 +1,181 @@
+package mqttclient
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestServerURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *entity.MQTTConfig
+		want    []string
+		wantErr string
+	}{
+		{"url only", &entity.MQTTConfig{URL: "mqtt://a:1883"}, []string{"mqtt://a:1883"}, ""},
+		{"urls only", &entity.MQTTConfig{URLs: []string{"mqtt://b:1883", "mqtts://c:8883"}}, []string{"mqtt://b:1883", "mqtts://c:8883"}, ""},
+		{"url before urls", &entity.MQTTConfig{URL: "mqtt://a:1883", URLs: []string{"mqtt://b:1883", "ws://c:8080/mqtt"}},
+			[]string{"mqtt://a:1883", "mqtt://b:1883", "ws://c:8080/mqtt"}, ""},
+		{"duplicate in url and urls", &entity.MQTTConfig{URL: "mqtt://a:1883", URLs: []string{"mqtt://b:1883", "mqtt://a:1883"}},
+			[]string{"mqtt://a:1883", "mqtt://b:1883"}, ""},
+		{"duplicate in urls", &entity.MQTTConfig{URLs: []string{"mqtt://b:1883", "mqtt://c:1883", "mqtt://b:1883"}},
+			[]string{"mqtt://b:1883", "mqtt://c:1883"}, ""},
+		{"missing", &entity.MQTTConfig{}, nil, "url or urls is required"},
+		{"invalid url", &entity.MQTTConfig{URL: "mqtt://a:1883", URLs: []string{"mqtt://%zz"}}, nil, `url "mqtt://%zz" is invalid`},
+		{"invalid scheme", &entity.MQTTConfig{URLs: []string{"http://a"}}, nil, `url "http://a" scheme must be one of`},
+	}
+	for _, tt := range tests {
+		urls, err := ServerURLs(tt.config)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.name, err)
+			continue
+		}
+		got := make([]string, 0, len(urls))
+		for _, u := range urls {
+			got = append(got, u.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		minDelay time.Duration
+		maxDelay time.Duration
+		wantMin  time.Duration // 每次重连的实际间隔范围
+		wantMax  time.Duration
+		wantErr  string
+	}{
+		{"default constant", 0, 0, defaultReconnectDelay, defaultReconnectDelay, ""},
+		{"constant", 2 * time.Second, 0, 2 * time.Second, 2 * time.Second, ""},
+		{"max equals min", 2 * time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second, ""},
+		{"exponential", time.Second, 8 * time.Second, time.Second, 8 * time.Second, ""},
+		{"exponential from default min", 0, time.Minute, defaultReconnectDelay, time.Minute, ""},
+		{"max less than min", 5 * time.Second, 2 * time.Second, 0, 0, "reconnect_max_delay 2s is less than reconnect_min_delay 5s"},
+		{"max less than default min", 0, 2 * time.Second, 0, 0, "reconnect_max_delay 2s is less than reconnect_min_delay 10s"},
+	}
+	for _, tt := range tests {
+		backoff, err := reconnectBackoff(&entity.MQTTConfig{ReconnectMinDelay: tt.minDelay, ReconnectMaxDelay: tt.maxDelay})
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.name, err)
+			continue
+		}
+		// 第一次连接不等待
+		if delay := backoff(0); delay != 0 {
+			t.Errorf("%v: attempt 0 got %v, want 0", tt.name, delay)
+		}
+		for attempt := 1; attempt <= 10; attempt++ {
+			if delay := backoff(attempt); delay < tt.wantMin || delay > tt.wantMax {
+				t.Errorf("%v: attempt %v got %v, want between %v and %v", tt.name, attempt, delay, tt.wantMin, tt.wantMax)
+			}
+		}
+	}
+}
+
+func TestPublishOptions(t *testing.T) {
+	one, two := byte(1), byte(2)
+	yes, no := true, false
+	tests := []struct {
+		name       string
+		config     *entity.MQTTPublishConfig
+		wantQoS    byte
+		wantRetain bool
+	}{
+		{"nil", nil, 0, true},
+		{"empty", &entity.MQTTPublishConfig{}, 0, true},
+		{"qos only", &entity.MQTTPublishConfig{QoS: &one}, 1, true},
+		{"retain only", &entity.MQTTPublishConfig{Retain: &no}, 0, false},
+		{"both", &entity.MQTTPublishConfig{QoS: &two, Retain: &yes}, 2, true},
+	}
+	for _, tt := range tests {
+		if qos, retain := PublishOptions(tt.config, 0, true); qos != tt.wantQoS || retain != tt.wantRetain {
+			t.Errorf("%v: got %v %v, want %v %v", tt.name, qos, retain, tt.wantQoS, tt.wantRetain)
+		}
+	}
+
+	if qos := SubscribeQoS(&entity.MQTTConfig{}); qos != defaultSubscribeQoS {
+		t.Errorf("default subscribe qos got %v, want %v", qos, defaultSubscribeQoS)
+	}
+	if qos := SubscribeQoS(&entity.MQTTConfig{SubscribeQoS: &two}); qos != 2 {
+		t.Errorf("subscribe qos got %v, want 2", qos)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	two, three := byte(2), byte(3)
+	negative := -time.Second
+	valid := func(modify func(*entity.MQTTConfig)) *entity.MQTTConfig {
+		config := &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883"}
+		modify(config)
+		return config
+	}
+	tests := []struct {
+		name    string
+		config  *entity.MQTTConfig
+		wantErr string
+	}{
+		{"valid", valid(func(*entity.MQTTConfig) {}), ""},
+		{"qos 2", valid(func(config *entity.MQTTConfig) {
+			config.SubscribeQoS = &two
+			config.StatePublish = &entity.MQTTPublishConfig{QoS: &two}
+		}), ""},
+		{"subscribe qos", valid(func(config *entity.MQTTConfig) { config.SubscribeQoS = &three }), "subscribe_qos 3 must be 0, 1 or 2"},
+		{"state qos", valid(func(config *entity.MQTTConfig) { config.StatePublish = &entity.MQTTPublishConfig{QoS: &three} }),
+			"state_publish.qos 3 must be 0, 1 or 2"},
+		{"discovery qos", valid(func(config *entity.MQTTConfig) { config.DiscoveryPublish = &entity.MQTTPublishConfig{QoS: &three} }),
+			"discovery_publish.qos 3 must be 0, 1 or 2"},
+		{"command qos", valid(func(config *entity.MQTTConfig) { config.CommandPublish = &entity.MQTTPublishConfig{QoS: &three} }),
+			"command_publish.qos 3 must be 0, 1 or 2"},
+		{"negative session expiry", valid(func(config *entity.MQTTConfig) { config.SessionExpiry = &negative }),
+			"session_expiry must not be negative"},
+		{"missing url", &entity.MQTTConfig{}, "url or urls is required"},
+		{"invalid backoff", valid(func(config *entity.MQTTConfig) { config.ReconnectMaxDelay = time.Second }),
+			"reconnect_max_delay 1s is less than reconnect_min_delay 10s"},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.config)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigureDefaults(t *testing.T) {
+	clientConfig := &autopaho.ClientConfig{}
+	if err := Configure(clientConfig, &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", Keepalive: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if clientConfig.ConnectTimeout != defaultConnectTimeout || clientConfig.SessionExpiryInterval != 60 ||
+		clientConfig.KeepAlive != 30 || len(clientConfig.ServerUrls) != 1 || clientConfig.TlsCfg != nil {
+		t.Errorf("unexpected defaults %+v", clientConfig)
+	}
+
+	zero := time.Duration(0)
+	clientConfig = &autopaho.ClientConfig{}
+	if err := Configure(clientConfig, &entity.MQTTConfig{URL: "mqtt://127.0.0.1:1883", SessionExpiry: &zero, ConnectTimeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if clientConfig.ConnectTimeout != time.Second || clientConfig.SessionExpiryInterval != 0 {
+		t.Errorf("unexpected config %+v", clientConfig)
+	}
+}
@@ -0,0 +1,165 @@
+package outletgroup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+var (
+	lock    sync.Mutex
+	baseCtx context.Context
+	groups  map[string]*outletGroup
+	order   []string
+
+	groupNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+	// sendCommand 序列中每一步的下发入口，测试时替换
+	sendCommand = collector.SendCommand
+)
+
+type outletGroup struct {
+	config *entity.OutletGroupConfig
+	cancel context.CancelFunc // 正在执行的开关序列，新的命令会打断它
+}
+
+func Init(ctx context.Context, configs []*entity.OutletGroupConfig) error {
+	groups = make(map[string]*outletGroup, len(configs))
+	order = make([]string, 0, len(configs))
+	for i, config := range configs {
+		if err := ValidateConfig(config); err != nil {
+			return fmt.Errorf("outletgroup: outlet_groups[%v].%v", i, err)
+		}
+		if groups[config.Name] != nil {
+			return fmt.Errorf("outletgroup: outlet_groups[%v].name %q is duplicated", i, config.Name)
+		}
+		if config.DisplayName == "" {
+			config.DisplayName = config.Name
+		}
+		groups[config.Name] = &outletGroup{config: config}
+		order = append(order, config.Name)
+	}
+	baseCtx = ctx
+	return nil
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于单个插座组配置，名称是否重复由调用方检查
+func ValidateConfig(config *entity.OutletGroupConfig) error {
+	if !groupNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("name %q must match %v", config.Name, groupNamePattern)
+	}
+	if len(config.Members) == 0 {
+		return fmt.Errorf("members is empty")
+	}
+	for i, member := range config.Members {
+		if member == nil || member.NodeID == "" || len(member.Outlets) == 0 {
+			return fmt.Errorf("members[%v] needs node_id and outlets", i)
+		}
+	}
+	return nil
+}
+
+func GetGroups(ctx context.Context) []*entity.OutletGroup {
+	lock.Lock()
+	defer lock.Unlock()
+	result := make([]*entity.OutletGroup, 0, len(order))
+	for _, name := range order {
+		group := groups[name]
+		result = append(result, &entity.OutletGroup{
+			Name:        group.config.Name,
+			DisplayName: group.config.DisplayName,
+			On:          allOn(ctx, group.config),
+			Running:     group.cancel != nil,
+			Members:     group.config.Members,
+		})
+	}
+	return result
+}
+
+// SendCommand 异步执行插座组的开关序列，ON按成员顺序执行，OFF按逆序执行
+func SendCommand(_ context.Context, name string, command string) error {
+	if command != "ON" && command != "OFF" {
+		return fmt.Errorf("outletgroup: unknown command %q", command)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	group, ok := groups[name]
+	if !ok {
+		return fmt.Errorf("outletgroup: group %q not found", name)
+	}
+	if group.cancel != nil {
+		slog.Info("OutletGroup: interrupting running sequence", "group", name)
+		group.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(baseCtx)
+	group.cancel = cancel
+	go func() {
+		runSequence(ctx, group.config, command)
+		lock.Lock()
+		defer lock.Unlock()
+		if ctx.Err() == nil {
+			group.cancel = nil
+		}
+		cancel()
+	}()
+	return nil
+}
+
+func runSequence(ctx context.Context, config *entity.OutletGroupConfig, command string) {
+	members := slices.Clone(config.Members)
+	if command == "OFF" {
+		slices.Reverse(members)
+	}
+	slog.Info("OutletGroup: sequence started", "group", config.Name, "command", command)
+
+	for i, member := range members {
+		for _, deviceId := range member.Outlets {
+			if err := sendCommand(ctx, &entity.Command{
+				NodeID:   member.NodeID,
+				DeviceID: deviceId,
+				Type:     "switch",
+				Command:  command,
+			}); err != nil {
+				// 后续步骤依赖前面的设备，某一步失败时不再继续
+				slog.Error("OutletGroup: sequence aborted", "group", config.Name, "command", command,
+					"step", i+1, "nodeId", member.NodeID, "deviceId", deviceId, "err", err)
+				return
+			}
+		}
+		if i == len(members)-1 {
+			break
+		}
+
+		delay := config.StepDelay
+		if member.Delay > 0 {
+			delay = member.Delay
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("OutletGroup: sequence interrupted", "group", config.Name, "command", command, "step", i+1)
+			return
+		case <-time.After(delay):
+		}
+	}
+	slog.Info("OutletGroup: sequence finished", "group", config.Name, "command", command)
+}
+
+func allOn(ctx context.Context, config *entity.OutletGroupConfig) bool {
+	for _, member := range config.Members {
+		for _, deviceId := range member.Outlets {
+			if device := database.GetPDUDevice(ctx, member.NodeID, deviceId); device == nil || !device.On {
+				return false
+			}
+		}
+	}
+	return true
+}
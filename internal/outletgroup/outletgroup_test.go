@@ -0,0 +1,147 @@
+package outletgroup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+// commandRecorder 替换sendCommand，按顺序记录每一步，failOn中的插座返回错误
+type commandRecorder struct {
+	lock     sync.Mutex
+	commands []string
+	times    []time.Time
+	failOn   string
+	sent     chan struct{}
+}
+
+func newCommandRecorder(t *testing.T, failOn string) *commandRecorder {
+	recorder := &commandRecorder{failOn: failOn, sent: make(chan struct{}, 100)}
+	original := sendCommand
+	sendCommand = func(_ context.Context, command *entity.Command) error {
+		recorder.lock.Lock()
+		defer recorder.lock.Unlock()
+		recorder.commands = append(recorder.commands, command.NodeID+"/"+command.DeviceID+" "+command.Command)
+		recorder.times = append(recorder.times, time.Now())
+		recorder.sent <- struct{}{}
+		if command.NodeID+"/"+command.DeviceID == recorder.failOn {
+			return errors.New("device offline")
+		}
+		return nil
+	}
+	t.Cleanup(func() { sendCommand = original })
+	return recorder
+}
+
+func (recorder *commandRecorder) get() ([]string, []time.Time) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]string{}, recorder.commands...), append([]time.Time{}, recorder.times...)
+}
+
+func initGroups(t *testing.T, configs ...*entity.OutletGroupConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := Init(ctx, configs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitIdle(t *testing.T, name string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		running := groups[name].cancel != nil
+		lock.Unlock()
+		if !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("group %v still running", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSendCommandOrder(t *testing.T) {
+	rack := &entity.OutletGroupConfig{Name: "rack", StepDelay: 10 * time.Millisecond, Members: []*entity.OutletGroupMember{
+		{NodeID: "a", Outlets: []string{"1", "2"}, Delay: 100 * time.Millisecond},
+		{NodeID: "b", Outlets: []string{"1"}},
+		{NodeID: "a", Outlets: []string{"3"}},
+	}}
+	tests := []struct {
+		command   string
+		failOn    string
+		want      []string
+		wantDelay map[int]time.Duration // 第i条命令与前一条之间至少间隔
+	}{
+		{"ON", "", []string{"a/1 ON", "a/2 ON", "b/1 ON", "a/3 ON"},
+			map[int]time.Duration{2: 100 * time.Millisecond, 3: 10 * time.Millisecond}},
+		{"OFF", "", []string{"a/3 OFF", "b/1 OFF", "a/1 OFF", "a/2 OFF"},
+			map[int]time.Duration{1: 10 * time.Millisecond, 2: 10 * time.Millisecond}},
+		{"ON", "a/2", []string{"a/1 ON", "a/2 ON"}, nil},
+		{"OFF", "b/1", []string{"a/3 OFF", "b/1 OFF"}, nil},
+	}
+	for _, tt := range tests {
+		recorder := newCommandRecorder(t, tt.failOn)
+		initGroups(t, rack)
+		if err := SendCommand(context.Background(), "rack", tt.command); err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(t, "rack")
+		commands, times := recorder.get()
+		if !reflect.DeepEqual(commands, tt.want) {
+			t.Errorf("%v fail on %q: got %v, want %v", tt.command, tt.failOn, commands, tt.want)
+			continue
+		}
+		for i, delay := range tt.wantDelay {
+			if gap := times[i].Sub(times[i-1]); gap < delay {
+				t.Errorf("%v: step %v started %v after the previous one, want at least %v", tt.command, i, gap, delay)
+			}
+		}
+	}
+}
+
+func TestSendCommandInterrupted(t *testing.T) {
+	recorder := newCommandRecorder(t, "")
+	initGroups(t, &entity.OutletGroupConfig{Name: "rack", Members: []*entity.OutletGroupMember{
+		{NodeID: "a", Outlets: []string{"1"}, Delay: time.Hour},
+		{NodeID: "b", Outlets: []string{"1"}},
+	}})
+	if err := SendCommand(context.Background(), "rack", "ON"); err != nil {
+		t.Fatal(err)
+	}
+	<-recorder.sent
+	// 第一步之后在等待，新的命令打断它，ON序列的后续步骤不再执行
+	if err := SendCommand(context.Background(), "rack", "OFF"); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, "rack")
+	time.Sleep(20 * time.Millisecond)
+	commands, _ := recorder.get()
+	if want := []string{"a/1 ON", "b/1 OFF", "a/1 OFF"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("got %v, want %v", commands, want)
+	}
+}
+
+func TestSendCommandErrors(t *testing.T) {
+	initGroups(t, &entity.OutletGroupConfig{Name: "rack", Members: []*entity.OutletGroupMember{{NodeID: "a", Outlets: []string{"1"}}}})
+	tests := []struct {
+		name    string
+		command string
+		wantErr string
+	}{
+		{"rack", "TOGGLE", `outletgroup: unknown command "TOGGLE"`},
+		{"other", "ON", `outletgroup: group "other" not found`},
+	}
+	for _, tt := range tests {
+		if err := SendCommand(context.Background(), tt.name, tt.command); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v %v: got error %v, want %v", tt.name, tt.command, err, tt.wantErr)
+		}
+	}
+}
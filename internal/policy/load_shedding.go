@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+const (
+	defaultSheddingDuration = 10 * time.Second // 单次超限读数不切负载，避免电流尖峰误动作
+	defaultSheddingCooldown = 30 * time.Second // 等上一次关闭在遥测中生效后再决定是否继续切
+)
+
+var (
+	sheddingLock  sync.Mutex
+	sheddingRules []*loadSheddingRule
+	auditLock     sync.Mutex
+)
+
+type loadSheddingRule struct {
+	config     *entity.LoadSheddingConfig
+	duration   time.Duration
+	cooldown   time.Duration
+	overSince  time.Time // 本轮超限的开始时间，零值表示未超限
+	lastAction time.Time
+	shed       map[string]bool // 本轮已经关闭的插座，dry_run时插座实际不会关闭，需要靠它跳过
+}
+
+func InitLoadShedding(ctx context.Context, configs []*entity.LoadSheddingConfig) error {
+	sheddingRules = make([]*loadSheddingRule, 0, len(configs))
+	for i, config := range configs {
+		if err := ValidateLoadShedding(config); err != nil {
+			return fmt.Errorf("policy: load_shedding[%v].%v", i, err)
+		}
+		rule := &loadSheddingRule{
+			config:   config,
+			duration: config.Duration,
+			cooldown: config.Cooldown,
+			shed:     make(map[string]bool),
+		}
+		if rule.duration == 0 {
+			rule.duration = defaultSheddingDuration
+		}
+		if rule.cooldown == 0 {
+			rule.cooldown = defaultSheddingCooldown
+		}
+		sheddingRules = append(sheddingRules, rule)
+	}
+	if len(sheddingRules) == 0 {
+		return nil
+	}
+
+	events := event.Subscribe("load_shedding", 256)
+	go func() {
+		defer event.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				if e.Type == entity.EventTypeGroupUpdated && e.Group != nil {
+					evaluateLoadShedding(ctx, e.Group)
+				}
+			}
+		}
+	}()
+	slog.Info("Policy: load shedding initialized", "rules", len(sheddingRules))
+	return nil
+}
+
+// ValidateLoadShedding 用于检查配置，错误信息中的字段路径相对于单条切负载配置
+func ValidateLoadShedding(config *entity.LoadSheddingConfig) error {
+	switch {
+	case config.Name == "":
+		return fmt.Errorf("name is required")
+	case config.NodeID == "":
+		return fmt.Errorf("node_id is required")
+	case config.GroupID == "":
+		return fmt.Errorf("group_id is required")
+	case config.Limit <= 0:
+		return fmt.Errorf("limit must be positive")
+	case len(config.Outlets) == 0:
+		return fmt.Errorf("outlets is required")
+	case config.Duration < 0:
+		return fmt.Errorf("duration must not be negative")
+	case config.Cooldown < 0:
+		return fmt.Errorf("cooldown must not be negative")
+	}
+	return nil
+}
+
+func evaluateLoadShedding(ctx context.Context, group *entity.PDUGroup) {
+	now := time.Now()
+	sheddingLock.Lock()
+	defer sheddingLock.Unlock()
+
+	for _, rule := range sheddingRules {
+		if rule.config.NodeID != group.NodeID || rule.config.GroupID != group.ID {
+			continue
+		}
+		if group.TotalCurrent == nil {
+			// 没有读数时既不切负载也不认为已恢复
+			continue
+		}
+		totalCurrent := *group.TotalCurrent
+		if totalCurrent <= rule.config.Limit {
+			if !rule.overSince.IsZero() {
+				slog.Info("Policy: load back under limit", "policy", rule.config.Name,
+					"current", totalCurrent, "limit", rule.config.Limit)
+			}
+			rule.overSince = time.Time{}
+			clear(rule.shed)
+			continue
+		}
+
+		if rule.overSince.IsZero() {
+			rule.overSince = now
+		}
+		if now.Sub(rule.overSince) < rule.duration || now.Sub(rule.lastAction) < rule.cooldown {
+			continue
+		}
+
+		deviceId := nextOutletToShed(ctx, rule)
+		if deviceId == "" {
+			slog.Warn("Policy: load over limit but no outlet left to shed", "policy", rule.config.Name,
+				"current", totalCurrent, "limit", rule.config.Limit)
+			continue
+		}
+		rule.lastAction = now
+		rule.shed[deviceId] = true
+
+		record := &entity.AuditRecord{
+			Policy:   rule.config.Name,
+			NodeID:   group.NodeID,
+			GroupID:  group.ID,
+			DeviceID: deviceId,
+			Command:  "OFF",
+			DryRun:   rule.config.DryRun,
+			Reason: fmt.Sprintf("total current %vA over limit %vA for %v",
+				totalCurrent, rule.config.Limit, now.Sub(rule.overSince).Truncate(time.Second)),
+			Timestamp: now,
+		}
+		if !rule.config.DryRun {
+			if err := collector.SendCommand(ctx, &entity.Command{
+				NodeID:   group.NodeID,
+				DeviceID: deviceId,
+				Type:     "switch",
+				Command:  "OFF",
+			}); err != nil {
+				record.Error = err.Error()
+			}
+		}
+		writeAudit(rule.config.AuditFile, record)
+		event.Publish(ctx, &entity.Event{
+			Type:     entity.EventTypeLoadShed,
+			NodeID:   group.NodeID,
+			DeviceID: deviceId,
+			Group:    group,
+			Audit:    record,
+		})
+	}
+}
+
+// nextOutletToShed 按配置顺序返回第一个仍处于打开状态且本轮未处理过的插座
+func nextOutletToShed(ctx context.Context, rule *loadSheddingRule) string {
+	for _, deviceId := range rule.config.Outlets {
+		if rule.shed[deviceId] {
+			continue
+		}
+		if device := database.GetPDUDevice(ctx, rule.config.NodeID, deviceId); device != nil && device.On {
+			return deviceId
+		}
+	}
+	return ""
+}
+
+func writeAudit(file string, record *entity.AuditRecord) {
+	slog.Warn("Policy: automatic action", "policy", record.Policy, "nodeId", record.NodeID,
+		"deviceId", record.DeviceID, "command", record.Command, "dryRun", record.DryRun, "reason", record.Reason)
+	if file == "" {
+		return
+	}
+
+	lineBytes, _ := json.Marshal(record)
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Policy: open audit file failed", "file", file, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(lineBytes, '\n')); err != nil {
+		slog.Error("Policy: write audit file failed", "file", file, "err", err)
+	}
+}
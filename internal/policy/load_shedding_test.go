@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+func TestInitLoadSheddingDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := &entity.LoadSheddingConfig{Name: "rack", NodeID: "node", GroupID: "1", Limit: 10, Outlets: []string{"1"}}
+	if err := InitLoadShedding(ctx, []*entity.LoadSheddingConfig{config}); err != nil {
+		t.Fatal(err)
+	}
+	rule := sheddingRules[0]
+	if rule.duration != defaultSheddingDuration || rule.cooldown != defaultSheddingCooldown {
+		t.Errorf("got duration %v, cooldown %v, want defaults", rule.duration, rule.cooldown)
+	}
+	if config.Duration != 0 || config.Cooldown != 0 {
+		t.Error("defaults should not be written back to the config")
+	}
+
+	config.Cooldown = -time.Second
+	if err := InitLoadShedding(ctx, []*entity.LoadSheddingConfig{config}); err == nil {
+		t.Error("negative cooldown should be rejected")
+	}
+}
+
+func TestEvaluateLoadShedding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	for _, deviceId := range []string{"1", "2", "3"} {
+		database.SetPUDDevice(ctx, "node", deviceId, &entity.PDUDevice{NodeID: "node", ID: deviceId, GroupID: "1", On: true})
+	}
+	config := &entity.LoadSheddingConfig{
+		Name: "rack", NodeID: "node", GroupID: "1", Limit: 10, Outlets: []string{"3", "2"}, DryRun: true,
+	}
+	if err := InitLoadShedding(ctx, []*entity.LoadSheddingConfig{config}); err != nil {
+		t.Fatal(err)
+	}
+	rule := sheddingRules[0]
+	over := float32(12)
+	under := float32(8)
+	group := func(current *float32) *entity.PDUGroup {
+		return &entity.PDUGroup{NodeID: "node", ID: "1", TotalCurrent: current}
+	}
+
+	// 第一条超限读数只开始计时
+	evaluateLoadShedding(ctx, group(&over))
+	if len(rule.shed) != 0 {
+		t.Fatalf("single reading over limit should not shed, got %v", rule.shed)
+	}
+
+	// 超限持续时间达到后切掉优先级最高的插座
+	rule.overSince = time.Now().Add(-defaultSheddingDuration)
+	evaluateLoadShedding(ctx, group(&over))
+	if !rule.shed["3"] || len(rule.shed) != 1 {
+		t.Fatalf("should shed outlet 3 first, got %v", rule.shed)
+	}
+
+	// 冷却时间内不继续切
+	evaluateLoadShedding(ctx, group(&over))
+	if len(rule.shed) != 1 {
+		t.Fatalf("should wait for cooldown, got %v", rule.shed)
+	}
+	rule.lastAction = time.Now().Add(-defaultSheddingCooldown)
+	evaluateLoadShedding(ctx, group(&over))
+	if !rule.shed["2"] {
+		t.Fatalf("should shed outlet 2 after cooldown, got %v", rule.shed)
+	}
+
+	// 没有读数时保持状态，回到限值内后重新开始
+	evaluateLoadShedding(ctx, group(nil))
+	if rule.overSince.IsZero() {
+		t.Fatal("missing reading should not reset the rule")
+	}
+	evaluateLoadShedding(ctx, group(&under))
+	if !rule.overSince.IsZero() || len(rule.shed) != 0 {
+		t.Fatalf("rule should reset under limit, overSince %v, shed %v", rule.overSince, rule.shed)
+	}
+}
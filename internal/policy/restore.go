@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+const (
+	RestoreLast      = "restore_last"
+	RestoreAlwaysOn  = "always_on"
+	RestoreAlwaysOff = "always_off"
+	RestoreLeaveAsIs = "leave_as_is"
+)
+
+var (
+	reconcilingLock sync.Mutex
+	reconciling     = make(map[string]bool)
+
+	// sendCommand 恢复策略下发命令的入口，测试时替换
+	sendCommand = collector.SendCommand
+)
+
+func InitRestore(ctx context.Context, config *entity.RestoreConfig) error {
+	if config == nil {
+		return nil
+	}
+	if err := ValidateRestore(config); err != nil {
+		return fmt.Errorf("policy: restore.%v", err)
+	}
+	if config.Policy == "" {
+		config.Policy = RestoreLeaveAsIs
+	}
+	if config.Settle <= 0 {
+		config.Settle = 10 * time.Second
+	}
+	if config.Stagger <= 0 {
+		config.Stagger = time.Second
+	}
+	if config.StateFile != "" {
+		if err := database.LoadDesiredStates(ctx, config.StateFile); err != nil {
+			return fmt.Errorf("policy: load restore state file %v failed, %v", config.StateFile, err)
+		}
+	}
+
+	events := event.Subscribe("restore", 64)
+	go func() {
+		defer event.Unsubscribe(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				if e.Type == entity.EventTypeNodeOnline || e.Type == entity.EventTypeNodeResumed {
+					go reconcileNode(ctx, config, e.NodeID)
+				}
+			}
+		}
+	}()
+	slog.Info("Policy: restore initialized", "policy", config.Policy)
+	return nil
+}
+
+// ValidateRestore 用于检查配置，错误信息中的字段路径相对于restore配置
+func ValidateRestore(config *entity.RestoreConfig) error {
+	if config.Policy != "" && !validRestorePolicy(config.Policy) {
+		return fmt.Errorf("policy %q is invalid", config.Policy)
+	}
+	nodeIds := make([]string, 0, len(config.Nodes))
+	for nodeId := range config.Nodes {
+		nodeIds = append(nodeIds, nodeId)
+	}
+	sort.Strings(nodeIds)
+	for _, nodeId := range nodeIds {
+		if nodePolicy := config.Nodes[nodeId]; !validRestorePolicy(nodePolicy) {
+			return fmt.Errorf("nodes.%v %q is invalid", nodeId, nodePolicy)
+		}
+	}
+	return nil
+}
+
+func validRestorePolicy(policy string) bool {
+	switch policy {
+	case RestoreLast, RestoreAlwaysOn, RestoreAlwaysOff, RestoreLeaveAsIs:
+		return true
+	default:
+		return false
+	}
+}
+
+// reconcileNode 节点上线或重启后比对插座的实际状态与期望状态，逐个下发命令，同一节点同时只有一轮比对
+func reconcileNode(ctx context.Context, config *entity.RestoreConfig, nodeId string) {
+	policy := config.Policy
+	if nodePolicy, ok := config.Nodes[nodeId]; ok {
+		policy = nodePolicy
+	}
+	if policy == RestoreLeaveAsIs {
+		return
+	}
+	reconcilingLock.Lock()
+	if reconciling[nodeId] {
+		reconcilingLock.Unlock()
+		return
+	}
+	reconciling[nodeId] = true
+	reconcilingLock.Unlock()
+	defer func() {
+		reconcilingLock.Lock()
+		delete(reconciling, nodeId)
+		reconcilingLock.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(config.Settle):
+	}
+
+	devices := make([]*entity.PDUDevice, 0)
+	for _, cell := range database.GetPDUNodeDevices(ctx, nodeId) {
+		if cell.PduDevice != nil {
+			devices = append(devices, cell.PduDevice)
+		}
+	}
+	sortDevicesById(devices)
+	first := true
+	for _, device := range devices {
+		var desired bool
+		switch policy {
+		case RestoreAlwaysOn:
+			desired = true
+		case RestoreAlwaysOff:
+			desired = false
+		case RestoreLast:
+			var ok bool
+			if desired, ok = database.GetDesiredState(ctx, nodeId, device.ID); !ok {
+				continue
+			}
+		}
+		if device.On == desired {
+			continue
+		}
+
+		if !first {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(config.Stagger):
+			}
+		}
+		first = false
+
+		command := "OFF"
+		if desired {
+			command = "ON"
+		}
+		record := &entity.AuditRecord{
+			Policy:    "restore",
+			NodeID:    nodeId,
+			DeviceID:  device.ID,
+			Command:   command,
+			Reason:    fmt.Sprintf("outlet state differs from %v policy after node came online or restarted", policy),
+			Timestamp: time.Now(),
+		}
+		if err := sendCommand(ctx, &entity.Command{
+			NodeID:   nodeId,
+			DeviceID: device.ID,
+			Type:     "switch",
+			Command:  command,
+		}); err != nil {
+			record.Error = err.Error()
+		}
+		writeAudit("", record)
+	}
+}
+
+// sortDevicesById 全局ID是数字，按数值排序，1,2,...,10而不是1,10,2，非数字的ID按字符串排在所有数字之后
+func sortDevicesById(devices []*entity.PDUDevice) {
+	sort.SliceStable(devices, func(i, k int) bool {
+		left, leftErr := strconv.Atoi(devices[i].ID)
+		right, rightErr := strconv.Atoi(devices[k].ID)
+		switch {
+		case leftErr == nil && rightErr == nil && left != right:
+			return left < right
+		case (leftErr == nil) != (rightErr == nil):
+			return leftErr == nil
+		default:
+			return devices[i].ID < devices[k].ID
+		}
+	})
+}
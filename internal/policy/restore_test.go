@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+func TestSortDevicesById(t *testing.T) {
+	tests := []struct {
+		ids  []string
+		want []string
+	}{
+		{[]string{"10", "2", "1", "11"}, []string{"1", "2", "10", "11"}},
+		{[]string{"16", "9", "8"}, []string{"8", "9", "16"}},
+		{[]string{"b", "2", "a"}, []string{"2", "a", "b"}},
+		// 数字ID都排在非数字ID之前，比较必须是传递的
+		{[]string{"1a", "10", "2"}, []string{"2", "10", "1a"}},
+		{[]string{"2", "1a", "10", "ac_1", "1"}, []string{"1", "2", "10", "1a", "ac_1"}},
+	}
+	for _, tt := range tests {
+		devices := make([]*entity.PDUDevice, 0, len(tt.ids))
+		for _, id := range tt.ids {
+			devices = append(devices, &entity.PDUDevice{ID: id})
+		}
+		sortDevicesById(devices)
+		got := make([]string, 0, len(devices))
+		for _, device := range devices {
+			got = append(got, device.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortDevicesById(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
+
+// recordCommands 替换sendCommand，返回读取已下发命令的函数
+func recordCommands(t *testing.T) func() []string {
+	var lock sync.Mutex
+	commands := make([]string, 0)
+	original := sendCommand
+	sendCommand = func(_ context.Context, command *entity.Command) error {
+		lock.Lock()
+		defer lock.Unlock()
+		commands = append(commands, command.DeviceID+" "+command.Command)
+		return nil
+	}
+	t.Cleanup(func() { sendCommand = original })
+	return func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return slices.Clone(commands)
+	}
+}
+
+func TestRestoreOnNodeOnline(t *testing.T) {
+	outlets := map[string]bool{"1": false, "2": true, "10": false, "x": false}
+	tests := []struct {
+		name    string
+		policy  string
+		nodes   map[string]string
+		desired map[string]bool // restore_last使用的期望状态
+		want    []string
+	}{
+		{"always on", RestoreAlwaysOn, nil, nil, []string{"1 ON", "10 ON", "x ON"}},
+		{"always off", RestoreAlwaysOff, nil, nil, []string{"2 OFF"}},
+		{"restore last", RestoreLast, nil, map[string]bool{"1": true, "2": false, "10": false}, []string{"1 ON", "2 OFF"}},
+		{"leave as is", RestoreLeaveAsIs, nil, nil, []string{}},
+		{"node override", RestoreAlwaysOn, map[string]string{"node": RestoreLeaveAsIs}, nil, []string{}},
+		{"other node override", RestoreAlwaysOff, map[string]string{"other": RestoreAlwaysOn}, nil, []string{"2 OFF"}},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		database.Init(ctx)
+		commands := recordCommands(t)
+		for id, desired := range tt.desired {
+			database.SetDesiredState(ctx, "node", id, desired)
+		}
+		config := &entity.RestoreConfig{Policy: tt.policy, Nodes: tt.nodes, Settle: 50 * time.Millisecond, Stagger: time.Millisecond}
+		if err := InitRestore(ctx, config); err != nil {
+			t.Fatal(err)
+		}
+		// 节点的第一条上报产生上线事件，等待settle之后再比对全部插座
+		for id, on := range outlets {
+			database.SetPUDDevice(ctx, "node", id, &entity.PDUDevice{NodeID: "node", ID: id, On: on})
+		}
+		time.Sleep(300 * time.Millisecond)
+		if got := commands(); !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+		cancel()
+	}
+}
+
+func TestRestoreEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	commands := recordCommands(t)
+	config := &entity.RestoreConfig{Policy: RestoreAlwaysOn, Settle: 50 * time.Millisecond, Stagger: time.Millisecond}
+	if err := InitRestore(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	database.SetPUDDevice(ctx, "node", "1", &entity.PDUDevice{NodeID: "node", ID: "1"})
+	time.Sleep(200 * time.Millisecond)
+
+	tests := []struct {
+		eventType entity.EventType
+		want      int // 累计下发的命令数，命令由测试替换不会改变插座状态
+	}{
+		{entity.EventTypeDeviceUpdated, 1},
+		{entity.EventTypeOutletSwitched, 1},
+		{entity.EventTypeNodeOffline, 1},
+		{entity.EventTypeNodeResumed, 2},
+		{entity.EventTypeNodeOnline, 3},
+	}
+	for _, tt := range tests {
+		event.Publish(ctx, &entity.Event{Type: tt.eventType, NodeID: "node"})
+		time.Sleep(200 * time.Millisecond)
+		if got := commands(); len(got) != tt.want {
+			t.Errorf("after %v: got commands %v, want %v", tt.eventType, got, tt.want)
+		}
+	}
+
+	// 同一节点同时只有一轮比对
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeNodeResumed, NodeID: "node"})
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeNodeOnline, NodeID: "node"})
+	time.Sleep(200 * time.Millisecond)
+	if got := commands(); len(got) != 4 {
+		t.Errorf("concurrent events: got commands %v, want 4", got)
+	}
+}
@@ -3,34 +3,55 @@ package publisher
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity/hass"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/alarm"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
 	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/mqttclient"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/outletgroup"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
 )
 
 const (
 	devicePrefix = "yespeed_pdu_"
+	// outletGroupDevice 跨节点的逻辑插座组统一挂在这个设备下，不能以devicePrefix开头
+	outletGroupDevice = "yespeed_outlet_groups"
 )
 
 type HomeAssistantMQTTPublisher struct {
 	config            *entity.PublisherConfig
 	connectionManager *autopaho.ConnectionManager
+	started           atomic.Bool // 慢启动结束后重连时立即补发发现配置
 }
 
-func (publisher *HomeAssistantMQTTPublisher) Run(ctx context.Context, config *entity.PublisherConfig) error {
+func (publisher *HomeAssistantMQTTPublisher) setup(config *entity.PublisherConfig) error {
+	if config.MQTT == nil {
+		return fmt.Errorf("mqtt is required")
+	}
+	if config.MQTT.Topic == "" {
+		return fmt.Errorf("mqtt.topic is required")
+	}
+	if err := mqttclient.Validate(config.MQTT); err != nil {
+		return fmt.Errorf("mqtt.%v", err)
+	}
 	publisher.config = config
-	u, err := url.Parse(config.MQTT.URL)
-	if err != nil {
-		return fmt.Errorf("Publisher.HASS_MQTT: parse mqtt url failed: %v, %v", config.MQTT.URL, err)
+	return nil
+}
+
+func (publisher *HomeAssistantMQTTPublisher) Run(ctx context.Context, config *entity.PublisherConfig) error {
+	var err error
+	if err = publisher.setup(config); err != nil {
+		return fmt.Errorf("Publisher.HASS_MQTT: %v", err)
 	}
 
 	router := paho.NewStandardRouter()
@@ -40,31 +61,30 @@ func (publisher *HomeAssistantMQTTPublisher) Run(ctx context.Context, config *en
 	router.RegisterHandler("homeassistant/device/+/set", setDeviceStateHandler)
 
 	clientConfig := autopaho.ClientConfig{
-		ServerUrls:      []*url.URL{u},
-		KeepAlive:       config.MQTT.Keepalive,
-		ConnectUsername: config.MQTT.Username,
-		ConnectPassword: []byte(config.MQTT.Password),
-		// CleanStartOnInitialConnection defaults to false. Setting this to true will clear the session on the first connection.
-		CleanStartOnInitialConnection: false,
-		// SessionExpiryInterval - Seconds that a session will survive after disconnection.
-		// It is important to set this because otherwise, any queued messages will be lost if the connection drops and
-		// the server will not queue messages while it is down. The specific setting will depend upon your needs
-		// (60 = 1 minute, 3600 = 1 hour, 86400 = one day, 0xFFFFFFFE = 136 years, 0xFFFFFFFF = don't expire)
-		SessionExpiryInterval: 60,
 		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connAck *paho.Connack) {
 			slog.Info("Publisher.HASS_MQTT: connected to server")
+			status.Set(config.Name, status.StateUp, nil)
 			if _, err = connectionManager.Subscribe(context.Background(), &paho.Subscribe{
 				Subscriptions: []paho.SubscribeOptions{
-					{Topic: config.MQTT.Topic, QoS: 1},
+					{Topic: config.MQTT.Topic, QoS: mqttclient.SubscribeQoS(config.MQTT)},
 				},
 			}); err != nil {
 				slog.Error("Publisher.HASS_MQTT: subscribe failed", "err", err)
 				return
 			}
 			slog.Info("Publisher.HASS_MQTT: subscribed to", "topic", config.MQTT.Topic)
+			if publisher.started.Load() {
+				go publisher.publishConfigTopic(context.Background())
+			}
 		},
 		OnConnectError: func(err error) {
 			slog.Error("Publisher.HASS_MQTT: connect failed", "err", err)
+			status.Set(config.Name, status.StateDown, err)
+		},
+		OnConnectionDown: func() bool {
+			slog.Warn("Publisher.HASS_MQTT: connection down, reconnecting")
+			status.Set(config.Name, status.StateDown, nil)
+			return true
 		},
 		ClientConfig: paho.ClientConfig{
 			ClientID: config.MQTT.ClientID,
@@ -82,35 +102,45 @@ func (publisher *HomeAssistantMQTTPublisher) Run(ctx context.Context, config *en
 				} else {
 					slog.Error("Publisher.HASS_MQTT: server requested disconnect", "reasonCode", d.ReasonCode)
 				}
+				status.Set(config.Name, status.StateDown, fmt.Errorf("server requested disconnect, reason code %v", d.ReasonCode))
 			},
 		},
 	}
+	if err = mqttclient.Configure(&clientConfig, config.MQTT); err != nil {
+		return fmt.Errorf("Publisher.HASS_MQTT: %v", err)
+	}
 
+	// 不等待连接建立，broker暂时不可用时以降级状态启动，由autopaho在后台重连
+	status.Set(config.Name, status.StateConnecting, nil)
 	publisher.connectionManager, err = autopaho.NewConnection(ctx, clientConfig)
 	if err != nil {
 		return fmt.Errorf("Publisher.HASS_MQTT: NewConnection failed, %v", err)
 	}
-	if err = publisher.connectionManager.AwaitConnection(ctx); err != nil {
-		return fmt.Errorf("Publisher.HASS_MQTT: AwaitConnection failed, %v", err)
-	}
-	slog.Info("Publisher.HASS_MQTT: initialized", "server", config.MQTT.URL)
+	slog.Info("Publisher.HASS_MQTT: initialized", "servers", clientConfig.ServerUrls)
 
 	// Slow start, waiting point value is ready
-	select {
-	case <-ctx.Done():
-		return nil
-	case <-time.After(20 * time.Second):
-		go publisher.runConfigTopic(ctx)
-		go publisher.runStateTopic(ctx)
-	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(20 * time.Second):
+			publisher.started.Store(true)
+			go publisher.runConfigTopic(ctx)
+			go publisher.runStateTopic(ctx)
+		}
+	}()
 
 	return nil
 }
 
 func (publisher *HomeAssistantMQTTPublisher) Stop(ctx context.Context) {
+	// 等待连接断开，重新加载时新的实例才能以相同的客户端ID连接
 	if publisher.connectionManager != nil {
-		publisher.connectionManager.Done()
+		if err := publisher.connectionManager.Disconnect(ctx); err != nil {
+			slog.Warn("Publisher.HASS_MQTT: disconnect failed", "err", err)
+		}
 	}
+	status.Remove(publisher.config.Name)
 	slog.Info("Publisher.HASS_MQTT: stopped")
 }
 
@@ -142,6 +172,23 @@ func (publisher *HomeAssistantMQTTPublisher) runStateTopic(ctx context.Context)
 	}
 }
 
+// publish 发现配置和状态默认都以QoS 0保留发布，HA重启后可以直接读到
+func (publisher *HomeAssistantMQTTPublisher) publish(ctx context.Context, config *entity.MQTTPublishConfig, topic string, payload []byte) {
+	publish := &paho.Publish{
+		Topic:   topic,
+		Payload: payload,
+	}
+	publish.QoS, publish.Retain = mqttclient.PublishOptions(config, 0, true)
+	if _, err := publisher.connectionManager.Publish(ctx, publish); err != nil {
+		// 断线期间每轮都会失败，状态已由连接回调报告，避免刷屏
+		if errors.Is(err, autopaho.ConnectionDownError) {
+			slog.Debug("Publisher.HASS_MQTT: publish skipped, connection down", "topic", topic)
+			return
+		}
+		slog.Warn("Publisher.HASS_MQTT: publish failed", "topic", topic, "err", err)
+	}
+}
+
 func (publisher *HomeAssistantMQTTPublisher) publishConfigTopic(ctx context.Context) {
 	for _, nodeId := range database.GetAllPDUNodes(ctx) {
 		payload := hass.MQTTDiscoveryMessage{
@@ -169,20 +216,74 @@ func (publisher *HomeAssistantMQTTPublisher) publishConfigTopic(ctx context.Cont
 			QOS:          0,
 		}
 		for _, device := range database.GetPDUNodeDevices(ctx, nodeId) {
-			for _, component := range buildConfigPayload(device.PduDevice, "normal") {
+			switch device.Type {
+			case entity.DeviceTypePDU:
+				for _, component := range buildConfigPayload(device.PduDevice, "normal") {
+					payload.Components[component.Key] = component
+				}
+			case entity.DeviceTypeAC:
+				component := buildClimateConfigPayload(device.AcDevice, payload.StateTopic)
 				payload.Components[component.Key] = component
 			}
 		}
+		for _, state := range alarm.GetNodeAlarms(ctx, nodeId) {
+			component := buildAlarmConfigPayload(state)
+			payload.Components[component.Key] = component
+		}
 
 		payloadBytes, _ := json.Marshal(payload)
-		_, _ = publisher.connectionManager.Publish(ctx, &paho.Publish{
-			QoS:     0,
-			Retain:  true,
-			Topic:   fmt.Sprintf("homeassistant/device/%v%v/config", devicePrefix, nodeId),
-			Payload: payloadBytes,
-		})
+		publisher.publish(ctx, publisher.config.MQTT.DiscoveryPublish,
+			fmt.Sprintf("homeassistant/device/%v%v/config", devicePrefix, nodeId), payloadBytes)
 		slog.Info("Publisher.HASS_MQTT: published config topic")
 	}
+	publisher.publishOutletGroupConfigTopic(ctx)
+}
+
+func (publisher *HomeAssistantMQTTPublisher) publishOutletGroupConfigTopic(ctx context.Context) {
+	groups := outletgroup.GetGroups(ctx)
+	if len(groups) == 0 {
+		return
+	}
+
+	payload := hass.MQTTDiscoveryMessage{
+		Device: hass.DeviceInfo{
+			Identifiers:  outletGroupDevice,
+			Name:         "PDU 插座组",
+			Manufacturer: "Yespeed",
+		},
+		Origin: hass.OriginInfo{
+			Name: "mqtt",
+		},
+		Components:   make(map[string]hass.Component),
+		CommandTopic: fmt.Sprintf("homeassistant/device/%v/set", outletGroupDevice),
+		StateTopic:   fmt.Sprintf("homeassistant/device/%v/state", outletGroupDevice),
+		QOS:          0,
+	}
+	for _, group := range groups {
+		_switch := hass.Component{
+			Platform: "switch",
+			Key:      fmt.Sprintf("group_%v", group.Name),
+		}
+		_switch.DeviceClass = "outlet"
+		_switch.Name = group.DisplayName
+		_switch.ObjectID = fmt.Sprintf("%v_%v", outletGroupDevice, _switch.Key)
+		_switch.UniqueID = fmt.Sprintf("%v_%v", outletGroupDevice, _switch.Key)
+		_switch.ValueTemplate = fmt.Sprintf("{{ value_json.%v }}", _switch.Key)
+
+		optimistic := true
+		_switch.Optimistic = &optimistic
+
+		_switch.PayloadOn = fmt.Sprintf(`{"%v":"ON"}`, _switch.Key)
+		_switch.PayloadOff = fmt.Sprintf(`{"%v":"OFF"}`, _switch.Key)
+		_switch.StateOn = "ON"
+		_switch.StateOff = "OFF"
+		payload.Components[_switch.Key] = _switch
+	}
+
+	payloadBytes, _ := json.Marshal(payload)
+	publisher.publish(ctx, publisher.config.MQTT.DiscoveryPublish,
+		fmt.Sprintf("homeassistant/device/%v/config", outletGroupDevice), payloadBytes)
+	slog.Info("Publisher.HASS_MQTT: published outlet group config topic")
 }
 
 // buildConfigPayload mode=normal->正常情况 mode=delete->删除
@@ -270,14 +371,62 @@ func buildConfigPayload(device *entity.PDUDevice, mode string) []hass.Component
 	return result
 }
 
+// buildClimateConfigPayload climate组件不使用设备级的state_topic，每个状态需要单独指定主题
+func buildClimateConfigPayload(device *entity.ACDevice, stateTopic string) hass.Component {
+	key := fmt.Sprintf("ac_%v", device.ID)
+	climate := hass.Component{
+		Platform:                   "climate",
+		Key:                        key,
+		Name:                       device.Name,
+		ObjectID:                   fmt.Sprintf("%v%v_%v", devicePrefix, device.NodeID, key),
+		UniqueID:                   fmt.Sprintf("%v%v_%v", devicePrefix, device.NodeID, key),
+		Modes:                      []string{"off", "auto", "cool", "dry", "fan_only", "heat"},
+		FanModes:                   []string{"auto", "low", "medium", "high"},
+		ModeStateTopic:             stateTopic,
+		ModeStateTemplate:          fmt.Sprintf("{{ value_json.%v.mode }}", key),
+		FanModeStateTopic:          stateTopic,
+		FanModeStateTemplate:       fmt.Sprintf("{{ value_json.%v.fan_mode }}", key),
+		TemperatureStateTopic:      stateTopic,
+		TemperatureStateTemplate:   fmt.Sprintf("{{ value_json.%v.setpoint }}", key),
+		CurrentTemperatureTopic:    stateTopic,
+		CurrentTemperatureTemplate: fmt.Sprintf("{{ value_json.%v.temperature }}", key),
+		TemperatureUnit:            "C",
+	}
+	return climate
+}
+
+func buildAlarmConfigPayload(state *entity.AlarmState) hass.Component {
+	alarmComponent := hass.Component{
+		Platform:    "binary_sensor",
+		Key:         state.Key,
+		DeviceClass: "problem",
+		PayloadOn:   "ON",
+		PayloadOff:  "OFF",
+	}
+	scopeName := "插座"
+	if state.Scope == alarm.ScopeGroup {
+		scopeName = "设备组"
+	}
+	alarmComponent.Name = fmt.Sprintf("%v %v %v 告警", scopeName, state.ID, state.Name)
+	alarmComponent.ObjectID = fmt.Sprintf("%v%v_%v", devicePrefix, state.NodeID, alarmComponent.Key)
+	alarmComponent.UniqueID = fmt.Sprintf("%v%v_%v", devicePrefix, state.NodeID, alarmComponent.Key)
+	alarmComponent.ValueTemplate = fmt.Sprintf("{{ value_json.%v }}", state.Key)
+	return alarmComponent
+}
+
 func (publisher *HomeAssistantMQTTPublisher) publishStateTopic(ctx context.Context) {
 	for _, nodeId := range database.GetAllPDUNodes(ctx) {
 		payload := make(map[string]any)
 		for _, device := range database.GetPDUNodeDevices(ctx, nodeId) {
+			if device.Type == entity.DeviceTypeAC {
+				payload[fmt.Sprintf("ac_%v", device.AcDevice.ID)] = device.AcDevice
+				continue
+			}
 			switchState := "OFF"
 			if device.PduDevice.On {
 				switchState = "ON"
 			}
+			// 没有读数的测量值序列化为null，模板渲染为None，HA会将实体显示为unknown而不是0
 			payload[fmt.Sprintf("switch_%v", device.PduDevice.ID)] = map[string]any{
 				"switch":  switchState,
 				"voltage": device.PduDevice.Voltage,
@@ -286,18 +435,42 @@ func (publisher *HomeAssistantMQTTPublisher) publishStateTopic(ctx context.Conte
 				"energy":  device.PduDevice.Energy,
 			}
 		}
+		for _, state := range alarm.GetNodeAlarms(ctx, nodeId) {
+			alarmState := "OFF"
+			if state.Active {
+				alarmState = "ON"
+			}
+			payload[state.Key] = alarmState
+		}
 
 		payloadBytes, _ := json.Marshal(payload)
-		_, _ = publisher.connectionManager.Publish(ctx, &paho.Publish{
-			QoS:     0,
-			Retain:  true,
-			Topic:   fmt.Sprintf("homeassistant/device/%v%v/state", devicePrefix, nodeId),
-			Payload: payloadBytes,
-		})
+		publisher.publish(ctx, publisher.config.MQTT.StatePublish,
+			fmt.Sprintf("homeassistant/device/%v%v/state", devicePrefix, nodeId), payloadBytes)
 	}
+	publisher.publishOutletGroupStateTopic(ctx)
 	slog.Info("Publisher.HASS_MQTT: published state topic")
 }
 
+func (publisher *HomeAssistantMQTTPublisher) publishOutletGroupStateTopic(ctx context.Context) {
+	groups := outletgroup.GetGroups(ctx)
+	if len(groups) == 0 {
+		return
+	}
+
+	payload := make(map[string]any)
+	for _, group := range groups {
+		groupState := "OFF"
+		if group.On {
+			groupState = "ON"
+		}
+		payload[fmt.Sprintf("group_%v", group.Name)] = groupState
+	}
+
+	payloadBytes, _ := json.Marshal(payload)
+	publisher.publish(ctx, publisher.config.MQTT.StatePublish,
+		fmt.Sprintf("homeassistant/device/%v/state", outletGroupDevice), payloadBytes)
+}
+
 func setDeviceStateHandler(publish *paho.Publish) {
 	ctx := context.Background()
 
@@ -308,6 +481,10 @@ func setDeviceStateHandler(publish *paho.Publish) {
 		Command:  "",
 	}
 	topicSeg := strings.Split(publish.Topic, "/")
+	if topicSeg[2] == outletGroupDevice {
+		setOutletGroupStateHandler(ctx, publish)
+		return
+	}
 	if !strings.HasPrefix(topicSeg[2], devicePrefix) {
 		slog.Info("Publisher.HASS_MQTT: received not my topic", "topic", publish.Topic)
 		return
@@ -328,6 +505,26 @@ func setDeviceStateHandler(publish *paho.Publish) {
 		command.DeviceID = keySeg[1]
 		command.Type = keySeg[2]
 		command.Command = state
-		collector.SendCommand(ctx, &command)
+		if err := collector.SendCommand(ctx, &command); err != nil {
+			slog.Warn("Publisher.HASS_MQTT: command failed", "nodeId", command.NodeID, "deviceId", command.DeviceID, "err", err)
+		}
+	}
+}
+
+func setOutletGroupStateHandler(ctx context.Context, publish *paho.Publish) {
+	var payload map[string]string
+	if err := json.Unmarshal(publish.Payload, &payload); err != nil {
+		slog.Info("Publisher.HASS_MQTT: unmarshal payload failed", "err", err)
+		return
+	}
+
+	for key, state := range payload {
+		name, ok := strings.CutPrefix(key, "group_")
+		if !ok {
+			continue
+		}
+		if err := outletgroup.SendCommand(ctx, name, state); err != nil {
+			slog.Warn("Publisher.HASS_MQTT: outlet group command failed", "group", name, "err", err)
+		}
 	}
 }
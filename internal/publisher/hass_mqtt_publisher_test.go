@@ -0,0 +1,19 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestBuildAlarmConfigPayload(t *testing.T) {
+	// 不同节点上同一设备组的同一条告警规则，unique_id不能相同
+	first := buildAlarmConfigPayload(&entity.AlarmState{Key: "alarm_group_1_over_current", Name: "over_current", Scope: "group", NodeID: "a", ID: "1"})
+	second := buildAlarmConfigPayload(&entity.AlarmState{Key: "alarm_group_1_over_current", Name: "over_current", Scope: "group", NodeID: "b", ID: "1"})
+	if first.UniqueID == second.UniqueID {
+		t.Errorf("got same unique_id %v on two nodes", first.UniqueID)
+	}
+	if first.UniqueID != first.ObjectID || first.Name != "设备组 1 over_current 告警" {
+		t.Errorf("got %+v", first)
+	}
+}
@@ -3,12 +3,22 @@ package publisher
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
 )
 
 var (
-	publishers []YespeedPDUPublisher
+	lock       sync.Mutex
+	baseCtx    context.Context
+	publishers []*runningPublisher
+
+	// createPublisher 启动和重新加载时创建发布器的入口，测试时替换
+	createPublisher = newPublisher
 )
 
 type YespeedPDUPublisher interface {
@@ -16,31 +26,158 @@ type YespeedPDUPublisher interface {
 	Stop(ctx context.Context)
 }
 
+// runningPublisher 保留启动时的配置，重新加载时据此判断发布器是否需要重启
+type runningPublisher struct {
+	config    *entity.PublisherConfig
+	publisher YespeedPDUPublisher
+	cancel    context.CancelFunc
+}
+
+// stop 每个实例使用独立的context，停止后取消以结束实例在后台启动的协程
+func (running *runningPublisher) stop(ctx context.Context) {
+	running.publisher.Stop(ctx)
+	running.cancel()
+}
+
 func Init(ctx context.Context, configs []*entity.PublisherConfig) error {
+	baseCtx = ctx
+	return Reload(ctx, configs)
+}
+
+// Reload 按名称对比新旧配置，只停止、启动或重启有变化的发布器
+// 任一发布器启动失败时恢复到调用前的状态，未变化的发布器始终保持运行
+func Reload(ctx context.Context, configs []*entity.PublisherConfig) error {
 	if len(configs) == 0 {
 		return fmt.Errorf("publisher config is empty")
 	}
+	if err := setDefaultNames(configs); err != nil {
+		return err
+	}
 
-	publishers = make([]YespeedPDUPublisher, 0, len(configs))
-	for _, config := range configs {
-		var publisher YespeedPDUPublisher
-		switch config.Type {
-		case "hass_mqtt":
-			publisher = &HomeAssistantMQTTPublisher{}
-		default:
-			return fmt.Errorf("unknown publisher type %v", config.Type)
+	lock.Lock()
+	defer lock.Unlock()
+	previous := make(map[string]*runningPublisher, len(publishers))
+	for _, running := range publishers {
+		previous[running.config.Name] = running
+	}
+	result := make([]*runningPublisher, 0, len(configs))
+	started := make([]*runningPublisher, 0)
+	stopped := make([]*runningPublisher, 0)
+	// rollback 停止本次启动的实例，用原来的配置重新启动被停止的发布器
+	rollback := func() {
+		for _, running := range started {
+			running.stop(ctx)
 		}
+		restored := make([]*runningPublisher, 0, len(publishers))
+		for _, running := range publishers {
+			if !slices.Contains(stopped, running) {
+				restored = append(restored, running)
+				continue
+			}
+			restarted, err := startPublisher(running.config)
+			if err != nil {
+				slog.Error("Publisher: restore publisher failed", "name", running.config.Name, "err", err)
+				continue
+			}
+			restored = append(restored, restarted)
+		}
+		publishers = restored
+	}
+
+	for i, config := range configs {
+		if running, ok := previous[config.Name]; ok {
+			delete(previous, config.Name)
+			if reflect.DeepEqual(running.config, config) {
+				result = append(result, running)
+				continue
+			}
+			// 先停止旧的实例，避免两个实例以相同的客户端ID同时连接
+			slog.Info("Publisher: restarting changed publisher", "name", config.Name)
+			running.stop(ctx)
+			stopped = append(stopped, running)
+		} else if publishers != nil {
+			slog.Info("Publisher: starting added publisher", "name", config.Name)
+		}
+
+		running, err := startPublisher(config)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("publisher: publishers[%v].%v", i, err)
+		}
+		started = append(started, running)
+		result = append(result, running)
+	}
+
+	for name, running := range previous {
+		slog.Info("Publisher: stopping removed publisher", "name", name)
+		running.stop(ctx)
+	}
+	publishers = result
+	return nil
+}
 
-		if err := publisher.Run(ctx, config); err != nil {
-			return fmt.Errorf("publisher: run %v publisher failed, %v", config.Type, err)
+// setDefaultNames 未配置名称的发布器以{type}_{序号}命名
+func setDefaultNames(configs []*entity.PublisherConfig) error {
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("%v_%v", config.Type, i)
 		}
-		publishers = append(publishers, publisher)
+		if names[config.Name] {
+			return fmt.Errorf("publisher: publishers[%v].name %q is duplicated", i, config.Name)
+		}
+		names[config.Name] = true
 	}
 	return nil
 }
 
+// startPublisher Run只校验配置并在后台建立连接，连接状态通过status包报告
+func startPublisher(config *entity.PublisherConfig) (*runningPublisher, error) {
+	publisher, err := createPublisher(config.Type)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(baseCtx)
+	if err = publisher.Run(ctx, config); err != nil {
+		cancel()
+		return nil, fmt.Errorf("run %v publisher failed, %v", config.Name, err)
+	}
+	return &runningPublisher{config: config, publisher: publisher, cancel: cancel}, nil
+}
+
+// Types 支持的发布器类型
+var Types = []string{"hass_mqtt", "webhook"}
+
+func newPublisher(publisherType string) (configurablePublisher, error) {
+	switch publisherType {
+	case "hass_mqtt":
+		return &HomeAssistantMQTTPublisher{}, nil
+	case "webhook":
+		return &WebhookPublisher{}, nil
+	}
+	return nil, fmt.Errorf("type %q must be one of %v", publisherType, strings.Join(Types, ", "))
+}
+
+// configurablePublisher setup只校验配置并初始化内部状态，不建立连接
+type configurablePublisher interface {
+	YespeedPDUPublisher
+	setup(config *entity.PublisherConfig) error
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于发布器配置
+func ValidateConfig(config *entity.PublisherConfig) error {
+	publisher, err := newPublisher(config.Type)
+	if err != nil {
+		return err
+	}
+	return publisher.setup(config)
+}
+
 func Stop(ctx context.Context) {
-	for _, publisher := range publishers {
-		publisher.Stop(ctx)
+	lock.Lock()
+	defer lock.Unlock()
+	for _, running := range publishers {
+		running.stop(ctx)
 	}
+	publishers = nil
 }
@@ -0,0 +1,142 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+// lifecycleRecorder 记录假发布器的启动和停止顺序，failing中的发布器启动失败
+type lifecycleRecorder struct {
+	lock    sync.Mutex
+	events  []string
+	failing map[string]bool
+}
+
+func (recorder *lifecycleRecorder) add(event string) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.events = append(recorder.events, event)
+}
+
+func (recorder *lifecycleRecorder) take() []string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	events := recorder.events
+	recorder.events = nil
+	return events
+}
+
+type fakePublisher struct {
+	recorder *lifecycleRecorder
+	name     string
+}
+
+func (publisher *fakePublisher) setup(*entity.PublisherConfig) error {
+	return nil
+}
+
+func (publisher *fakePublisher) Run(_ context.Context, config *entity.PublisherConfig) error {
+	if publisher.recorder.failing[config.Name] {
+		return errors.New("fake failure")
+	}
+	publisher.name = config.Name
+	publisher.recorder.add("start " + config.Name)
+	return nil
+}
+
+func (publisher *fakePublisher) Stop(context.Context) {
+	publisher.recorder.add("stop " + publisher.name)
+}
+
+func fakePublisherConfig(name string, url string) *entity.PublisherConfig {
+	return &entity.PublisherConfig{Name: name, Type: "fake", Webhook: &entity.WebhookConfig{URLs: []string{url}}}
+}
+
+func TestReload(t *testing.T) {
+	recorder := &lifecycleRecorder{failing: map[string]bool{"d": true}}
+	original := createPublisher
+	createPublisher = func(string) (configurablePublisher, error) {
+		return &fakePublisher{recorder: recorder}, nil
+	}
+	defer func() { createPublisher = original }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Init(ctx, []*entity.PublisherConfig{fakePublisherConfig("a", "u1"), fakePublisherConfig("b", "u1")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.take(); !slices.Equal(got, []string{"start a", "start b"}) {
+		t.Fatalf("init got %v", got)
+	}
+
+	tests := []struct {
+		name        string
+		configs     []*entity.PublisherConfig
+		wantErr     string
+		wantEvents  []string
+		wantRunning []string // 重新加载后运行中的发布器及其地址
+		keep        []string // 实例不应被替换的发布器
+	}{
+		{"changed and added", []*entity.PublisherConfig{fakePublisherConfig("a", "u1"), fakePublisherConfig("b", "u2"), fakePublisherConfig("c", "u1")},
+			"", []string{"stop b", "start b", "start c"}, []string{"a u1", "b u2", "c u1"}, []string{"a"}},
+		{"removed", []*entity.PublisherConfig{fakePublisherConfig("a", "u1"), fakePublisherConfig("c", "u1")},
+			"", []string{"stop b"}, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		{"unchanged", []*entity.PublisherConfig{fakePublisherConfig("a", "u1"), fakePublisherConfig("c", "u1")},
+			"", nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		// 启动d失败时停止新的a，用原来的配置重新启动a，c始终保持运行
+		{"rollback", []*entity.PublisherConfig{fakePublisherConfig("a", "u2"), fakePublisherConfig("d", "u1")},
+			"publisher: publishers[1].run d publisher failed, fake failure",
+			[]string{"stop a", "start a", "stop a", "start a"}, []string{"a u1", "c u1"}, []string{"c"}},
+		{"empty", nil, "publisher config is empty", nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+		{"duplicated", []*entity.PublisherConfig{fakePublisherConfig("a", "u1"), fakePublisherConfig("a", "u2")},
+			`publisher: publishers[1].name "a" is duplicated`, nil, []string{"a u1", "c u1"}, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		before := runningPublishers()
+		err := Reload(ctx, tt.configs)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := recorder.take(); !slices.Equal(got, tt.wantEvents) {
+			t.Errorf("%v: got events %v, want %v", tt.name, got, tt.wantEvents)
+		}
+		after := runningPublishers()
+		running := make([]string, 0, len(after))
+		for _, publisher := range after {
+			running = append(running, publisher.config.Name+" "+publisher.config.Webhook.URLs[0])
+		}
+		if !slices.Equal(running, tt.wantRunning) {
+			t.Errorf("%v: got running %v, want %v", tt.name, running, tt.wantRunning)
+		}
+		for _, name := range tt.keep {
+			if findRunning(before, name) != findRunning(after, name) {
+				t.Errorf("%v: publisher %v was restarted", tt.name, name)
+			}
+		}
+	}
+
+	Stop(ctx)
+	if got := recorder.take(); !slices.Equal(got, []string{"stop a", "stop c"}) {
+		t.Errorf("stop got %v", got)
+	}
+}
+
+func runningPublishers() []*runningPublisher {
+	lock.Lock()
+	defer lock.Unlock()
+	return slices.Clone(publishers)
+}
+
+func findRunning(publishers []*runningPublisher, name string) *runningPublisher {
+	for _, running := range publishers {
+		if running.config.Name == name {
+			return running
+		}
+	}
+	return nil
+}
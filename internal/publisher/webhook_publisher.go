@@ -0,0 +1,269 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/status"
+)
+
+const (
+	webhookEventHeader     = "X-Yespeed-Event"
+	webhookSignatureHeader = "X-Yespeed-Signature"
+	defaultWebhookQueue    = 1024
+)
+
+// WebhookPublisher 事件接收和投递分离，每个地址有独立的队列和投递协程，
+// 某个地址不可用时重试不会阻塞事件接收，也不会拖慢其它地址
+type WebhookPublisher struct {
+	name    string
+	config  *entity.WebhookConfig
+	client  *http.Client
+	events  chan *entity.Event
+	targets []*webhookTarget
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	lock           sync.Mutex // 保护各地址的最近一次投递结果
+	deadLetterLock sync.Mutex
+}
+
+type webhookTarget struct {
+	url     string
+	queue   chan *webhookDelivery
+	lastErr error
+}
+
+type webhookDelivery struct {
+	eventType entity.EventType
+	payload   []byte
+}
+
+type webhookDeadLetter struct {
+	URL       string          `json:"url"`
+	Error     string          `json:"error"`
+	Attempts  int             `json:"attempts"`
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func (publisher *WebhookPublisher) setup(config *entity.PublisherConfig) error {
+	if config.Webhook == nil || len(config.Webhook.URLs) == 0 {
+		return fmt.Errorf("webhook.urls is required")
+	}
+	for i, u := range config.Webhook.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("webhook.urls[%v] %q is invalid", i, u)
+		}
+	}
+	webhookConfig := *config.Webhook
+	if webhookConfig.Timeout <= 0 {
+		webhookConfig.Timeout = 10 * time.Second
+	}
+	if webhookConfig.RetryBackoff <= 0 {
+		webhookConfig.RetryBackoff = time.Second
+	}
+	if webhookConfig.MaxRetries < 0 {
+		webhookConfig.MaxRetries = 0
+	}
+	if webhookConfig.QueueSize <= 0 {
+		webhookConfig.QueueSize = defaultWebhookQueue
+	}
+	publisher.name = config.Name
+	publisher.config = &webhookConfig
+	publisher.client = &http.Client{Timeout: webhookConfig.Timeout}
+	return nil
+}
+
+func (publisher *WebhookPublisher) Run(ctx context.Context, config *entity.PublisherConfig) error {
+	if err := publisher.setup(config); err != nil {
+		return fmt.Errorf("Publisher.Webhook: %v", err)
+	}
+	publisher.events = event.Subscribe("webhook", 256)
+
+	ctx, publisher.cancel = context.WithCancel(ctx)
+	publisher.targets = make([]*webhookTarget, 0, len(publisher.config.URLs))
+	for _, u := range publisher.config.URLs {
+		target := &webhookTarget{url: u, queue: make(chan *webhookDelivery, publisher.config.QueueSize)}
+		publisher.targets = append(publisher.targets, target)
+		publisher.wg.Add(1)
+		go publisher.deliver(ctx, target)
+	}
+	publisher.wg.Add(1)
+	go publisher.run(ctx)
+	// 没有长连接，在第一次投递失败之前视为可用
+	status.Set(publisher.name, status.StateUp, nil)
+	slog.Info("Publisher.Webhook: initialized", "urls", len(publisher.config.URLs))
+
+	return nil
+}
+
+func (publisher *WebhookPublisher) Stop(ctx context.Context) {
+	if publisher.cancel != nil {
+		publisher.cancel()
+		event.Unsubscribe(publisher.events)
+		publisher.wg.Wait()
+	}
+	status.Remove(publisher.name)
+	slog.Info("Publisher.Webhook: stopped")
+}
+
+// run 只负责接收事件并放入各地址的队列，不做任何网络请求
+func (publisher *WebhookPublisher) run(ctx context.Context) {
+	defer publisher.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-publisher.events:
+			if !ok {
+				return
+			}
+			publisher.enqueue(e)
+		}
+	}
+}
+
+// enqueue 阈值类告警由alarm模块产生alarm_raised和alarm_cleared事件，这里只做转发
+func (publisher *WebhookPublisher) enqueue(e *entity.Event) {
+	// 每次上报都会产生的内部事件不推送
+	if e.Type == entity.EventTypeDeviceUpdated || e.Type == entity.EventTypeGroupUpdated {
+		return
+	}
+	if len(publisher.config.Events) != 0 && !slices.Contains(publisher.config.Events, e.Type) {
+		return
+	}
+	payloadBytes, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Publisher.Webhook: marshal event failed", "err", err)
+		return
+	}
+	for _, target := range publisher.targets {
+		select {
+		case target.queue <- &webhookDelivery{eventType: e.Type, payload: payloadBytes}:
+		default:
+			// 队列满说明地址长时间不可用，写入死信而不是静默丢弃
+			err = fmt.Errorf("delivery queue is full, %v events pending", cap(target.queue))
+			slog.Error("Publisher.Webhook: event dropped", "url", target.url, "type", e.Type, "err", err)
+			publisher.writeDeadLetter(target.url, 0, err, payloadBytes)
+		}
+	}
+}
+
+// deliver 按顺序投递一个地址的队列，失败时在这里重试
+func (publisher *WebhookPublisher) deliver(ctx context.Context, target *webhookTarget) {
+	defer publisher.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-target.queue:
+			attempts, err := publisher.post(ctx, target.url, delivery.eventType, delivery.payload)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				slog.Error("Publisher.Webhook: deliver failed", "url", target.url, "type", delivery.eventType, "attempts", attempts, "err", err)
+				publisher.writeDeadLetter(target.url, attempts, err, delivery.payload)
+			}
+			publisher.reportDelivery(target, err)
+		}
+	}
+}
+
+// reportDelivery 任一地址重试耗尽都视为不可用，直到所有地址最近一次都投递成功
+func (publisher *WebhookPublisher) reportDelivery(target *webhookTarget, err error) {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+	target.lastErr = err
+	for _, t := range publisher.targets {
+		if t.lastErr != nil {
+			status.Set(publisher.name, status.StateDown, fmt.Errorf("%v, %v", t.url, t.lastErr))
+			return
+		}
+	}
+	status.Set(publisher.name, status.StateUp, nil)
+}
+
+func (publisher *WebhookPublisher) post(ctx context.Context, u string, eventType entity.EventType, payload []byte) (int, error) {
+	backoff := publisher.config.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = publisher.postOnce(ctx, u, eventType, payload); err == nil {
+			return attempt, nil
+		}
+		if attempt > publisher.config.MaxRetries {
+			return attempt, err
+		}
+		slog.Warn("Publisher.Webhook: deliver failed, retrying", "url", u, "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (publisher *WebhookPublisher) postOnce(ctx context.Context, u string, eventType entity.EventType, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, string(eventType))
+	if publisher.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(publisher.config.Secret))
+		mac.Write(payload)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := publisher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+func (publisher *WebhookPublisher) writeDeadLetter(u string, attempts int, err error, payload []byte) {
+	if publisher.config.DeadLetterFile == "" {
+		return
+	}
+	lineBytes, _ := json.Marshal(webhookDeadLetter{
+		URL:       u,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+
+	publisher.deadLetterLock.Lock()
+	defer publisher.deadLetterLock.Unlock()
+	file, err := os.OpenFile(publisher.config.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Publisher.Webhook: open dead letter file failed", "file", publisher.config.DeadLetterFile, "err", err)
+		return
+	}
+	defer file.Close()
+	if _, err = file.Write(append(lineBytes, '\n')); err != nil {
+		slog.Error("Publisher.Webhook: write dead letter file failed", "file", publisher.config.DeadLetterFile, "err", err)
+	}
+}
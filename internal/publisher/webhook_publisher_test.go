@@ -0,0 +1,188 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+)
+
+// webhookRecorder 记录返回200的请求
+type webhookRecorder struct {
+	lock     sync.Mutex
+	events   []*entity.Event
+	headers  []http.Header
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newWebhookServer(t *testing.T, status func() int) (*httptest.Server, *webhookRecorder) {
+	recorder := &webhookRecorder{received: make(chan struct{}, 1024)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if code := status(); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		var e entity.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("invalid payload %s", body)
+		}
+		recorder.lock.Lock()
+		recorder.events = append(recorder.events, &e)
+		recorder.headers = append(recorder.headers, r.Header.Clone())
+		recorder.bodies = append(recorder.bodies, body)
+		recorder.lock.Unlock()
+		recorder.received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return server, recorder
+}
+
+func (recorder *webhookRecorder) wait(t *testing.T, count int) {
+	for range count {
+		select {
+		case <-recorder.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v deliveries", count)
+		}
+	}
+}
+
+func runWebhook(t *testing.T, config *entity.WebhookConfig) *WebhookPublisher {
+	publisher := &WebhookPublisher{}
+	if err := publisher.Run(context.Background(), &entity.PublisherConfig{Name: "webhook", Type: "webhook", Webhook: config}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { publisher.Stop(context.Background()) })
+	return publisher
+}
+
+func TestWebhookUnavailableURLDoesNotBlockIntake(t *testing.T) {
+	attempted := make(chan struct{}, 1)
+	down, _ := newWebhookServer(t, func() int {
+		select {
+		case attempted <- struct{}{}:
+		default:
+		}
+		return http.StatusServiceUnavailable
+	})
+	up, recorder := newWebhookServer(t, func() int { return http.StatusOK })
+	deadLetterFile := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	runWebhook(t, &entity.WebhookConfig{
+		URLs:           []string{down.URL, up.URL},
+		MaxRetries:     3,
+		RetryBackoff:   time.Hour,
+		DeadLetterFile: deadLetterFile,
+		QueueSize:      4,
+	})
+
+	const count = 50
+	for i := range count {
+		event.Publish(context.Background(), &entity.Event{Type: entity.EventTypeOutletSwitched, NodeID: "node"})
+		recorder.wait(t, 1)
+		if i == 0 {
+			select {
+			case <-attempted:
+			case <-time.After(5 * time.Second):
+				t.Fatal("unavailable url was never attempted")
+			}
+		}
+	}
+
+	// 不可用的地址卡在第一条的重试上，队列满之后的事件写入死信
+	want := count - 1 - 4
+	deadLetters := 0
+	for range 100 {
+		if deadLetters = countLines(t, deadLetterFile); deadLetters == want {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if deadLetters != want {
+		t.Errorf("got %v dead letters, want %v", deadLetters, want)
+	}
+}
+
+func TestWebhookFiltersAndSigns(t *testing.T) {
+	server, recorder := newWebhookServer(t, func() int { return http.StatusOK })
+	runWebhook(t, &entity.WebhookConfig{
+		URLs:   []string{server.URL},
+		Secret: "secret",
+		Events: []entity.EventType{entity.EventTypeAlarmRaised, entity.EventTypeDeviceUpdated},
+	})
+
+	ctx := context.Background()
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeDeviceUpdated, NodeID: "node"})
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeOutletSwitched, NodeID: "node"})
+	event.Publish(ctx, &entity.Event{Type: entity.EventTypeAlarmRaised, NodeID: "node", Metric: "current"})
+	recorder.wait(t, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if len(recorder.events) != 1 || recorder.events[0].Type != entity.EventTypeAlarmRaised {
+		t.Fatalf("only alarm_raised should be delivered, got %+v", recorder.events)
+	}
+	if got := recorder.headers[0].Get(webhookEventHeader); got != string(entity.EventTypeAlarmRaised) {
+		t.Errorf("got event header %q", got)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(recorder.bodies[0])
+	if got, want := recorder.headers[0].Get(webhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var lock sync.Mutex
+	failures := 2
+	server, recorder := newWebhookServer(t, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			failures--
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	runWebhook(t, &entity.WebhookConfig{URLs: []string{server.URL}, MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+	event.Publish(context.Background(), &entity.Event{Type: entity.EventTypeNodeOnline, NodeID: "node"})
+	event.Publish(context.Background(), &entity.Event{Type: entity.EventTypeNodeOffline, NodeID: "node"})
+	recorder.wait(t, 2)
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.events[0].Type != entity.EventTypeNodeOnline || recorder.events[1].Type != entity.EventTypeNodeOffline {
+		t.Errorf("events should be delivered in order after retries, got %v, %v", recorder.events[0].Type, recorder.events[1].Type)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,314 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/collector"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/event"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	ActionOn    = "on"
+	ActionOff   = "off"
+	ActionCycle = "cycle"
+
+	MissedRunSkip    = "skip"
+	MissedRunRunOnce = "run_once"
+)
+
+var (
+	lock      sync.RWMutex
+	runner    *cron.Cron
+	jobs      []*job
+	stateFile string
+	lastRuns  map[string]time.Time
+
+	parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	// missedJobSettle 节点首次上报后等待其余插座上报完成再补跑
+	missedJobSettle = 5 * time.Second
+)
+
+type job struct {
+	config   *entity.ScheduleJobConfig
+	location *time.Location
+	schedule cron.Schedule
+	entryID  cron.EntryID
+}
+
+func Init(ctx context.Context, config *entity.SchedulerConfig) error {
+	if config == nil || len(config.Jobs) == 0 {
+		return nil
+	}
+	if err := ValidateConfig(config); err != nil {
+		return fmt.Errorf("scheduler: %v", err)
+	}
+
+	// 时区和cron表达式已经校验过，不会出错
+	jobs = make([]*job, 0, len(config.Jobs))
+	for _, jobConfig := range config.Jobs {
+		location, _ := jobLocation(config, jobConfig)
+		schedule, _ := parser.Parse(jobConfig.Cron)
+		jobs = append(jobs, &job{config: jobConfig, location: location, schedule: schedule})
+	}
+
+	stateFile = config.StateFile
+	lastRuns = loadState()
+	runner = cron.New()
+	for _, j := range jobs {
+		j.entryID = runner.Schedule(&locationSchedule{schedule: j.schedule, location: j.location}, cron.FuncJob(func() {
+			runJob(ctx, j)
+		}))
+	}
+	runMissedJobs(ctx)
+	runner.Start()
+	go func(runner *cron.Cron) {
+		<-ctx.Done()
+		<-runner.Stop().Done()
+	}(runner)
+	slog.Info("Scheduler: initialized", "jobs", len(jobs))
+	return nil
+}
+
+// ValidateConfig 用于检查配置，错误信息中的字段路径相对于scheduler配置
+func ValidateConfig(config *entity.SchedulerConfig) error {
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			return fmt.Errorf("timezone %v is invalid, %v", config.Timezone, err)
+		}
+	}
+	names := make(map[string]bool, len(config.Jobs))
+	for i, jobConfig := range config.Jobs {
+		if jobConfig == nil {
+			return fmt.Errorf("jobs[%v] is empty", i)
+		}
+		if jobConfig.Name == "" || names[jobConfig.Name] {
+			return fmt.Errorf("jobs[%v].name %q is empty or duplicated", i, jobConfig.Name)
+		}
+		names[jobConfig.Name] = true
+		if jobConfig.NodeID == "" {
+			return fmt.Errorf("jobs[%v].node_id is empty", i)
+		}
+		switch jobConfig.Action {
+		case ActionOn, ActionOff, ActionCycle:
+		default:
+			return fmt.Errorf("jobs[%v].action %q must be on, off or cycle", i, jobConfig.Action)
+		}
+		switch jobConfig.MissedRun {
+		case "", MissedRunSkip, MissedRunRunOnce:
+		default:
+			return fmt.Errorf("jobs[%v].missed_run %q must be skip or run_once", i, jobConfig.MissedRun)
+		}
+		if _, err := jobLocation(config, jobConfig); err != nil {
+			return fmt.Errorf("jobs[%v].timezone %v is invalid, %v", i, jobConfig.Timezone, err)
+		}
+		if _, err := parser.Parse(jobConfig.Cron); err != nil {
+			return fmt.Errorf("jobs[%v].cron %q is invalid, %v", i, jobConfig.Cron, err)
+		}
+	}
+	return nil
+}
+
+// jobLocation 任务未配置时区时使用scheduler的默认时区，都未配置时使用本地时区
+func jobLocation(config *entity.SchedulerConfig, jobConfig *entity.ScheduleJobConfig) (*time.Location, error) {
+	switch {
+	case jobConfig.Timezone != "":
+		return time.LoadLocation(jobConfig.Timezone)
+	case config.Timezone != "":
+		return time.LoadLocation(config.Timezone)
+	}
+	return time.Local, nil
+}
+
+// GetJobs 返回全部计划任务及其下一次执行时间，按下一次执行时间排序
+func GetJobs(_ context.Context) []*entity.ScheduleJob {
+	if runner == nil {
+		return []*entity.ScheduleJob{}
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	result := make([]*entity.ScheduleJob, 0, len(jobs))
+	for _, j := range jobs {
+		result = append(result, &entity.ScheduleJob{
+			Name:     j.config.Name,
+			Cron:     j.config.Cron,
+			Timezone: j.location.String(),
+			NodeID:   j.config.NodeID,
+			Outlets:  j.config.Outlets,
+			Action:   j.config.Action,
+			LastRun:  lastRuns[j.config.Name],
+			NextRun:  runner.Entry(j.entryID).Next,
+		})
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].NextRun.Before(result[k].NextRun)
+	})
+	return result
+}
+
+// locationSchedule 让每个任务在自己的时区内计算下一次执行时间
+type locationSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func (s *locationSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location))
+}
+
+// runMissedJobs 启动时数据库还是空的，错过的任务等到节点首次上报后再补跑
+func runMissedJobs(ctx context.Context) {
+	now := time.Now()
+	pending := make(map[string][]*job)
+	for _, j := range jobs {
+		lastRun, ok := lastRuns[j.config.Name]
+		if !ok || j.config.MissedRun != MissedRunRunOnce {
+			continue
+		}
+		if next := j.schedule.Next(lastRun.In(j.location)); next.Before(now) {
+			slog.Info("Scheduler: job missed, waiting for node telemetry", "job", j.config.Name, "missed", next)
+			pending[j.config.NodeID] = append(pending[j.config.NodeID], j)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	events := event.Subscribe("scheduler", 64)
+	// 订阅之前已经上报过的节点直接补跑
+	for nodeId, missed := range pending {
+		if len(database.GetPDUNodeDevices(ctx, nodeId)) > 0 {
+			delete(pending, nodeId)
+			go runMissedNodeJobs(ctx, missed)
+		}
+	}
+	go func() {
+		defer event.Unsubscribe(events)
+		for len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				if missed, ok := pending[e.NodeID]; ok && e.Type == entity.EventTypeNodeOnline {
+					delete(pending, e.NodeID)
+					go runMissedNodeJobs(ctx, missed)
+				}
+			}
+		}
+	}()
+}
+
+func runMissedNodeJobs(ctx context.Context, missed []*job) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(missedJobSettle):
+	}
+	for _, j := range missed {
+		slog.Info("Scheduler: running missed job", "job", j.config.Name)
+		runJob(ctx, j)
+	}
+}
+
+// runJob 至少有一条命令下发成功才记录执行时间，全部失败时重启后仍会补跑
+func runJob(ctx context.Context, j *job) {
+	now := time.Now()
+	outlets := j.config.Outlets
+	if len(outlets) == 0 {
+		for _, device := range database.GetPDUNodeDevices(ctx, j.config.NodeID) {
+			if device.PduDevice != nil {
+				outlets = append(outlets, device.PduDevice.ID)
+			}
+		}
+	}
+	if len(outlets) == 0 {
+		slog.Warn("Scheduler: job has no outlet to operate", "job", j.config.Name, "nodeId", j.config.NodeID)
+		return
+	}
+	slog.Info("Scheduler: running job", "job", j.config.Name, "action", j.config.Action, "outlets", outlets)
+
+	sent := false
+	switch j.config.Action {
+	case ActionOn:
+		sent = sendCommand(ctx, j.config.NodeID, outlets, "ON")
+	case ActionOff:
+		sent = sendCommand(ctx, j.config.NodeID, outlets, "OFF")
+	case ActionCycle:
+		sendCommand(ctx, j.config.NodeID, outlets, "OFF")
+		delay := j.config.CycleDelay
+		if delay <= 0 {
+			delay = 5 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		sent = sendCommand(ctx, j.config.NodeID, outlets, "ON")
+	}
+	if !sent {
+		return
+	}
+	lock.Lock()
+	lastRuns[j.config.Name] = now
+	lock.Unlock()
+	saveState()
+}
+
+// sendCommand 返回是否有命令下发成功
+func sendCommand(ctx context.Context, nodeId string, outlets []string, command string) bool {
+	sent := false
+	for _, deviceId := range outlets {
+		if err := collector.SendCommand(ctx, &entity.Command{
+			NodeID:   nodeId,
+			DeviceID: deviceId,
+			Type:     "switch",
+			Command:  command,
+		}); err != nil {
+			slog.Error("Scheduler: send command failed", "nodeId", nodeId, "deviceId", deviceId, "err", err)
+		} else {
+			sent = true
+		}
+	}
+	return sent
+}
+
+func loadState() map[string]time.Time {
+	result := make(map[string]time.Time)
+	if stateFile == "" {
+		return result
+	}
+	stateBytes, err := os.ReadFile(stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Scheduler: read state file failed", "file", stateFile, "err", err)
+		}
+		return result
+	}
+	if err = json.Unmarshal(stateBytes, &result); err != nil {
+		slog.Error("Scheduler: unmarshal state file failed", "file", stateFile, "err", err)
+	}
+	return result
+}
+
+func saveState() {
+	if stateFile == "" {
+		return
+	}
+	lock.RLock()
+	stateBytes, _ := json.MarshalIndent(lastRuns, "", "  ")
+	lock.RUnlock()
+	if err := os.WriteFile(stateFile, stateBytes, 0644); err != nil {
+		slog.Error("Scheduler: write state file failed", "file", stateFile, "err", err)
+	}
+}
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+	"github.com/kuretru/Yespeed-PDU-Gateway/internal/database"
+)
+
+func TestLocationSchedule(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) // 上海时间08:00
+	tests := []struct {
+		cron     string
+		location *time.Location
+		want     time.Time
+	}{
+		{"30 7 * * *", time.UTC, time.Date(2026, 1, 1, 7, 30, 0, 0, time.UTC)},
+		{"30 7 * * *", shanghai, time.Date(2026, 1, 1, 23, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", shanghai, time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{"@hourly", shanghai, time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.UTC, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := parser.Parse(tt.cron)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.cron, err)
+		}
+		got := (&locationSchedule{schedule: schedule, location: tt.location}).Next(from)
+		if !got.Equal(tt.want) {
+			t.Errorf("%v in %v: got %v, want %v", tt.cron, tt.location, got.UTC(), tt.want)
+		}
+	}
+}
+
+func TestMissedRunWaitsForTelemetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	missedJobSettle = 10 * time.Millisecond
+
+	stateFile := filepath.Join(t.TempDir(), "scheduler.json")
+	lastRun := time.Now().Add(-48 * time.Hour)
+	state, _ := json.Marshal(map[string]time.Time{"missed": lastRun, "skipped": lastRun})
+	if err := os.WriteFile(stateFile, state, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := Init(ctx, &entity.SchedulerConfig{StateFile: stateFile, Jobs: []*entity.ScheduleJobConfig{
+		{Name: "missed", Cron: "@daily", NodeID: "node", Action: ActionOff, MissedRun: MissedRunRunOnce},
+		{Name: "skipped", Cron: "@daily", NodeID: "node", Action: ActionOn, Outlets: []string{"2"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 节点还没有上报，没有插座可操作，也不能记录执行时间
+	time.Sleep(5 * missedJobSettle)
+	if got := lastRunOf("missed"); !got.Equal(lastRun) {
+		t.Fatalf("missed job ran before telemetry, lastRun %v", got)
+	}
+
+	database.SetPUDDevice(ctx, "node", "1", &entity.PDUDevice{NodeID: "node", ID: "1", On: true})
+	deadline := time.Now().Add(5 * time.Second)
+	for lastRunOf("missed").Equal(lastRun) {
+		if time.Now().After(deadline) {
+			t.Fatal("missed job did not run after the node came online")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if on, ok := database.GetDesiredState(ctx, "node", "1"); !ok || on {
+		t.Errorf("outlet 1 should be switched off, got on=%v ok=%v", on, ok)
+	}
+	if _, ok := database.GetDesiredState(ctx, "node", "2"); ok {
+		t.Error("job with missed_run skip should not run")
+	}
+	if got := lastRunOf("skipped"); !got.Equal(lastRun) {
+		t.Errorf("skipped job lastRun changed to %v", got)
+	}
+
+	saved := make(map[string]time.Time)
+	stateBytes, _ := os.ReadFile(stateFile)
+	if err := json.Unmarshal(stateBytes, &saved); err != nil || saved["missed"].Equal(lastRun) {
+		t.Errorf("state file not updated after the run: %s", stateBytes)
+	}
+}
+
+func TestRunJobWithoutOutlets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.Init(ctx)
+	lastRuns = make(map[string]time.Time)
+	stateFile = ""
+
+	runJob(ctx, &job{config: &entity.ScheduleJobConfig{Name: "empty", NodeID: "unknown", Action: ActionOn}})
+	if _, ok := lastRuns["empty"]; ok {
+		t.Error("lastRun should not be recorded when no command was sent")
+	}
+}
+
+func lastRunOf(name string) time.Time {
+	lock.RLock()
+	defer lock.RUnlock()
+	return lastRuns[name]
+}
@@ -0,0 +1,64 @@
+package status
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+const (
+	StateConnecting = "connecting"
+	StateUp         = "up"
+	StateDown       = "down"
+)
+
+var (
+	lock       sync.Mutex
+	components = make(map[string]*entity.ComponentStatus)
+)
+
+// Set 更新组件状态，状态不变时只更新错误信息，Since保持不变
+func Set(name string, state string, err error) {
+	lock.Lock()
+	defer lock.Unlock()
+	component, ok := components[name]
+	if !ok {
+		component = &entity.ComponentStatus{Name: name}
+		components[name] = component
+	}
+	if component.State != state {
+		if ok {
+			slog.Info("Status: component state changed", "component", name, "old", component.State, "new", state)
+		}
+		component.State = state
+		component.Since = time.Now()
+	}
+	component.Error = ""
+	if err != nil {
+		component.Error = err.Error()
+	}
+}
+
+// Remove 组件停止后不再报告状态
+func Remove(name string) {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(components, name)
+}
+
+func GetAll() []*entity.ComponentStatus {
+	lock.Lock()
+	defer lock.Unlock()
+	result := make([]*entity.ComponentStatus, 0, len(components))
+	for _, component := range components {
+		componentCopy := *component
+		result = append(result, &componentCopy)
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].Name < result[k].Name
+	})
+	return result
+}
@@ -0,0 +1,55 @@
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+func TestSetRemoveGetAll(t *testing.T) {
+	components = make(map[string]*entity.ComponentStatus)
+	Set("publisher", StateConnecting, nil)
+	Set("collector", StateDown, errors.New("connection refused"))
+	all := GetAll()
+	if len(all) != 2 || all[0].Name != "collector" || all[1].Name != "publisher" {
+		t.Fatalf("GetAll should be sorted by name, got %+v %+v", all[0], all[1])
+	}
+	if all[0].State != StateDown || all[0].Error != "connection refused" || all[1].State != StateConnecting || all[1].Error != "" {
+		t.Errorf("got %+v %+v", all[0], all[1])
+	}
+	since := all[0].Since
+
+	// 状态不变时只更新错误信息
+	time.Sleep(10 * time.Millisecond)
+	Set("collector", StateDown, errors.New("timeout"))
+	all = GetAll()
+	if all[0].Since != since || all[0].Error != "timeout" {
+		t.Errorf("unchanged state got %+v, want since %v", all[0], since)
+	}
+	Set("collector", StateDown, nil)
+	if all = GetAll(); all[0].Since != since || all[0].Error != "" {
+		t.Errorf("cleared error got %+v", all[0])
+	}
+
+	// 状态变化时更新Since
+	Set("collector", StateUp, nil)
+	all = GetAll()
+	if all[0].State != StateUp || !all[0].Since.After(since) {
+		t.Errorf("changed state got %+v, want since after %v", all[0], since)
+	}
+
+	// 返回的是副本，修改不影响保存的状态
+	all[0].State = StateDown
+	if GetAll()[0].State != StateUp {
+		t.Error("GetAll should return copies")
+	}
+
+	Remove("collector")
+	Remove("missing")
+	if all = GetAll(); len(all) != 1 || all[0].Name != "publisher" {
+		t.Errorf("after remove got %v components", len(all))
+	}
+	Remove("publisher")
+}
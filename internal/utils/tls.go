@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig 未配置时返回nil，由调用方使用默认的TLS设置
+func NewTLSConfig(config *entity.TLSConfig) (*tls.Config, error) {
+	if config == nil {
+		return nil, nil
+	}
+	result := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if config.MinVersion != "" {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls.min_version %q must be one of 1.0, 1.1, 1.2, 1.3", config.MinVersion)
+		}
+		result.MinVersion = version
+	}
+
+	if config.CAFile != "" {
+		caBytes, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls.ca_file %v failed, %v", config.CAFile, err)
+		}
+		result.RootCAs = x509.NewCertPool()
+		if !result.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("tls.ca_file %v contains no PEM certificate", config.CAFile)
+		}
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+		}
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate failed, %v", err)
+		}
+		result.Certificates = []tls.Certificate{certificate}
+	}
+	return result, nil
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuretru/Yespeed-PDU-Gateway/entity"
+)
+
+// testCertificates 在临时目录中生成的CA和由它签发的证书
+type testCertificates struct {
+	caFile      string
+	certFile    string
+	keyFile     string
+	otherKey    string // 与certFile不匹配的私钥
+	certificate tls.Certificate
+}
+
+func writePEM(t *testing.T, path string, blockType string, bytes []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKey(t *testing.T, path string, key *ecdsa.PrivateKey) {
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, path, "EC PRIVATE KEY", keyBytes)
+}
+
+func newTestCertificates(t *testing.T) *testCertificates {
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCertificate, err := x509.ParseCertificate(caBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一张证书既用于测试服务端也用于客户端认证
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "gateway"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCertificate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &testCertificates{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+		otherKey: filepath.Join(dir, "other.pem"),
+	}
+	writePEM(t, result.caFile, "CERTIFICATE", caBytes)
+	writePEM(t, result.certFile, "CERTIFICATE", certBytes)
+	writeKey(t, result.keyFile, key)
+	writeKey(t, result.otherKey, otherKey)
+	result.certificate, err = tls.LoadX509KeyPair(result.certFile, result.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certificates := newTestCertificates(t)
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	if config, err := NewTLSConfig(nil); config != nil || err != nil {
+		t.Errorf("NewTLSConfig(nil) = %v, %v, want nil, nil", config, err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *entity.TLSConfig
+		wantErr string
+		check   func(*tls.Config) bool
+	}{
+		{"defaults", &entity.TLSConfig{}, "",
+			func(config *tls.Config) bool {
+				return config.MinVersion == tls.VersionTLS12 && config.RootCAs == nil && len(config.Certificates) == 0 && !config.InsecureSkipVerify
+			}},
+		{"min version", &entity.TLSConfig{MinVersion: "1.3", ServerName: "pdu.local"}, "",
+			func(config *tls.Config) bool {
+				return config.MinVersion == tls.VersionTLS13 && config.ServerName == "pdu.local"
+			}},
+		{"invalid min version", &entity.TLSConfig{MinVersion: "1.4"}, `tls.min_version "1.4" must be one of`, nil},
+		{"ca", &entity.TLSConfig{CAFile: certificates.caFile}, "",
+			func(config *tls.Config) bool { return config.RootCAs != nil }},
+		{"missing ca", &entity.TLSConfig{CAFile: missing}, "read tls.ca_file " + missing + " failed", nil},
+		{"ca without pem", &entity.TLSConfig{CAFile: certificates.keyFile}, "contains no PEM certificate", nil},
+		{"client certificate", &entity.TLSConfig{CertFile: certificates.certFile, KeyFile: certificates.keyFile}, "",
+			func(config *tls.Config) bool { return len(config.Certificates) == 1 }},
+		{"cert without key", &entity.TLSConfig{CertFile: certificates.certFile}, "tls.cert_file and tls.key_file must be set together", nil},
+		{"key without cert", &entity.TLSConfig{KeyFile: certificates.keyFile}, "tls.cert_file and tls.key_file must be set together", nil},
+		{"missing key", &entity.TLSConfig{CertFile: certificates.certFile, KeyFile: missing}, "load tls client certificate failed", nil},
+		{"mismatched key", &entity.TLSConfig{CertFile: certificates.certFile, KeyFile: certificates.otherKey}, "load tls client certificate failed", nil},
+		{"insecure skip verify", &entity.TLSConfig{InsecureSkipVerify: true}, "",
+			func(config *tls.Config) bool { return config.InsecureSkipVerify }},
+	}
+	for _, tt := range tests {
+		config, err := NewTLSConfig(tt.config)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !tt.check(config) {
+			t.Errorf("%v: unexpected config %+v", tt.name, config)
+		}
+	}
+}
+
+// TestNewTLSConfigHandshake 用生成的证书与真实的TLS服务端握手，服务端要求客户端证书
+func TestNewTLSConfigHandshake(t *testing.T) {
+	certificates := newTestCertificates(t)
+	clientCAs := x509.NewCertPool()
+	caBytes, err := os.ReadFile(certificates.caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs.AppendCertsFromPEM(caBytes)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{certificates.certificate},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	tests := []struct {
+		name    string
+		config  *entity.TLSConfig
+		wantErr bool
+	}{
+		{"ca and client certificate", &entity.TLSConfig{CAFile: certificates.caFile, CertFile: certificates.certFile, KeyFile: certificates.keyFile}, false},
+		{"insecure skip verify", &entity.TLSConfig{InsecureSkipVerify: true, CertFile: certificates.certFile, KeyFile: certificates.keyFile}, false},
+		{"system roots", &entity.TLSConfig{CertFile: certificates.certFile, KeyFile: certificates.keyFile}, true},
+		{"without client certificate", &entity.TLSConfig{CAFile: certificates.caFile}, true},
+	}
+	for _, tt := range tests {
+		config, err := NewTLSConfig(tt.config)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		conn, err := tls.Dial("tcp", address, config)
+		if err == nil {
+			// TLS 1.3的客户端证书错误在握手后第一次读取时才返回
+			_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			_, err = conn.Read(make([]byte, 1))
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				err = nil
+			}
+			_ = conn.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
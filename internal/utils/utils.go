@@ -1,11 +1,9 @@
 package utils
 
-import "strconv"
-
-func ParseFloat32OrZero(value string) float32 {
-	result, err := strconv.ParseFloat(value, 32)
-	if err != nil {
-		return 0
+// Truncate 截断过长的字符串，用于日志和样本
+func Truncate(value string, size int) string {
+	if len(value) <= size {
+		return value
 	}
-	return float32(result)
+	return value[:size] + "..."
 }